@@ -7,6 +7,10 @@ import (
 	"syscall"
 	"time"
 
+	// Database drivers of the sql user store
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
 	"github.com/zahidhasann88/api-gateway/internal/config"
 	"github.com/zahidhasann88/api-gateway/internal/handlers"
 	"github.com/zahidhasann88/api-gateway/internal/middleware"
@@ -35,7 +39,9 @@ func main() {
 	srv.Use(middleware.CORS(cfg.CORS))
 
 	// Register routes
-	handlers.RegisterRoutes(srv, cfg)
+	if err := handlers.RegisterRoutes(srv, cfg); err != nil {
+		log.Fatal("Failed to register routes", "error", err)
+	}
 
 	// Start the server in a goroutine
 	go func() {
@@ -1,21 +1,30 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	LogLevel string
-	Server   ServerConfig
-	CORS     CORSConfig
-	Proxy    ProxyConfig
-	Auth     AuthConfig
-	Services map[string]ServiceConfig
+	LogLevel     string
+	Server       ServerConfig
+	CORS         CORSConfig
+	Proxy        ProxyConfig
+	Auth         AuthConfig
+	Redis        RedisConfig
+	RateLimiting RateLimitingConfig
+	Cache        CacheConfig
+	Compression  CompressionConfig
+	Services     map[string]ServiceConfig
+	Routes       []RouteConfig
 }
 
 type ServerConfig struct {
-	Address string
-	Timeout int
+	Address     string
+	Timeout     int
+	TLSCertFile string
+	TLSKeyFile  string
 }
 
 type CORSConfig struct {
@@ -30,22 +39,265 @@ type ProxyConfig struct {
 	IdleTimeout  int
 }
 
+type RedisConfig struct {
+	Address  string
+	Username string
+	Password string
+	DB       int
+}
+
+type RateLimitingConfig struct {
+	Backend  string
+	Prefix   string
+	Cooldown string
+}
+
+type CacheConfig struct {
+	Backend string
+	MaxSize int64
+	Prefix  string
+}
+
+type CompressionConfig struct {
+	Enabled        bool
+	Encodings      []string
+	MinSize        int64
+	ContentTypes   []string
+	MaxRequestSize int64
+}
+
 type AuthConfig struct {
+	Enabled           bool
+	JWTSecret         string
+	JWTSecrets        []string
+	JWKSFile          string
+	JWKSURL           string
+	JWKSRefresh       string
+	Expiration        string
+	RefreshExpiration string
+	Revocation        RevocationConfig
+	Issuer            string
+	Audience          []string
+	Leeway            string
+	Issuers           []IssuerConfig
+	Users             UsersConfig
+	APIKeys           APIKeysConfig
+}
+
+type APIKeysConfig struct {
 	Enabled    bool
-	JWTSecret  string
-	Expiration string
-	Issuer     string
+	Header     string
+	QueryParam string
+	Backend    string
+	Prefix     string
+	Consumers  []ConsumerConfig
+}
+
+type ConsumerConfig struct {
+	Name  string
+	Roles []string
+}
+
+type RevocationConfig struct {
+	Backend string
+	Prefix  string
+}
+
+type UsersConfig struct {
+	Backend string
+	File    string
+	Driver  string
+	DSN     string
+	Query   string
+	LDAP    LDAPConfig
+}
+
+type LDAPConfig struct {
+	URL           string
+	StartTLS      bool
+	BindDN        string
+	BindPassword  string
+	BaseDN        string
+	UserFilter    string
+	RoleAttribute string
+	Timeout       string
+}
+
+type IssuerConfig struct {
+	Issuer      string
+	Discovery   bool
+	JWKSFile    string
+	JWKSURL     string
+	JWKSRefresh string
+	Secrets     []string
+	Audience    []string
+	Algorithms  []string
+	Leeway      string
+	UserClaim   string
+	RolesClaim  string
 }
 
 type ServiceConfig struct {
-	URL             string
-	Timeout         int
-	RetryCount      int
-	RateLimit       int
-	Authentication  bool
-	Authorization   AuthorizationConfig
-	CircuitBreaker  CircuitBreakerConfig
-	Transformations *TransformationConfig
+	URL                string
+	Protocol           string
+	DescriptorSet      string
+	Targets            []TargetConfig
+	LoadBalancer       LoadBalancerConfig
+	Timeout            int
+	ConnectionPool     ConnectionPoolConfig
+	RetryCount         int
+	Retry              RetryConfig
+	RateLimit          int
+	RateLimiter        RateLimiterConfig
+	Authentication     bool
+	Authorization      AuthorizationConfig
+	CircuitBreaker     CircuitBreakerConfig
+	Transformations    *TransformationConfig
+	HealthCheck        HealthCheckConfig
+	OutlierDetection   OutlierDetectionConfig
+	TrafficSplit       TrafficSplitConfig
+	Mirror             MirrorConfig
+	DecompressRequests bool
+	Critical           bool
+}
+
+type RouteConfig struct {
+	Path       string
+	Methods    []string
+	Service    string
+	Protocol   string
+	Middleware []string
+	Match      RouteMatchConfig
+	Priority   int
+	Rewrite    *RewriteConfig
+	Cache      *RouteCacheConfig
+	Coalesce   *CoalesceConfig
+}
+
+type CoalesceConfig struct {
+	Headers     []string
+	MaxWait     string
+	MaxBodySize int64
+}
+
+type RouteCacheConfig struct {
+	DefaultTTL           string
+	MaxBodySize          int64
+	StaleWhileRevalidate string
+	StaleIfError         string
+}
+
+type RewriteConfig struct {
+	Path        string
+	StripPrefix string
+	Regex       string
+	Replacement string
+	AddPrefix   string
+	AddQuery    []QueryParam
+	RemoveQuery []string
+}
+
+type QueryParam struct {
+	Name  string
+	Value string
+}
+
+type RouteMatchConfig struct {
+	Hosts   []string
+	Headers []MatchCondition
+	Query   []MatchCondition
+}
+
+type MatchCondition struct {
+	Name  string
+	Value string
+}
+
+type TrafficSplitConfig struct {
+	Versions []VersionConfig
+	HashOn   string
+	HashKey  string
+	Header   string
+}
+
+type VersionConfig struct {
+	Name         string
+	Weight       int
+	URL          string
+	Targets      []TargetConfig
+	HeaderValues []string
+}
+
+type MirrorConfig struct {
+	Service     string
+	Percentage  float64
+	MaxBodySize int64
+	Timeout     string
+	MaxInFlight int
+	Compare     bool
+}
+
+type TargetConfig struct {
+	URL    string
+	Weight int
+}
+
+type LoadBalancerConfig struct {
+	Strategy string
+	HashOn   string
+	HashKey  string
+}
+
+type RetryConfig struct {
+	StatusCodes []int
+	BackoffBase string
+	BackoffMax  string
+	MaxBodySize int64
+}
+
+type RateLimiterConfig struct {
+	Keys  []string
+	Burst int
+	TTL   string
+	Roles map[string]int
+}
+
+type HealthCheckConfig struct {
+	Path               string
+	Interval           string
+	Timeout            string
+	HealthyThreshold   int
+	UnhealthyThreshold int
+	ExpectedStatus     []int
+}
+
+type ConnectionPoolConfig struct {
+	MaxConnsPerHost     int
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     string
+	DialTimeout         string
+	KeepAlive           string
+	TLSHandshakeTimeout string
+	HTTP2               HTTP2Config
+}
+
+type HTTP2Config struct {
+	Disabled                   bool
+	ReadIdleTimeout            string
+	PingTimeout                string
+	StrictMaxConcurrentStreams bool
+}
+
+type OutlierDetectionConfig struct {
+	Enabled                   bool
+	Consecutive5xx            int
+	ConsecutiveGatewayFailure int
+	LatencyFactor             float64
+	MinRequests               int
+	BaseEjectionTime          string
+	MaxEjectionTime           string
+	MaxEjectionPercent        int
 }
 
 type AuthorizationConfig struct {
@@ -70,6 +322,14 @@ type TransformConfig struct {
 	BodyToHeader map[string]string
 }
 
+// ParseDuration parses an optional duration setting
+func ParseDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
+}
+
 func Load(path string) (*Config, error) {
 	v := viper.New()
 	v.SetConfigName("config")
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/apikeys"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// APIKeysHandler issues and revokes the API keys of consumers
+type APIKeysHandler struct {
+	cfg    *config.Config
+	keys   *apikeys.Manager
+	logger logger.Logger
+}
+
+// NewAPIKeysHandler creates a new API keys handler
+func NewAPIKeysHandler(cfg *config.Config, keys *apikeys.Manager, log logger.Logger) *APIKeysHandler {
+	return &APIKeysHandler{cfg: cfg, keys: keys, logger: log}
+}
+
+// keyResponse describes a key without its hash
+func keyResponse(key *apikeys.Key) gin.H {
+	response := gin.H{
+		"id":        key.ID,
+		"consumer":  key.Consumer,
+		"services":  key.Services,
+		"createdAt": key.CreatedAt,
+	}
+	if key.ExpiresAt != nil {
+		response["expiresAt"] = key.ExpiresAt
+	}
+	return response
+}
+
+// consumerExists reports whether the consumer is configured
+func (h *APIKeysHandler) consumerExists(name string) bool {
+	for _, consumer := range h.cfg.Auth.APIKeys.Consumers {
+		if consumer.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Create issues a key of a consumer for services. The response holds the
+// only copy of the key.
+func (h *APIKeysHandler) Create(c *gin.Context) {
+	var req struct {
+		Consumer string   `json:"consumer"`
+		Services []string `json:"services"`
+		// ExpiresIn is a duration such as 720h; keys don't expire without
+		ExpiresIn string `json:"expiresIn"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Consumer == "" || len(req.Services) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a consumer and services"})
+		return
+	}
+	if !h.consumerExists(req.Consumer) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown consumer"})
+		return
+	}
+	for _, service := range req.Services {
+		if _, exists := h.cfg.Services[service]; !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown service " + service})
+			return
+		}
+	}
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expiresIn"})
+			return
+		}
+		expires := time.Now().Add(expiresIn).UTC()
+		expiresAt = &expires
+	}
+
+	apiKey, key, err := h.keys.Create(c.Request.Context(), req.Consumer, req.Services, expiresAt)
+	if err != nil {
+		h.logger.Error("Failed to create API key", "consumer", req.Consumer, "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "API keys unavailable"})
+		return
+	}
+	h.logger.Info("Created API key", "id", key.ID, "consumer", key.Consumer, "services", key.Services)
+	response := keyResponse(key)
+	response["key"] = apiKey
+	c.JSON(http.StatusCreated, response)
+}
+
+// List reports the keys, of the consumer named by the consumer query
+// parameter when given
+func (h *APIKeysHandler) List(c *gin.Context) {
+	keys, err := h.keys.List(c.Request.Context(), c.Query("consumer"))
+	if err != nil {
+		h.logger.Error("Failed to list API keys", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "API keys unavailable"})
+		return
+	}
+	response := make([]gin.H, len(keys))
+	for i, key := range keys {
+		response[i] = keyResponse(key)
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": response})
+}
+
+// Rotate replaces a key with a new one. The old key stays valid for the
+// optional gracePeriod of the body.
+func (h *APIKeysHandler) Rotate(c *gin.Context) {
+	var req struct {
+		GracePeriod string `json:"gracePeriod"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+	var grace time.Duration
+	if req.GracePeriod != "" {
+		var err error
+		if grace, err = time.ParseDuration(req.GracePeriod); err != nil || grace < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gracePeriod"})
+			return
+		}
+	}
+
+	apiKey, key, err := h.keys.Rotate(c.Request.Context(), c.Param("id"), grace)
+	if err != nil {
+		h.keyError(c, "rotate", err)
+		return
+	}
+	h.logger.Info("Rotated API key", "id", c.Param("id"), "newID", key.ID, "consumer", key.Consumer, "gracePeriod", grace)
+	response := keyResponse(key)
+	response["key"] = apiKey
+	c.JSON(http.StatusCreated, response)
+}
+
+// Revoke deletes a key
+func (h *APIKeysHandler) Revoke(c *gin.Context) {
+	if err := h.keys.Revoke(c.Request.Context(), c.Param("id")); err != nil {
+		h.keyError(c, "revoke", err)
+		return
+	}
+	h.logger.Info("Revoked API key", "id", c.Param("id"))
+	c.Status(http.StatusNoContent)
+}
+
+// keyError responds to a failed change of the key in the path
+func (h *APIKeysHandler) keyError(c *gin.Context, action string, err error) {
+	if errors.Is(err, apikeys.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	h.logger.Error("Failed to "+action+" API key", "id", c.Param("id"), "error", err)
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "API keys unavailable"})
+}
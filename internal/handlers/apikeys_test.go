@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/server"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+func TestAPIKeys(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI() + " " + r.Header.Get("X-API-Key")))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			Enabled:    true,
+			JWTSecret:  "secret",
+			Expiration: "1h",
+			Users:      config.UsersConfig{Backend: "none"},
+			APIKeys: config.APIKeysConfig{
+				Enabled:    true,
+				QueryParam: "api_key",
+				Consumers: []config.ConsumerConfig{
+					{Name: "acme", Roles: []string{"partner"}},
+					{Name: "reader", Roles: []string{"viewer"}},
+				},
+			},
+		},
+		Services: map[string]config.ServiceConfig{
+			"orders": {URL: backend.URL, Timeout: 5, Authentication: true, Authorization: config.AuthorizationConfig{Roles: []string{"partner"}}},
+			"users":  {URL: backend.URL, Timeout: 5, Authentication: true},
+		},
+	}
+	srv := newTestServer(t, cfg)
+
+	adminToken := testToken(t, cfg, "ops", "admin")
+	admin := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		return serve(srv, req)
+	}
+	create := func(body string) (string, string) {
+		w := admin("POST", "/admin/keys", body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			ID  string `json:"id"`
+			Key string `json:"key"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.ID, resp.Key
+	}
+	call := func(path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		return serve(srv, req)
+	}
+
+	acmeID, acmeKey := create(`{"consumer":"acme","services":["orders"],"expiresIn":"720h"}`)
+	_, readerKey := create(`{"consumer":"reader","services":["orders","users"]}`)
+
+	// The key is checked and removed before the request is proxied
+	w := call("/api/orders/1", acmeKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/api/orders/1 ", w.Body.String())
+	w = call("/api/orders/1?api_key="+acmeKey+"&page=2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/api/orders/1?page=2 ", w.Body.String())
+
+	// Keys are scoped to services and grant their consumer's roles
+	assert.Equal(t, http.StatusForbidden, call("/api/users/1", acmeKey).Code)
+	assert.Equal(t, http.StatusOK, call("/api/users/1", readerKey).Code)
+	assert.Equal(t, http.StatusForbidden, call("/api/orders/1", readerKey).Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/api/orders/1", acmeKey+"x").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/api/orders/1", "").Code)
+
+	// Tokens still authenticate requests without a key
+	token := testToken(t, cfg, "alice", "partner")
+	req := httptest.NewRequest("GET", "/api/orders/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	assert.Equal(t, http.StatusOK, serve(srv, req).Code)
+
+	w = admin("GET", "/admin/keys?consumer=acme", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), acmeID)
+	assert.Contains(t, w.Body.String(), "expiresAt")
+	assert.NotContains(t, w.Body.String(), "hash")
+
+	// Rotation without a grace period replaces the key at once
+	w = admin("POST", "/admin/keys/"+acmeID+"/rotate", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var rotated struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.Equal(t, http.StatusUnauthorized, call("/api/orders/1", acmeKey).Code)
+	assert.Equal(t, http.StatusOK, call("/api/orders/1", rotated.Key).Code)
+
+	assert.Equal(t, http.StatusNoContent, admin("DELETE", "/admin/keys/"+rotated.ID, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/api/orders/1", rotated.Key).Code)
+	assert.Equal(t, http.StatusNotFound, admin("DELETE", "/admin/keys/"+rotated.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, admin("POST", "/admin/keys/"+rotated.ID+"/rotate", `{"gracePeriod":"1h"}`).Code)
+
+	for _, body := range []string{
+		`{"consumer":"acme"}`,
+		`{"consumer":"unknown","services":["orders"]}`,
+		`{"consumer":"acme","services":["billing"]}`,
+		`{"consumer":"acme","services":["orders"],"expiresIn":"-1h"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, admin("POST", "/admin/keys", body).Code, body)
+	}
+
+	// Only admins manage keys, which don't grant admin access
+	req = httptest.NewRequest("GET", "/admin/keys", nil)
+	req.Header.Set("X-API-Key", readerKey)
+	assert.Equal(t, http.StatusUnauthorized, serve(srv, req).Code)
+
+	w = serve(srv, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `api_gateway_consumer_requests_total{consumer="acme",service="orders",status="200"}`)
+	assert.Contains(t, w.Body.String(), `api_gateway_consumer_requests_total{consumer="reader",service="orders",status="403"}`)
+	assert.Contains(t, w.Body.String(), `api_gateway_consumer_requests_total{consumer="acme",service="users",status="403"}`)
+}
+
+func TestAPIKeys_CachedRoute(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cache-control"))
+		w.Write([]byte("orders"))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			Enabled:    true,
+			JWTSecret:  "secret",
+			Expiration: "1h",
+			Users:      config.UsersConfig{Backend: "none"},
+			APIKeys: config.APIKeysConfig{
+				Enabled:   true,
+				Consumers: []config.ConsumerConfig{{Name: "acme"}, {Name: "globex"}},
+			},
+		},
+		Services: map[string]config.ServiceConfig{"orders": {URL: backend.URL, Timeout: 5, Authentication: true}},
+		Routes:   []config.RouteConfig{{Path: "/orders", Service: "orders", Cache: &config.RouteCacheConfig{}}},
+	}
+	srv := newTestServer(t, cfg)
+
+	adminToken := testToken(t, cfg, "ops", "admin")
+	create := func(consumer string) string {
+		req := httptest.NewRequest("POST", "/admin/keys", bytes.NewBufferString(`{"consumer":"`+consumer+`","services":["orders"]}`))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		w := serve(srv, req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			Key string `json:"key"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Key
+	}
+	acmeKey, globexKey := create("acme"), create("globex")
+	call := func(path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-API-Key", apiKey)
+		return serve(srv, req)
+	}
+
+	// A consumer's responses aren't served to other consumers
+	assert.Equal(t, "MISS", call("/orders/1?cache-control=max-age%3D60", acmeKey).Header().Get("X-Cache"))
+	assert.Equal(t, "MISS", call("/orders/1?cache-control=max-age%3D60", globexKey).Header().Get("X-Cache"))
+	assert.Equal(t, int32(2), calls.Load())
+
+	// unless the upstream makes them public
+	assert.Equal(t, "MISS", call("/orders/2?cache-control=public,max-age%3D60", acmeKey).Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", call("/orders/2?cache-control=public,max-age%3D60", globexKey).Header().Get("X-Cache"))
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestAPIKeys_InvalidConsumers(t *testing.T) {
+	cfg := &config.Config{Auth: config.AuthConfig{
+		Enabled:   true,
+		JWTSecret: "secret",
+		Users:     config.UsersConfig{Backend: "none"},
+		APIKeys: config.APIKeysConfig{
+			Enabled:   true,
+			Consumers: []config.ConsumerConfig{{Name: "acme"}, {Name: "acme"}},
+		},
+	}}
+	srv := server.New(cfg, logger.New("error"))
+	assert.Error(t, RegisterRoutes(srv, cfg))
+}
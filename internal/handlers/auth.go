@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/middleware"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+	"github.com/zahidhasann88/api-gateway/pkg/users"
+)
+
+// Results of login attempts and token refreshes
+const (
+	loginSuccess = "success"
+	loginFailure = "failure"
+	loginError   = "error"
+	refreshReuse = "reuse"
+)
+
+var (
+	loginAttempts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_login_attempts_total",
+			Help: "Total number of login attempts by result",
+		},
+		[]string{"result"},
+	)
+	tokenRefreshes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_token_refreshes_total",
+			Help: "Total number of token refreshes by result",
+		},
+		[]string{"result"},
+	)
+)
+
+// AuthHandler logs users in and out and refreshes their tokens
+type AuthHandler struct {
+	users    users.Store
+	sessions *middleware.SessionManager
+	verifier *middleware.TokenVerifier
+	logger   logger.Logger
+}
+
+// NewAuthHandler creates a new auth handler
+func NewAuthHandler(store users.Store, sessions *middleware.SessionManager, verifier *middleware.TokenVerifier, log logger.Logger) *AuthHandler {
+	return &AuthHandler{users: store, sessions: sessions, verifier: verifier, logger: log}
+}
+
+// tokensResponse is the body of successful logins and refreshes
+func tokensResponse(tokens *middleware.Tokens) gin.H {
+	return gin.H{
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    int(tokens.ExpiresIn.Seconds()),
+	}
+}
+
+// Login exchanges a user's credentials for tokens, logging failed attempts
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password required"})
+		return
+	}
+
+	requestID, _ := c.Get("RequestID")
+	user, err := h.users.Authenticate(c.Request.Context(), req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, users.ErrInvalidCredentials) {
+			loginAttempts.WithLabelValues(loginFailure).Inc()
+			h.logger.Warn("Login failed",
+				"username", req.Username,
+				"ip", c.ClientIP(),
+				"requestID", requestID,
+				"reason", "invalid credentials",
+			)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+			return
+		}
+		loginAttempts.WithLabelValues(loginError).Inc()
+		h.logger.Error("Login failed",
+			"username", req.Username,
+			"ip", c.ClientIP(),
+			"requestID", requestID,
+			"reason", "user store unavailable",
+			"error", err,
+		)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Login unavailable"})
+		return
+	}
+
+	tokens, err := h.sessions.Start(user.Username, user.Roles)
+	if err != nil {
+		loginAttempts.WithLabelValues(loginError).Inc()
+		h.logger.Error("Failed to generate token", "username", user.Username, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	loginAttempts.WithLabelValues(loginSuccess).Inc()
+	h.logger.Info("Login succeeded",
+		"username", user.Username,
+		"ip", c.ClientIP(),
+		"requestID", requestID,
+	)
+	response := tokensResponse(tokens)
+	response["user"] = user.Username
+	c.JSON(http.StatusOK, response)
+}
+
+// Refresh exchanges a refresh token for new tokens. A refresh token used
+// twice revokes its session, which is logged for auditing.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token required"})
+		return
+	}
+
+	tokens, err := h.sessions.Refresh(c.Request.Context(), req.RefreshToken)
+	switch {
+	case err == nil:
+		tokenRefreshes.WithLabelValues(loginSuccess).Inc()
+		c.JSON(http.StatusOK, tokensResponse(tokens))
+	case errors.Is(err, middleware.ErrRefreshTokenReused):
+		tokenRefreshes.WithLabelValues(refreshReuse).Inc()
+		requestID, _ := c.Get("RequestID")
+		h.logger.Warn("Refresh token reused, session revoked",
+			"ip", c.ClientIP(),
+			"requestID", requestID,
+			"reason", err,
+		)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+	case errors.Is(err, middleware.ErrInvalidRefreshToken):
+		tokenRefreshes.WithLabelValues(loginFailure).Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+	default:
+		tokenRefreshes.WithLabelValues(loginError).Inc()
+		h.logger.Error("Failed to refresh token", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Refresh unavailable"})
+	}
+}
+
+// Logout revokes the token in the Authorization header along with the
+// other tokens of its session
+func (h *AuthHandler) Logout(c *gin.Context) {
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if tokenString == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		return
+	}
+	identity, err := h.verifier.Verify(c.Request.Context(), tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	if err := h.sessions.Revoke(c.Request.Context(), identity); err != nil {
+		if errors.Is(err, middleware.ErrTokenNotRevocable) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Token can't be revoked"})
+			return
+		}
+		h.logger.Error("Failed to revoke token", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Logout unavailable"})
+		return
+	}
+
+	requestID, _ := c.Get("RequestID")
+	h.logger.Info("Logout succeeded",
+		"username", identity.UserID,
+		"ip", c.ClientIP(),
+		"requestID", requestID,
+	)
+	c.Status(http.StatusNoContent)
+}
+
+// newUserStore opens the configured user store, or returns nil when logins
+// are disabled
+func newUserStore(cfg config.UsersConfig) (users.Store, error) {
+	switch cfg.Backend {
+	case "", "none":
+		return nil, nil
+	case "htpasswd":
+		return users.NewHtpasswdStore(cfg.File)
+	case "sql":
+		if cfg.Driver == "" || cfg.DSN == "" {
+			return nil, errors.New("sql user store needs a driver and dsn")
+		}
+		db, err := sql.Open(cfg.Driver, cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return users.NewSQLStore(db, cfg.Query), nil
+	case "ldap":
+		timeout, err := config.ParseDuration(cfg.LDAP.Timeout, 5*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ldap timeout: %w", err)
+		}
+		return users.NewLDAPStore(users.LDAPConfig{
+			URL:           cfg.LDAP.URL,
+			StartTLS:      cfg.LDAP.StartTLS,
+			BindDN:        cfg.LDAP.BindDN,
+			BindPassword:  cfg.LDAP.BindPassword,
+			BaseDN:        cfg.LDAP.BaseDN,
+			UserFilter:    cfg.LDAP.UserFilter,
+			RoleAttribute: cfg.LDAP.RoleAttribute,
+			Timeout:       timeout,
+		})
+	default:
+		return nil, fmt.Errorf("unknown user store backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/middleware"
+	"github.com/zahidhasann88/api-gateway/internal/server"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+	"github.com/zahidhasann88/api-gateway/pkg/revocation"
+	"github.com/zahidhasann88/api-gateway/pkg/users"
+)
+
+func login(srv http.Handler, username, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	req := httptest.NewRequest("POST", "/auth/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return serve(srv, req)
+}
+
+func TestRegisterRoutes_Login(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("wonderland"), bcrypt.MinCost)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	require.NoError(t, os.WriteFile(file, []byte("alice:"+string(hash)+":admin\n"), 0o600))
+
+	cfg := &config.Config{Auth: config.AuthConfig{
+		Enabled:    true,
+		JWTSecret:  "secret",
+		Expiration: "1h",
+		Users:      config.UsersConfig{Backend: "htpasswd", File: file},
+	}}
+	srv := newTestServer(t, cfg)
+
+	assert.Equal(t, http.StatusUnauthorized, login(srv, "alice", "builder").Code)
+	assert.Equal(t, http.StatusUnauthorized, login(srv, "bob", "wonderland").Code)
+	assert.Equal(t, http.StatusBadRequest, login(srv, "alice", "").Code)
+
+	w := login(srv, "alice", "wonderland")
+	require.Equal(t, http.StatusOK, w.Code)
+	resp := tokens(t, w)
+	assert.Equal(t, "alice", resp.User)
+	assert.Equal(t, 3600, resp.ExpiresIn)
+
+	// The token carries the user's roles from the store
+	assert.Equal(t, http.StatusBadRequest, purge(srv, resp.Token).Code)
+}
+
+// tokensBody is the body of logins and refreshes
+type tokensBody struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+	User         string `json:"user"`
+}
+
+func tokens(t *testing.T, w *httptest.ResponseRecorder) tokensBody {
+	t.Helper()
+	var body tokensBody
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body
+}
+
+func refresh(srv http.Handler, refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"refreshToken": refreshToken})
+	return serve(srv, httptest.NewRequest("POST", "/auth/refresh", bytes.NewReader(body)))
+}
+
+func logout(srv http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return serve(srv, req)
+}
+
+// purge makes an admin request, which is a bad request when the token is
+// accepted
+func purge(srv http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/admin/cache/purge", bytes.NewBufferString(`{}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	return serve(srv, req)
+}
+
+func TestRegisterRoutes_RefreshAndLogout(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("wonderland"), bcrypt.MinCost)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	require.NoError(t, os.WriteFile(file, []byte("alice:"+string(hash)+":admin\n"), 0o600))
+
+	redisServer := miniredis.RunT(t)
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			Enabled:    true,
+			JWTSecret:  "secret",
+			Expiration: "5m",
+			Users:      config.UsersConfig{Backend: "htpasswd", File: file},
+			Revocation: config.RevocationConfig{Backend: "redis"},
+		},
+		Redis: config.RedisConfig{Address: redisServer.Addr()},
+	}
+	srv := newTestServer(t, cfg)
+
+	first := tokens(t, login(srv, "alice", "wonderland"))
+	w := refresh(srv, first.RefreshToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	second := tokens(t, w)
+	assert.Equal(t, 300, second.ExpiresIn)
+	assert.Equal(t, http.StatusBadRequest, purge(srv, second.Token).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(srv, second.Token).Code)
+	assert.Equal(t, http.StatusBadRequest, refresh(srv, "").Code)
+
+	// Reusing a refresh token revokes the session
+	assert.Equal(t, http.StatusUnauthorized, refresh(srv, first.RefreshToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(srv, second.RefreshToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, purge(srv, second.Token).Code)
+
+	// Logging out revokes the token and its session
+	third := tokens(t, login(srv, "alice", "wonderland"))
+	assert.Equal(t, http.StatusNoContent, logout(srv, third.Token).Code)
+	assert.Equal(t, http.StatusUnauthorized, purge(srv, third.Token).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(srv, third.RefreshToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, logout(srv, third.Token).Code)
+	assert.NotEmpty(t, redisServer.Keys())
+}
+
+func TestRegisterRoutes_LogoutOfTrustedIssuer(t *testing.T) {
+	cfg := &config.Config{Auth: config.AuthConfig{
+		Enabled: true,
+		Users:   config.UsersConfig{Backend: "none"},
+		Issuers: []config.IssuerConfig{{Issuer: "https://idp.example.com", Secrets: []string{"idp-secret"}}},
+	}}
+	srv := newTestServer(t, cfg)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":   "https://idp.example.com",
+		"sub":   "alice",
+		"roles": []string{"admin"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"jti":   "token-1",
+	}).SignedString([]byte("idp-secret"))
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, purge(srv, token).Code)
+	assert.Equal(t, http.StatusNoContent, logout(srv, token).Code)
+	assert.Equal(t, http.StatusUnauthorized, purge(srv, token).Code)
+}
+
+func TestRegisterRoutes_LoginDisabled(t *testing.T) {
+	srv := newTestServer(t, &config.Config{Auth: config.AuthConfig{JWTSecret: "secret"}})
+	assert.Equal(t, http.StatusNotFound, login(srv, "alice", "wonderland").Code)
+
+	srv = newTestServer(t, &config.Config{Auth: config.AuthConfig{Enabled: true, JWTSecret: "secret", Users: config.UsersConfig{Backend: "none"}}})
+	assert.Equal(t, http.StatusNotFound, login(srv, "alice", "wonderland").Code)
+
+	// Enabled authentication needs a choice of user store
+	cfg := &config.Config{Auth: config.AuthConfig{Enabled: true, JWTSecret: "secret"}}
+	err := RegisterRoutes(server.New(cfg, logger.New("error")), cfg)
+	assert.ErrorContains(t, err, "auth.users.backend")
+}
+
+func TestRegisterRoutes_InvalidUserStore(t *testing.T) {
+	for _, store := range []config.UsersConfig{
+		{Backend: "kerberos"},
+		{Backend: "htpasswd", File: filepath.Join(t.TempDir(), "missing")},
+		{Backend: "sql"},
+		{Backend: "ldap", LDAP: config.LDAPConfig{URL: "ldap://localhost"}},
+	} {
+		cfg := &config.Config{Auth: config.AuthConfig{Users: store}}
+		srv := server.New(cfg, logger.New("error"))
+		assert.Error(t, RegisterRoutes(srv, cfg), store.Backend)
+	}
+}
+
+// unavailableStore fails like a store whose backend is down
+type unavailableStore struct{}
+
+func (unavailableStore) Authenticate(ctx context.Context, username, password string) (*users.User, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestAuthHandler_StoreUnavailable(t *testing.T) {
+	sessions, err := middleware.NewSessionManager(config.AuthConfig{JWTSecret: "secret"}, revocation.NewMemoryDenylist())
+	require.NoError(t, err)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/login", NewAuthHandler(unavailableStore{}, sessions, nil, logger.New("error")).Login)
+
+	assert.Equal(t, http.StatusServiceUnavailable, login(router, "alice", "wonderland").Code)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zahidhasann88/api-gateway/internal/middleware"
+	"github.com/zahidhasann88/api-gateway/pkg/cache"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// CacheHandler purges responses from the cache of cached routes
+type CacheHandler struct {
+	store  cache.Store
+	logger logger.Logger
+}
+
+// NewCacheHandler creates a new cache handler
+func NewCacheHandler(store cache.Store, log logger.Logger) *CacheHandler {
+	return &CacheHandler{store: store, logger: log}
+}
+
+// purgeRequest selects the cached responses to purge. A response is purged
+// when any of the fields selects it.
+type purgeRequest struct {
+	// Keys are exact cache keys
+	Keys []string `json:"keys"`
+	// Prefixes select responses by the start of their path and query
+	Prefixes []string `json:"prefixes"`
+	// Tags are surrogate keys upstreams sent with responses
+	Tags []string `json:"tags"`
+}
+
+// Purge removes cached responses by key, URL prefix or surrogate key and
+// reports how many entries were removed
+func (h *CacheHandler) Purge(c *gin.Context) {
+	var req purgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Keys)+len(req.Prefixes)+len(req.Tags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected keys, prefixes or tags to purge"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	purged := 0
+	fail := func(err error) {
+		h.logger.Error("Failed to purge cache", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Cache unavailable", "purged": purged})
+	}
+
+	if len(req.Keys) > 0 {
+		n, err := h.store.Delete(ctx, req.Keys...)
+		purged += n
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+	if len(req.Prefixes) > 0 {
+		n, err := h.store.DeleteMatching(ctx, func(key string) bool {
+			uri := middleware.CacheKeyURI(key)
+			for _, prefix := range req.Prefixes {
+				if strings.HasPrefix(uri, prefix) {
+					return true
+				}
+			}
+			return false
+		})
+		purged += n
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+	if len(req.Tags) > 0 {
+		n, err := h.store.DeleteTagged(ctx, req.Tags...)
+		purged += n
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	h.logger.Info("Purged cache", "keys", req.Keys, "prefixes", req.Prefixes, "tags", req.Tags, "purged", purged)
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/middleware"
+)
+
+func TestCache_SharedStoreAndPurge(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=300")
+		w.Header().Set("Surrogate-Key", "news "+r.URL.Path[len("/news/"):])
+		w.Write([]byte("story:" + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	redisServer := miniredis.RunT(t)
+	newReplica := func() (http.Handler, *config.Config) {
+		cfg := &config.Config{
+			Auth:     config.AuthConfig{Enabled: true, JWTSecret: "secret", Expiration: "1h", Users: config.UsersConfig{Backend: "none"}},
+			Redis:    config.RedisConfig{Address: redisServer.Addr()},
+			Cache:    config.CacheConfig{Backend: "redis"},
+			Services: map[string]config.ServiceConfig{"public": {URL: backend.URL}},
+			Routes:   []config.RouteConfig{{Path: "/news", Service: "public", Middleware: []string{}, Cache: &config.RouteCacheConfig{}}},
+		}
+		return newTestServer(t, cfg), cfg
+	}
+	replicaA, cfg := newReplica()
+	replicaB, _ := newReplica()
+
+	get := func(srv http.Handler, path string) *httptest.ResponseRecorder {
+		return serve(srv, httptest.NewRequest("GET", path, nil))
+	}
+	w := get(replicaA, "/news/elections")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Empty(t, w.Header().Get("Surrogate-Key"))
+
+	// Replicas share the cache
+	w = get(replicaB, "/news/elections")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "story:/news/elections", w.Body.String())
+	assert.Empty(t, w.Header().Get("Surrogate-Key"))
+	get(replicaA, "/news/weather")
+	get(replicaA, "/news/sports")
+	require.Equal(t, int32(3), calls.Load())
+
+	purge := func(body string, roles ...string) *httptest.ResponseRecorder {
+		token := testToken(t, cfg, "ops", roles...)
+		req := httptest.NewRequest("POST", "/admin/cache/purge", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return serve(replicaB, req)
+	}
+	assert.Equal(t, http.StatusForbidden, purge(`{"tags":["news"]}`, "user").Code)
+	assert.Equal(t, http.StatusBadRequest, purge(`{}`, "admin").Code)
+
+	w = purge(`{"tags":["elections"]}`, "admin")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"purged":1}`, w.Body.String())
+	assert.Equal(t, "MISS", get(replicaA, "/news/elections").Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", get(replicaA, "/news/weather").Header().Get("X-Cache"))
+
+	key := middleware.CacheKey("public", "", "example.com", "/news/weather")
+	w = purge(`{"keys":["`+key+`"]}`, "admin")
+	assert.JSONEq(t, `{"purged":1}`, w.Body.String())
+	assert.Equal(t, "MISS", get(replicaA, "/news/weather").Header().Get("X-Cache"))
+
+	w = purge(`{"prefixes":["/news/s"]}`, "admin")
+	assert.JSONEq(t, `{"purged":1}`, w.Body.String())
+	assert.Equal(t, "MISS", get(replicaA, "/news/sports").Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", get(replicaA, "/news/elections").Header().Get("X-Cache"))
+
+	w = purge(`{"tags":["news"]}`, "admin")
+	assert.JSONEq(t, `{"purged":3}`, w.Body.String())
+
+	redisServer.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, purge(`{"tags":["news"]}`, "admin").Code)
+}
+
+func TestCache_CompressedResponses(t *testing.T) {
+	body := strings.Repeat(`{"story":"elections"}`, 10)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "max-age=300")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Compression: config.CompressionConfig{Enabled: true, MinSize: 64},
+		Services:    map[string]config.ServiceConfig{"public": {URL: backend.URL}},
+		Routes:      []config.RouteConfig{{Path: "/news", Service: "public", Middleware: []string{}, Cache: &config.RouteCacheConfig{}}},
+	}
+	srv := newTestServer(t, cfg)
+
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/news/today", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		return serve(srv, req)
+	}
+	gunzip := func(w *httptest.ResponseRecorder) string {
+		reader, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		plain, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		return string(plain)
+	}
+
+	w := get("gzip")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, gunzip(w))
+
+	// The cache keeps the plain response and compresses it for each client
+	w = get("")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+	assert.Equal(t, body, w.Body.String())
+
+	w = get("gzip")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, `W/"v1"`, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Content-Length"))
+	assert.Equal(t, body, gunzip(w))
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
+)
+
+// respondUpstreamError answers a request whose upstream call failed
+func respondUpstreamError(c *gin.Context, err error) {
+	var retriedErr *upstream.RetriedError
+	if errors.As(err, &retriedErr) {
+		c.Header(upstream.RetriesHeader, strconv.Itoa(retriedErr.Retries))
+	}
+
+	// gRPC clients only understand errors reported as a gRPC status
+	if isGRPCRequest(c.Request) {
+		respondGRPCError(c, grpcUnavailable, "upstream unavailable: "+err.Error())
+		return
+	}
+
+	var openErr *upstream.CircuitOpenError
+	if errors.As(err, &openErr) {
+		c.Header("Retry-After", retryAfterSeconds(openErr.RetryAfter))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service temporarily unavailable"})
+		return
+	}
+
+	if errors.Is(err, upstream.ErrNoHealthyTargets) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service unavailable"})
+		return
+	}
+
+	c.JSON(http.StatusBadGateway, gin.H{"error": "Service unavailable"})
+}
+
+// retryAfterSeconds formats a wait as a Retry-After value, rounding up so
+// clients never retry early
+func retryAfterSeconds(wait time.Duration) string {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
+// gRPC status codes the gateway reports itself
+const (
+	grpcUnknown           = 2
+	grpcInvalidArgument   = 3
+	grpcNotFound          = 5
+	grpcResourceExhausted = 8
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+)
+
+// isGRPCRequest reports whether a request is a gRPC call
+func isGRPCRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// respondGRPCError answers a gRPC call with a trailers-only response
+func respondGRPCError(c *gin.Context, code int, message string) {
+	contentType := "application/grpc"
+	if strings.HasPrefix(c.GetHeader("Content-Type"), grpcWebContentType) {
+		// gRPC-Web clients also read trailers-only responses from the headers
+		contentType = c.GetHeader("Content-Type")
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Grpc-Status", strconv.Itoa(code))
+	c.Header("Grpc-Message", url.PathEscape(message))
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+}
@@ -5,17 +5,20 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
 	"github.com/zahidhasann88/api-gateway/pkg/logger"
 )
 
 // GraphQLHandler handles GraphQL requests
 type GraphQLHandler struct {
-	config *config.Config
-	logger logger.Logger
+	config    *config.Config
+	logger    logger.Logger
+	upstreams *upstream.Registry
 }
 
 // GraphQLRequest represents a GraphQL request
@@ -26,10 +29,11 @@ type GraphQLRequest struct {
 }
 
 // NewGraphQLHandler creates a new GraphQL handler
-func NewGraphQLHandler(cfg *config.Config, log logger.Logger) *GraphQLHandler {
+func NewGraphQLHandler(cfg *config.Config, log logger.Logger, upstreams *upstream.Registry) *GraphQLHandler {
 	return &GraphQLHandler{
-		config: cfg,
-		logger: log,
+		config:    cfg,
+		logger:    log,
+		upstreams: upstreams,
 	}
 }
 
@@ -38,7 +42,8 @@ func (h *GraphQLHandler) HandleRequest(serviceName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if service exists
 		serviceConfig, exists := h.config.Services[serviceName]
-		if !exists {
+		service, registered := h.upstreams.Service(serviceName)
+		if !exists || !registered {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
 			return
 		}
@@ -58,8 +63,13 @@ func (h *GraphQLHandler) HandleRequest(serviceName string) gin.HandlerFunc {
 			return
 		}
 
-		// Create request to service
-		req, err := http.NewRequest("POST", serviceConfig.URL+"/graphql", bytes.NewBuffer(requestData))
+		// Create request to service, the service transport picks the instance.
+		// Services serve GraphQL on /graphql unless the route rewrites it.
+		target := &url.URL{Path: "/graphql"}
+		if rewritten, ok := rewrittenURL(c); ok {
+			target = rewritten
+		}
+		req, err := http.NewRequestWithContext(c.Request.Context(), "POST", target.String(), bytes.NewBuffer(requestData))
 		if err != nil {
 			h.logger.Error("Failed to create GraphQL request", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
@@ -80,12 +90,13 @@ func (h *GraphQLHandler) HandleRequest(serviceName string) gin.HandlerFunc {
 
 		// Make the request
 		client := &http.Client{
-			Timeout: time.Duration(serviceConfig.Timeout) * time.Second,
+			Timeout:   time.Duration(serviceConfig.Timeout) * time.Second,
+			Transport: service.RoundTripper(),
 		}
 		resp, err := client.Do(req)
 		if err != nil {
 			h.logger.Error("GraphQL request failed", "error", err)
-			c.JSON(http.StatusBadGateway, gin.H{"error": "Service unavailable"})
+			respondUpstreamError(c, err)
 			return
 		}
 		defer resp.Body.Close()
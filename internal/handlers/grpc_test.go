@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+// echoGRPCBackend streams every line it receives straight back and ends the
+// call with a gRPC status trailer
+func echoGRPCBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		lines := bufio.NewScanner(r.Body)
+		for lines.Scan() {
+			w.Write(append(lines.Bytes(), '\n'))
+			w.(http.Flusher).Flush()
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "done")
+	}), &http2.Server{}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// h2cClient speaks cleartext HTTP/2 with prior knowledge
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+func TestGRPC_BidirectionalStreamWithTrailers(t *testing.T) {
+	backend := echoGRPCBackend(t)
+	cfg := &config.Config{
+		Compression: config.CompressionConfig{Enabled: true},
+		Services: map[string]config.ServiceConfig{
+			"echo": {URL: backend.URL, Protocol: "grpc"},
+		},
+		Routes: []config.RouteConfig{
+			{Path: "/echo.v1.Echo", Service: "echo", Protocol: ProtocolGRPC},
+		},
+	}
+	gateway := httptest.NewUnstartedServer(newTestServer(t, cfg))
+	gateway.Config.ReadTimeout = 100 * time.Millisecond
+	gateway.Config.WriteTimeout = 100 * time.Millisecond
+	gateway.Start()
+	defer gateway.Close()
+
+	body, requests := io.Pipe()
+	req, err := http.NewRequest("POST", gateway.URL+"/echo.v1.Echo/Chat", body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	go requests.Write([]byte("ping 1\n"))
+	resp, err := h2cClient().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+
+	// Each message is answered before the next one is sent
+	responses := bufio.NewReader(resp.Body)
+	line, err := responses.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "ping 1\n", line)
+
+	// Streams outlive the server's read and write timeouts
+	time.Sleep(200 * time.Millisecond)
+	go requests.Write([]byte("ping 2\n"))
+	line, err = responses.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "ping 2\n", line)
+
+	requests.Close()
+	_, err = io.ReadAll(responses)
+	require.NoError(t, err)
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+	assert.Equal(t, "done", resp.Trailer.Get("Grpc-Message"))
+}
+
+func TestGRPC_UnavailableUpstream(t *testing.T) {
+	backend := echoGRPCBackend(t)
+	backend.Close()
+
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"echo": {URL: backend.URL, Protocol: "grpc"},
+		},
+		Routes: []config.RouteConfig{
+			{Path: "/echo.v1.Echo", Service: "echo", Protocol: ProtocolGRPC},
+		},
+	}
+	srv := newTestServer(t, cfg)
+
+	req := httptest.NewRequest("POST", "/echo.v1.Echo/Chat", nil)
+	req.Header.Set("Content-Type", "application/grpc")
+	w := serve(srv, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "14", w.Header().Get("Grpc-Status"))
+}
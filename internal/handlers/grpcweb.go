@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/transcoding"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// gRPC-Web content types, see
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+)
+
+// grpcWebTrailerFlag marks the frame carrying the trailers in the body
+const grpcWebTrailerFlag = 0x80
+
+// grpcWebHeaders are request headers only meant for the gateway
+var grpcWebHeaders = []string{"Content-Length", "X-Grpc-Web", "X-User-Agent", "Accept", "Connection"}
+
+// GRPCWebHandler bridges gRPC-Web calls from browsers to native gRPC services
+type GRPCWebHandler struct {
+	config    *config.Config
+	logger    logger.Logger
+	upstreams *upstream.Registry
+}
+
+// NewGRPCWebHandler creates a new gRPC-Web handler
+func NewGRPCWebHandler(cfg *config.Config, log logger.Logger, upstreams *upstream.Registry) *GRPCWebHandler {
+	return &GRPCWebHandler{
+		config:    cfg,
+		logger:    log,
+		upstreams: upstreams,
+	}
+}
+
+// HandleRequest translates gRPC-Web calls to the gRPC service
+func (h *GRPCWebHandler) HandleRequest(serviceName string, native gin.HandlerFunc) (gin.HandlerFunc, error) {
+	if h.config.Services[serviceName].Protocol != upstream.ProtocolGRPC {
+		return nil, fmt.Errorf("service %s does not speak grpc", serviceName)
+	}
+	service, exists := h.upstreams.Service(serviceName)
+	if !exists {
+		return nil, fmt.Errorf("service %s not found", serviceName)
+	}
+
+	return func(c *gin.Context) {
+		contentType := c.GetHeader("Content-Type")
+		if !strings.HasPrefix(contentType, grpcWebContentType) {
+			if isGRPCRequest(c.Request) {
+				native(c)
+				return
+			}
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Expected a gRPC-Web request"})
+			return
+		}
+		text := strings.HasPrefix(contentType, grpcWebTextContentType)
+		webType := grpcWebContentType
+		if text {
+			webType = grpcWebTextContentType
+		}
+
+		// Build the native gRPC call
+		var body io.Reader = c.Request.Body
+		if text {
+			body = &base64ChunkReader{r: bufio.NewReader(c.Request.Body)}
+		}
+		req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, upstreamURL(c).String(), body)
+		if err != nil {
+			h.logger.Error("Failed to create gRPC request", "service", serviceName, "error", err)
+			respondGRPCError(c, grpcInternal, "failed to create request")
+			return
+		}
+		req.Header = c.Request.Header.Clone()
+		for _, name := range grpcWebHeaders {
+			req.Header.Del(name)
+		}
+		req.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(contentType, webType))
+		req.Header.Set("TE", "trailers")
+		req.Header.Set("X-Gateway-Service", serviceName)
+		req.Header.Set("X-Forwarded-For", c.ClientIP())
+		if requestID, exists := c.Get("RequestID"); exists {
+			req.Header.Set("X-Request-ID", fmt.Sprintf("%v", requestID))
+		}
+
+		resp, err := service.RoundTripper().RoundTrip(req)
+		if err != nil {
+			h.logger.Error("gRPC-Web request failed", "service", serviceName, "path", req.URL.Path, "error", err)
+			respondUpstreamError(c, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		// The status moves to the trailer frame even for trailers-only
+		// responses, so clients always find it in the same place
+		for name, values := range resp.Header {
+			switch name {
+			case "Content-Type", "Content-Length", "Trailer", "Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin":
+				continue
+			}
+			for _, value := range values {
+				c.Writer.Header().Add(name, value)
+			}
+		}
+		c.Header("Content-Type", webType+strings.TrimPrefix(resp.Header.Get("Content-Type"), "application/grpc"))
+		c.Header("X-Gateway-Service", serviceName)
+		c.Status(http.StatusOK)
+
+		out := &grpcWebWriter{w: c.Writer, text: text}
+		if _, err := io.Copy(out, resp.Body); err != nil {
+			h.logger.Error("gRPC-Web response interrupted", "service", serviceName, "path", req.URL.Path, "error", err)
+			out.writeTrailers(http.Header{
+				"Grpc-Status":  {fmt.Sprint(grpcUnavailable)},
+				"Grpc-Message": {url.PathEscape("upstream stream interrupted")},
+			})
+			return
+		}
+		out.writeTrailers(grpcWebTrailers(resp))
+	}, nil
+}
+
+// grpcWebTrailers collects the trailers of a gRPC response whose body has
+// been read, including a status for responses that lack one
+func grpcWebTrailers(resp *http.Response) http.Header {
+	trailers := resp.Trailer.Clone()
+	if trailers == nil {
+		trailers = make(http.Header)
+	}
+	if trailers.Get("Grpc-Status") == "" {
+		code, message := grpcStatusOf(resp)
+		trailers.Set("Grpc-Status", fmt.Sprint(code))
+		if message != "" {
+			trailers.Set("Grpc-Message", url.PathEscape(message))
+		}
+		if details := resp.Header.Get("Grpc-Status-Details-Bin"); details != "" {
+			trailers.Set("Grpc-Status-Details-Bin", details)
+		}
+	}
+	return trailers
+}
+
+// grpcWebWriter streams gRPC frames to a gRPC-Web client. Text responses
+// are encoded chunk by chunk, each chunk padded on its own.
+type grpcWebWriter struct {
+	w    gin.ResponseWriter
+	text bool
+}
+
+func (w *grpcWebWriter) Write(p []byte) (int, error) {
+	data := p
+	if w.text {
+		data = []byte(base64.StdEncoding.EncodeToString(p))
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return 0, err
+	}
+	w.w.Flush()
+	return len(p), nil
+}
+
+// writeTrailers sends the trailers as the final frame of the body
+func (w *grpcWebWriter) writeTrailers(trailers http.Header) {
+	names := make([]string, 0, len(trailers))
+	for name := range trailers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var block bytes.Buffer
+	for _, name := range names {
+		for _, value := range trailers[name] {
+			block.WriteString(strings.ToLower(name) + ": " + value + "\r\n")
+		}
+	}
+	frame := transcoding.Frame(block.Bytes())
+	frame[0] = grpcWebTrailerFlag
+	w.Write(frame)
+}
+
+// base64ChunkReader decodes grpc-web-text bodies, which may be the
+// concatenation of several padded base64 chunks
+type base64ChunkReader struct {
+	r       *bufio.Reader
+	decoded []byte
+}
+
+func (r *base64ChunkReader) Read(p []byte) (int, error) {
+	for len(r.decoded) == 0 {
+		var quantum [4]byte
+		for i := 0; i < len(quantum); {
+			b, err := r.r.ReadByte()
+			if err != nil {
+				if err == io.EOF && i > 0 {
+					return 0, errors.New("truncated base64 body")
+				}
+				return 0, err
+			}
+			if b == '\r' || b == '\n' {
+				continue
+			}
+			quantum[i] = b
+			i++
+		}
+		decoded := make([]byte, 3)
+		n, err := base64.StdEncoding.Decode(decoded, quantum[:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid base64 body: %w", err)
+		}
+		r.decoded = decoded[:n]
+	}
+	n := copy(p, r.decoded)
+	r.decoded = r.decoded[n:]
+	return n, nil
+}
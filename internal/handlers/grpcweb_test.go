@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/transcoding"
+)
+
+// grpcWebBackend answers every message twice, then ends the call with the
+// status requested in the message. "fail" gets a trailers-only response.
+func grpcWebBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Regexp(t, `^application/grpc(\+proto)?$`, r.Header.Get("Content-Type"))
+		assert.Empty(t, r.Header.Get("X-Grpc-Web"))
+
+		message, err := transcoding.ReadMessage(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		if string(message) == "fail" {
+			w.Header().Set("Grpc-Status", "7")
+			w.Header().Set("Grpc-Message", "not%20allowed")
+			return
+		}
+		w.Write(transcoding.Frame(message))
+		w.(http.Flusher).Flush()
+		w.Write(transcoding.Frame(message))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}), &http2.Server{}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func newGRPCWebServer(t *testing.T, backendURL string) http.Handler {
+	t.Helper()
+	return newTestServer(t, &config.Config{
+		CORS: config.CORSConfig{
+			AllowedOrigins: []string{"https://app.example.com"},
+			AllowedMethods: []string{"POST"},
+			AllowedHeaders: []string{"Authorization"},
+		},
+		Services: map[string]config.ServiceConfig{
+			"echo": {URL: backendURL, Protocol: "grpc"},
+		},
+		Routes: []config.RouteConfig{
+			{Path: "/echo.v1.Echo", Service: "echo", Protocol: ProtocolGRPCWeb},
+		},
+	})
+}
+
+// readGRPCWebFrames splits a gRPC-Web response body into its messages and
+// its trailer block
+func readGRPCWebFrames(t *testing.T, body io.Reader) ([]string, string) {
+	t.Helper()
+	var messages []string
+	for {
+		flags, payload, err := transcoding.ReadFrame(body)
+		require.NoError(t, err)
+		if flags&grpcWebTrailerFlag != 0 {
+			return messages, string(payload)
+		}
+		messages = append(messages, string(payload))
+	}
+}
+
+func TestGRPCWeb_Binary(t *testing.T) {
+	srv := newGRPCWebServer(t, grpcWebBackend(t).URL)
+
+	req := httptest.NewRequest("POST", "/echo.v1.Echo/Echo", bytes.NewReader(transcoding.Frame([]byte("hello"))))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("X-Grpc-Web", "1")
+	w := serve(srv, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/grpc-web+proto", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "Grpc-Status")
+	messages, trailers := readGRPCWebFrames(t, w.Body)
+	assert.Equal(t, []string{"hello", "hello"}, messages)
+	assert.Equal(t, "grpc-status: 0\r\n", trailers)
+}
+
+func TestGRPCWeb_Text(t *testing.T) {
+	srv := newGRPCWebServer(t, grpcWebBackend(t).URL)
+
+	// Clients may send several padded chunks
+	frame := transcoding.Frame([]byte("hi"))
+	body := base64.StdEncoding.EncodeToString(frame[:4]) + base64.StdEncoding.EncodeToString(frame[4:])
+	req := httptest.NewRequest("POST", "/echo.v1.Echo/Echo", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/grpc-web-text")
+	w := serve(srv, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/grpc-web-text+proto", w.Header().Get("Content-Type"))
+	messages, trailers := readGRPCWebFrames(t, &base64ChunkReader{r: bufio.NewReader(w.Body)})
+	assert.Equal(t, []string{"hi", "hi"}, messages)
+	assert.Equal(t, "grpc-status: 0\r\n", trailers)
+}
+
+func TestGRPCWeb_TrailersOnly(t *testing.T) {
+	srv := newGRPCWebServer(t, grpcWebBackend(t).URL)
+
+	req := httptest.NewRequest("POST", "/echo.v1.Echo/Echo", bytes.NewReader(transcoding.Frame([]byte("fail"))))
+	req.Header.Set("Content-Type", "application/grpc-web")
+	w := serve(srv, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Grpc-Status"))
+	messages, trailers := readGRPCWebFrames(t, w.Body)
+	assert.Empty(t, messages)
+	assert.Equal(t, "grpc-message: not%20allowed\r\ngrpc-status: 7\r\n", trailers)
+}
+
+func TestGRPCWeb_Errors(t *testing.T) {
+	backend := grpcWebBackend(t)
+	srv := newGRPCWebServer(t, backend.URL)
+
+	req := httptest.NewRequest("POST", "/echo.v1.Echo/Echo", bytes.NewBufferString("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	w := serve(srv, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	backend.Close()
+	req = httptest.NewRequest("POST", "/echo.v1.Echo/Echo", bytes.NewReader(transcoding.Frame(nil)))
+	req.Header.Set("Content-Type", "application/grpc")
+	w = serve(srv, req)
+	assert.Equal(t, "application/grpc", w.Header().Get("Content-Type"), "native calls are proxied")
+	assert.Equal(t, "14", w.Header().Get("Grpc-Status"))
+
+	req = httptest.NewRequest("POST", "/echo.v1.Echo/Echo", bytes.NewReader(transcoding.Frame(nil)))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	w = serve(srv, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/grpc-web+proto", w.Header().Get("Content-Type"))
+	assert.Equal(t, "14", w.Header().Get("Grpc-Status"))
+}
+
+func TestGRPCWeb_Preflight(t *testing.T) {
+	srv := newGRPCWebServer(t, grpcWebBackend(t).URL)
+
+	req := httptest.NewRequest("OPTIONS", "/echo.v1.Echo/Echo", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent")
+	w := serve(srv, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "Authorization, Content-Type, X-Grpc-Web, X-User-Agent, Grpc-Timeout", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "Grpc-Status, Grpc-Message, Grpc-Status-Details-Bin", w.Header().Get("Access-Control-Expose-Headers"))
+}
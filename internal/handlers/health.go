@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
+)
+
+// HealthHandler reports the liveness and readiness of the gateway
+type HealthHandler struct {
+	upstreams *upstream.Registry
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(upstreams *upstream.Registry) *HealthHandler {
+	return &HealthHandler{upstreams: upstreams}
+}
+
+// Live reports that the gateway process is up and serving requests
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready reports the health of every service and fails when a critical
+// service has no healthy targets
+func (h *HealthHandler) Ready(c *gin.Context) {
+	status, code := "ready", http.StatusOK
+	if !h.upstreams.Ready() {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+
+	c.JSON(code, gin.H{
+		"status":   status,
+		"services": h.upstreams.Health(),
+	})
+}
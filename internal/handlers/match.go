@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/server"
+)
+
+// routeMatcher checks the match conditions of a route
+type routeMatcher struct {
+	hosts   []string
+	headers []config.MatchCondition
+	query   []config.MatchCondition
+}
+
+func newRouteMatcher(cfg config.RouteMatchConfig) (*routeMatcher, error) {
+	m := &routeMatcher{query: cfg.Query}
+	for _, host := range cfg.Hosts {
+		// Only a leading "*." label is a wildcard
+		normalized := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+		if normalized == "" || strings.Contains(strings.TrimPrefix(normalized, "*."), "*") {
+			return nil, fmt.Errorf("invalid host %q", host)
+		}
+		m.hosts = append(m.hosts, normalized)
+	}
+	for _, header := range cfg.Headers {
+		if header.Name == "" {
+			return nil, fmt.Errorf("header condition without a name")
+		}
+		m.headers = append(m.headers, config.MatchCondition{
+			Name:  http.CanonicalHeaderKey(header.Name),
+			Value: header.Value,
+		})
+	}
+	for _, param := range cfg.Query {
+		if param.Name == "" {
+			return nil, fmt.Errorf("query condition without a name")
+		}
+	}
+	return m, nil
+}
+
+// conditional reports whether the matcher can reject requests
+func (m *routeMatcher) conditional() bool {
+	return len(m.hosts) > 0 || len(m.headers) > 0 || len(m.query) > 0
+}
+
+// matches reports whether a request meets every condition
+func (m *routeMatcher) matches(r *http.Request) bool {
+	if len(m.hosts) > 0 && !m.matchesHost(r.Host) {
+		return false
+	}
+	for _, header := range m.headers {
+		if !matchesCondition(r.Header.Values(header.Name), header.Value) {
+			return false
+		}
+	}
+	if len(m.query) > 0 {
+		query := r.URL.Query()
+		for _, param := range m.query {
+			if !matchesCondition(query[param.Name], param.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (m *routeMatcher) matchesHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	for _, pattern := range m.hosts {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesCondition reports whether a header or query parameter is present,
+// with the wanted value when one is given
+func matchesCondition(values []string, want string) bool {
+	if want == "" {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+// registerRoutes registers compiled routes, dispatching those sharing a path
+func registerRoutes(srv *server.Server, routes []*compiledRoute) {
+	routes = append([]*compiledRoute(nil), routes...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].priority > routes[j].priority
+	})
+
+	type routeKey struct{ method, pattern string }
+	var keys []routeKey
+	groups := make(map[routeKey][]*compiledRoute)
+	for _, route := range routes {
+		for _, method := range route.methods {
+			key := routeKey{method, route.pattern}
+			if _, exists := groups[key]; !exists {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], route)
+		}
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) == 1 && !group[0].matcher.conditional() {
+			srv.Handle(key.method, key.pattern, group[0].handlers...)
+			continue
+		}
+		srv.Handle(key.method, key.pattern, newRouteDispatcher(key.method, key.pattern, group).handle)
+	}
+}
+
+// dispatcherKey is the request context key holding the context of the
+// dispatcher that passed the request on
+type dispatcherKey struct{}
+
+// routeDispatcher serves routes sharing a method and path. Each route keeps
+// its handler chain on a router of its own, so the chains don't add up.
+type routeDispatcher struct {
+	routes  []*compiledRoute
+	routers []*gin.Engine
+}
+
+func newRouteDispatcher(method, pattern string, routes []*compiledRoute) *routeDispatcher {
+	d := &routeDispatcher{routes: routes}
+	for _, route := range routes {
+		router := gin.New()
+		router.Handle(method, pattern, append(gin.HandlersChain{adoptKeys}, route.handlers...)...)
+		d.routers = append(d.routers, router)
+	}
+	return d
+}
+
+// handle passes the request to the router of the first matching route
+func (d *routeDispatcher) handle(c *gin.Context) {
+	for i, route := range d.routes {
+		if !route.matcher.matches(c.Request) {
+			continue
+		}
+		if c.Keys == nil {
+			c.Keys = make(map[string]any)
+		}
+		ctx := context.WithValue(c.Request.Context(), dispatcherKey{}, c)
+		d.routers[i].ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "No route matches the request"})
+}
+
+// adoptKeys shares the keys of the dispatcher's context with the route, so
+// that the global middleware sees what the route's handlers set
+func adoptKeys(c *gin.Context) {
+	dispatcher := c.Request.Context().Value(dispatcherKey{}).(*gin.Context)
+	c.Keys = dispatcher.Keys
+	c.Next()
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+func TestRouteMatcher(t *testing.T) {
+	matcher, err := newRouteMatcher(config.RouteMatchConfig{
+		Hosts:   []string{"api.tenant-a.com", "*.tenant-b.com"},
+		Headers: []config.MatchCondition{{Name: "x-client", Value: "mobile"}},
+		Query:   []config.MatchCondition{{Name: "beta"}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		host    string
+		header  string
+		query   string
+		matches bool
+	}{
+		{"all conditions", "api.tenant-a.com", "mobile", "beta=1", true},
+		{"host with port", "API.tenant-a.com:8443", "mobile", "beta", true},
+		{"wildcard host", "eu.api.tenant-b.com", "mobile", "beta", true},
+		{"wildcard needs a subdomain", "tenant-b.com", "mobile", "beta", false},
+		{"other host", "api.tenant-c.com", "mobile", "beta", false},
+		{"other header value", "api.tenant-a.com", "web", "beta", false},
+		{"missing query parameter", "api.tenant-a.com", "mobile", "alpha=1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			req.Host = tt.host
+			req.Header.Set("X-Client", tt.header)
+			assert.Equal(t, tt.matches, matcher.matches(req))
+		})
+	}
+
+	for _, host := range []string{"", "*", "api.*.com", "*.*.com"} {
+		_, err := newRouteMatcher(config.RouteMatchConfig{Hosts: []string{host}})
+		assert.Error(t, err, host)
+	}
+	_, err = newRouteMatcher(config.RouteMatchConfig{Headers: []config.MatchCondition{{Value: "x"}}})
+	assert.Error(t, err)
+}
+
+func TestRegisterRoutes_MatchRules(t *testing.T) {
+	backend := func(name string) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+
+	cfg := &config.Config{
+		Auth: config.AuthConfig{Enabled: true, JWTSecret: "secret", Users: config.UsersConfig{Backend: "none"}},
+		Services: map[string]config.ServiceConfig{
+			"tenant-a": {URL: backend("tenant-a")},
+			"tenant-b": {URL: backend("tenant-b")},
+			"mobile":   {URL: backend("mobile")},
+			"internal": {URL: backend("internal")},
+		},
+		Routes: []config.RouteConfig{
+			{Path: "/v1", Service: "tenant-a", Middleware: []string{}, Match: config.RouteMatchConfig{Hosts: []string{"api.tenant-a.com"}}},
+			{Path: "/v1", Service: "tenant-b", Middleware: []string{}, Match: config.RouteMatchConfig{Hosts: []string{"api.tenant-b.com"}}},
+			{
+				Path: "/v1", Service: "mobile", Middleware: []string{}, Priority: 10,
+				Match: config.RouteMatchConfig{Headers: []config.MatchCondition{{Name: "X-Client", Value: "mobile"}}},
+			},
+			{
+				Path: "/v1", Service: "internal", Methods: []string{"DELETE"}, Middleware: []string{"auth"},
+				Match: config.RouteMatchConfig{Hosts: []string{"api.tenant-a.com"}}, Priority: 5,
+			},
+		},
+	}
+	srv := newTestServer(t, cfg)
+
+	request := func(method, host string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/items", nil)
+		req.Host = host
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		return serve(srv, req)
+	}
+
+	assert.Equal(t, "tenant-a", request("GET", "api.tenant-a.com", nil).Body.String())
+	assert.Equal(t, "tenant-b", request("GET", "api.tenant-b.com", nil).Body.String())
+
+	// Higher priorities are tried first
+	assert.Equal(t, "mobile", request("GET", "api.tenant-b.com", map[string]string{"X-Client": "mobile"}).Body.String())
+
+	// Middleware only runs for the route that matched
+	assert.Equal(t, http.StatusUnauthorized, request("DELETE", "api.tenant-a.com", nil).Code)
+	assert.Equal(t, "tenant-b", request("DELETE", "api.tenant-b.com", nil).Body.String())
+
+	w := request("GET", "api.tenant-c.com", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRegisterRoutes_ManyMatchVariants(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Tenant")))
+	}))
+	defer backend.Close()
+
+	// Every route brings a full handler chain, more than gin allows for one
+	// path if the chains were joined
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{}}
+	for i := 0; i < 12; i++ {
+		name := fmt.Sprintf("tenant-%d", i)
+		cfg.Services[name] = config.ServiceConfig{URL: backend.URL, RateLimit: 100, Transformations: &config.TransformationConfig{}}
+		cfg.Routes = append(cfg.Routes, config.RouteConfig{
+			Path: "/v1", Service: name,
+			Match: config.RouteMatchConfig{Headers: []config.MatchCondition{{Name: "X-Tenant", Value: name}}},
+			Cache: &config.RouteCacheConfig{}, Coalesce: &config.CoalesceConfig{},
+		})
+	}
+	srv := newTestServer(t, cfg)
+
+	for _, tenant := range []string{"tenant-0", "tenant-11"} {
+		req := httptest.NewRequest("GET", "/v1/items", nil)
+		req.Header.Set("X-Tenant", tenant)
+		w := serve(srv, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, tenant, w.Body.String())
+	}
+
+	// Global middleware sees the service of the route that served
+	w := serve(srv, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `api_gateway_requests_total{method="GET",service="tenant-11",status="200"`)
+}
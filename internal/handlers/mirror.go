@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// Outcomes of mirrored requests
+const (
+	mirrorSent           = "sent"
+	mirrorMatch          = "match"
+	mirrorStatusMismatch = "status_mismatch"
+	mirrorBodyMismatch   = "body_mismatch"
+	mirrorError          = "error"
+	mirrorDropped        = "dropped"
+	mirrorTooLarge       = "too_large"
+)
+
+var mirrorRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_mirror_requests_total",
+		Help: "Total number of requests mirrored to shadow services by outcome",
+	},
+	[]string{"service", "shadow", "result"},
+)
+
+// mirror copies a share of a service's requests to a shadow service. The
+// copies run in the background and never delay or fail the primary request.
+type mirror struct {
+	service     string
+	shadowName  string
+	shadow      *upstream.Service
+	percentage  float64
+	maxBodySize int64
+	timeout     time.Duration
+	compare     bool
+	logger      logger.Logger
+
+	// inFlight bounds the concurrent copies, more are dropped
+	inFlight chan struct{}
+	random   func() float64
+}
+
+// newMirror creates the mirror of a service, nil when it has none
+func newMirror(serviceName string, cfg config.MirrorConfig, upstreams *upstream.Registry, log logger.Logger) (*mirror, error) {
+	if cfg.Service == "" {
+		return nil, nil
+	}
+	if cfg.Service == serviceName {
+		return nil, fmt.Errorf("service %s can't mirror to itself", serviceName)
+	}
+	shadow, exists := upstreams.Service(cfg.Service)
+	if !exists {
+		return nil, fmt.Errorf("mirror service %s not found", cfg.Service)
+	}
+	if cfg.Percentage < 0 || cfg.Percentage > 100 {
+		return nil, fmt.Errorf("mirror percentage %v is not between 0 and 100", cfg.Percentage)
+	}
+	timeout, err := config.ParseDuration(cfg.Timeout, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror timeout: %w", err)
+	}
+
+	m := &mirror{
+		service:     serviceName,
+		shadowName:  cfg.Service,
+		shadow:      shadow,
+		percentage:  cfg.Percentage,
+		maxBodySize: cfg.MaxBodySize,
+		timeout:     timeout,
+		compare:     cfg.Compare,
+		logger:      log,
+		inFlight:    make(chan struct{}, cfg.MaxInFlight),
+		random:      rand.Float64,
+	}
+	if m.maxBodySize <= 0 {
+		m.maxBodySize = 1 << 20
+	}
+	if cfg.MaxInFlight <= 0 {
+		m.inFlight = make(chan struct{}, 100)
+	}
+	return m, nil
+}
+
+// primaryResult is what the primary request produced, for comparisons
+type primaryResult struct {
+	status int
+	body   []byte
+	// complete is false when the body was too large to keep
+	complete bool
+}
+
+// shadowCall is a copy of a request on its way to the shadow service
+type shadowCall struct {
+	primary chan primaryResult
+	// body copies the request body as the primary reads it, nil when
+	// there is none
+	body *mirroredBody
+}
+
+// finish hands the primary response over for comparison
+func (s *shadowCall) finish(status int, body []byte, complete bool) {
+	if s == nil {
+		return
+	}
+	if s.body != nil {
+		s.body.end()
+	}
+	// The channel has room for the only result, so this never blocks
+	s.primary <- primaryResult{status: status, body: body, complete: complete}
+}
+
+// start copies a sampled request to the shadow service, or returns nil
+func (m *mirror) start(c *gin.Context) *shadowCall {
+	if m == nil || m.random()*100 >= m.percentage {
+		return nil
+	}
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		mirrorRequests.WithLabelValues(m.service, m.shadowName, mirrorDropped).Inc()
+		return nil
+	}
+
+	// The copy outlives the primary request, so it doesn't share its context
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	target := upstreamURL(c)
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, target.String(), nil)
+	if err != nil {
+		cancel()
+		<-m.inFlight
+		m.logger.Error("Failed to create mirror request", "service", m.service, "error", err)
+		return nil
+	}
+	req.Header = c.Request.Header.Clone()
+	req.Header.Del("Connection")
+	req.Header.Set("X-Gateway-Service", m.service)
+	req.Header.Set("X-Gateway-Mirror", "true")
+	req.Header.Set("X-Forwarded-For", c.ClientIP())
+	if requestID, exists := c.Get("RequestID"); exists {
+		req.Header.Set("X-Request-ID", fmt.Sprintf("%v", requestID))
+	}
+
+	call := &shadowCall{primary: make(chan primaryResult, 1)}
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		call.body = &mirroredBody{ReadCloser: c.Request.Body, limit: m.maxBodySize, done: make(chan struct{})}
+		c.Request.Body = call.body
+	}
+	go func() {
+		defer func() { <-m.inFlight }()
+		defer cancel()
+		if call.body != nil {
+			if result := m.waitForBody(ctx, req, call.body); result != "" {
+				mirrorRequests.WithLabelValues(m.service, m.shadowName, result).Inc()
+				return
+			}
+		}
+		m.send(req, call)
+	}()
+	return call
+}
+
+// waitForBody gives the shadow request the body once the primary has read
+// it, returning the outcome of a copy that can't be sent
+func (m *mirror) waitForBody(ctx context.Context, req *http.Request, body *mirroredBody) string {
+	select {
+	case <-body.done:
+	case <-ctx.Done():
+		return mirrorDropped
+	}
+	data, result := body.contents()
+	if result != "" {
+		return result
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return ""
+}
+
+// send makes the shadow request and records how it went
+func (m *mirror) send(req *http.Request, call *shadowCall) {
+	result := m.exchange(req, call)
+	mirrorRequests.WithLabelValues(m.service, m.shadowName, result).Inc()
+}
+
+func (m *mirror) exchange(req *http.Request, call *shadowCall) string {
+	resp, err := m.shadow.RoundTripper().RoundTrip(req)
+	if err != nil {
+		m.logger.Debug("Mirror request failed", "service", m.service, "shadow", m.shadowName, "error", err)
+		return mirrorError
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, m.maxBodySize+1))
+	if err != nil {
+		m.logger.Debug("Mirror response failed", "service", m.service, "shadow", m.shadowName, "error", err)
+		return mirrorError
+	}
+	if !m.compare {
+		return mirrorSent
+	}
+
+	var primary primaryResult
+	select {
+	case primary = <-call.primary:
+	case <-req.Context().Done():
+		// The primary request hasn't finished within the mirror timeout
+		return mirrorSent
+	}
+
+	requestID := req.Header.Get("X-Request-ID")
+	if primary.status != resp.StatusCode {
+		m.logger.Info("Mirror response differs",
+			"service", m.service,
+			"shadow", m.shadowName,
+			"requestID", requestID,
+			"method", req.Method,
+			"path", req.URL.Path,
+			"primaryStatus", primary.status,
+			"shadowStatus", resp.StatusCode)
+		return mirrorStatusMismatch
+	}
+	if !primary.complete || int64(len(body)) > m.maxBodySize {
+		// Bodies over the limit are only compared by status
+		return mirrorMatch
+	}
+	if offset := firstDifference(primary.body, body); offset >= 0 {
+		m.logger.Info("Mirror response differs",
+			"service", m.service,
+			"shadow", m.shadowName,
+			"requestID", requestID,
+			"method", req.Method,
+			"path", req.URL.Path,
+			"status", resp.StatusCode,
+			"offset", offset,
+			"primaryBody", excerpt(primary.body, offset),
+			"shadowBody", excerpt(body, offset))
+		return mirrorBodyMismatch
+	}
+	return mirrorMatch
+}
+
+// firstDifference returns the offset of the first byte that differs, or -1
+// when the bodies are equal
+func firstDifference(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		return min(len(a), len(b))
+	}
+	return -1
+}
+
+// excerpt returns the part of a body around offset for logging
+func excerpt(body []byte, offset int) string {
+	start := max(offset-32, 0)
+	end := min(offset+32, len(body))
+	if start > end {
+		return ""
+	}
+	return string(body[start:end])
+}
+
+// mirroredBody keeps a copy of the request body as the primary reads it,
+// up to limit bytes
+type mirroredBody struct {
+	io.ReadCloser
+	limit int64
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	tooLarge bool
+	// incomplete is set when the primary finished without reading the
+	// whole body
+	incomplete bool
+	ended      bool
+	// done is closed once the copy is complete or abandoned
+	done chan struct{}
+}
+
+func (b *mirroredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ended {
+		return n, err
+	}
+	if int64(b.buf.Len()+n) > b.limit {
+		b.tooLarge = true
+		b.buf = bytes.Buffer{}
+		b.finish()
+		return n, err
+	}
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+// end abandons a copy the primary didn't read to the end
+func (b *mirroredBody) end() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.ended {
+		b.incomplete = true
+		b.finish()
+	}
+}
+
+func (b *mirroredBody) finish() {
+	b.ended = true
+	close(b.done)
+}
+
+// contents returns the copied body, or the outcome of a copy that failed
+func (b *mirroredBody) contents() ([]byte, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.tooLarge:
+		return nil, mirrorTooLarge
+	case b.incomplete:
+		return nil, mirrorDropped
+	}
+	return b.buf.Bytes(), ""
+}
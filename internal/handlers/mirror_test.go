@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/server"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+type mirroredRequest struct {
+	path   string
+	body   string
+	header http.Header
+}
+
+// newMirrorServer routes /v1 to a primary echoing request bodies, mirrored
+// to shadow
+func newMirrorServer(t *testing.T, name string, mirror config.MirrorConfig, shadow http.HandlerFunc) http.Handler {
+	t.Helper()
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	t.Cleanup(primary.Close)
+	shadowServer := httptest.NewServer(shadow)
+	t.Cleanup(shadowServer.Close)
+
+	mirror.Service = name + "-shadow"
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			name:             {URL: primary.URL, Mirror: mirror},
+			name + "-shadow": {URL: shadowServer.URL},
+		},
+		Routes: []config.RouteConfig{{Path: "/v1", Service: name}},
+	}
+	return newTestServer(t, cfg)
+}
+
+// mirrorCount reads the mirror counter of a service from the metrics
+func mirrorCount(srv http.Handler, service, result string) bool {
+	w := serve(srv, httptest.NewRequest("GET", "/metrics", nil))
+	return strings.Contains(w.Body.String(),
+		`api_gateway_mirror_requests_total{result="`+result+`",service="`+service+`",shadow="`+service+`-shadow"} 1`)
+}
+
+func TestMirror_CopiesRequests(t *testing.T) {
+	received := make(chan mirroredRequest, 1)
+	srv := newMirrorServer(t, "orders", config.MirrorConfig{Percentage: 100}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- mirroredRequest{path: r.URL.RequestURI(), body: string(body), header: r.Header}
+	})
+
+	req := httptest.NewRequest("POST", "/v1/orders?dry=1", bytes.NewBufferString(`{"item":42}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := serve(srv, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"item":42}`, w.Body.String())
+
+	select {
+	case mirrored := <-received:
+		assert.Equal(t, "/v1/orders?dry=1", mirrored.path)
+		assert.Equal(t, `{"item":42}`, mirrored.body)
+		assert.Equal(t, "true", mirrored.header.Get("X-Gateway-Mirror"))
+		assert.Equal(t, "orders", mirrored.header.Get("X-Gateway-Service"))
+		assert.Equal(t, "application/json", mirrored.header.Get("Content-Type"))
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow service didn't receive the request")
+	}
+	assert.Eventually(t, func() bool { return mirrorCount(srv, "orders", mirrorSent) }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestMirror_IgnoresShadow(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv := newMirrorServer(t, "payments", config.MirrorConfig{Percentage: 100, Timeout: "5s"}, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	start := time.Now()
+	w := serve(srv, httptest.NewRequest("POST", "/v1/charge", bytes.NewBufferString("10")))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Body.String())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestMirror_SkipsLargeBodies(t *testing.T) {
+	received := make(chan mirroredRequest, 1)
+	srv := newMirrorServer(t, "uploads", config.MirrorConfig{Percentage: 100, MaxBodySize: 4}, func(w http.ResponseWriter, r *http.Request) {
+		received <- mirroredRequest{path: r.URL.Path}
+	})
+
+	w := serve(srv, httptest.NewRequest("POST", "/v1/files", bytes.NewBufferString("0123456789")))
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Eventually(t, func() bool { return mirrorCount(srv, "uploads", mirrorTooLarge) }, 2*time.Second, 10*time.Millisecond)
+	assert.Empty(t, received)
+}
+
+func TestMirror_StreamsBodyToPrimary(t *testing.T) {
+	started := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer primary.Close()
+	received := make(chan string, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer shadow.Close()
+
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"uploads":        {URL: primary.URL, Mirror: config.MirrorConfig{Service: "uploads-shadow", Percentage: 100}},
+			"uploads-shadow": {URL: shadow.URL},
+		},
+		Routes: []config.RouteConfig{{Path: "/v1", Service: "uploads"}},
+	}
+	srv := newTestServer(t, cfg)
+
+	// The primary request starts before the client has sent the whole body
+	body, writer := io.Pipe()
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve(srv, httptest.NewRequest("POST", "/v1/files", body)) }()
+	writer.Write([]byte("first "))
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("primary request waited for the mirror")
+	}
+	writer.Write([]byte("second"))
+	writer.Close()
+
+	assert.Equal(t, "first second", (<-done).Body.String())
+	select {
+	case mirrored := <-received:
+		assert.Equal(t, "first second", mirrored)
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow service didn't receive the request")
+	}
+}
+
+func TestMirror_ComparesResponses(t *testing.T) {
+	srv := newMirrorServer(t, "search", config.MirrorConfig{Percentage: 100, Compare: true}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "same" {
+			w.Write(body)
+			return
+		}
+		w.Write([]byte("different"))
+	})
+
+	serve(srv, httptest.NewRequest("POST", "/v1/query", bytes.NewBufferString("same")))
+	assert.Eventually(t, func() bool { return mirrorCount(srv, "search", mirrorMatch) }, 2*time.Second, 10*time.Millisecond)
+
+	serve(srv, httptest.NewRequest("POST", "/v1/query", bytes.NewBufferString("other")))
+	assert.Eventually(t, func() bool { return mirrorCount(srv, "search", mirrorBodyMismatch) }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestMirror_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		mirror config.MirrorConfig
+	}{
+		{"itself", config.MirrorConfig{Service: "catalog", Percentage: 10}},
+		{"unknown service", config.MirrorConfig{Service: "missing", Percentage: 10}},
+		{"percentage", config.MirrorConfig{Service: "catalog-v2", Percentage: 150}},
+		{"timeout", config.MirrorConfig{Service: "catalog-v2", Percentage: 10, Timeout: "soon"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				CORS: config.CORSConfig{AllowedOrigins: []string{"*"}},
+				Services: map[string]config.ServiceConfig{
+					"catalog":    {URL: "http://localhost:8081", Mirror: tt.mirror},
+					"catalog-v2": {URL: "http://localhost:8082"},
+				},
+				Routes: []config.RouteConfig{{Path: "/v1", Service: "catalog"}},
+			}
+			err := RegisterRoutes(server.New(cfg, logger.New("error")), cfg)
+			require.Error(t, err)
+		})
+	}
+}
@@ -2,136 +2,130 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
 
 	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
 	"github.com/zahidhasann88/api-gateway/pkg/logger"
 )
 
 type ProxyHandler struct {
 	config    *config.Config
 	logger    logger.Logger
-	limiters  map[string]*rate.Limiter
-	transport http.RoundTripper
-}
-
-func NewProxyHandler(cfg *config.Config, log logger.Logger) *ProxyHandler {
-	limiters := make(map[string]*rate.Limiter)
+	upstreams *upstream.Registry
 
-	// Initialize rate limiters for each service
-	for serviceName, serviceConfig := range cfg.Services {
-		limiter := rate.NewLimiter(rate.Limit(serviceConfig.RateLimit), serviceConfig.RateLimit)
-		limiters[serviceName] = limiter
-	}
+	// mirrors holds the mirror of every service, shared by its routes
+	mirrors map[string]*mirror
+}
 
-	transport := &http.Transport{
-		MaxIdleConns:        100,
-		IdleConnTimeout:     90 * time.Second,
-		TLSHandshakeTimeout: 10 * time.Second,
-	}
+// ginContextKey carries the gin context of a request into the reverse proxy
+type ginContextKey struct{}
 
+func NewProxyHandler(cfg *config.Config, log logger.Logger, upstreams *upstream.Registry) *ProxyHandler {
 	return &ProxyHandler{
 		config:    cfg,
 		logger:    log,
-		limiters:  limiters,
-		transport: transport,
+		upstreams: upstreams,
+		mirrors:   make(map[string]*mirror),
+	}
+}
+
+// mirrorFor returns the mirror of a service, nil when it isn't mirrored
+func (h *ProxyHandler) mirrorFor(serviceName string) (*mirror, error) {
+	if m, exists := h.mirrors[serviceName]; exists {
+		return m, nil
 	}
+	m, err := newMirror(serviceName, h.config.Services[serviceName].Mirror, h.upstreams, h.logger)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", serviceName, err)
+	}
+	h.mirrors[serviceName] = m
+	return m, nil
 }
 
 func (h *ProxyHandler) ProxyRequest(serviceName string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		serviceConfig, exists := h.config.Services[serviceName]
-		if !exists {
+	service, exists := h.upstreams.Service(serviceName)
+	if !exists {
+		return func(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
-			return
 		}
+	}
 
-		// Check rate limiting
-		limiter := h.limiters[serviceName]
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
-			return
-		}
+	// Create the reverse proxy once per route, the service transport picks
+	// the instance and reuses its pooled connections
+	proxy := &httputil.ReverseProxy{Transport: service.RoundTripper()}
 
-		// Parse the target URL
-		targetURL, err := url.Parse(serviceConfig.URL)
-		if err != nil {
-			h.logger.Error("Failed to parse service URL",
-				"service", serviceName,
-				"url", serviceConfig.URL,
-				"error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid service configuration"})
-			return
-		}
+	// Set director to modify the request
+	proxy.Director = func(req *http.Request) {
+		c := req.Context().Value(ginContextKey{}).(*gin.Context)
 
-		// Create the reverse proxy
-		proxy := httputil.NewSingleHostReverseProxy(targetURL)
-
-		// Set custom transport with timeout
-		proxy.Transport = &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			DisableKeepAlives:     false,
-			ResponseHeaderTimeout: time.Duration(serviceConfig.Timeout) * time.Second,
+		// Don't let net/http add its default User-Agent
+		if _, ok := req.Header["User-Agent"]; !ok {
+			req.Header.Set("User-Agent", "")
 		}
 
-		// Set director to modify the request
-		originalDirector := proxy.Director
-		proxy.Director = func(req *http.Request) {
-			originalDirector(req)
-
-			// Copy the request ID
-			if requestID, exists := c.Get("RequestID"); exists {
-				req.Header.Set("X-Request-ID", fmt.Sprintf("%v", requestID))
-			}
-
-			// Forward the original path
-			req.URL.Path = c.Request.URL.Path
-			if c.Request.URL.RawQuery != "" {
-				req.URL.RawQuery = c.Request.URL.RawQuery
-			}
-
-			// Add gateway headers
-			req.Header.Set("X-Gateway-Service", serviceName)
-			req.Header.Set("X-Forwarded-For", c.ClientIP())
-
-			h.logger.Debug("Proxying request",
-				"service", serviceName,
-				"method", req.Method,
-				"path", req.URL.Path)
+		// Copy the request ID
+		if requestID, exists := c.Get("RequestID"); exists {
+			req.Header.Set("X-Request-ID", fmt.Sprintf("%v", requestID))
 		}
 
-		// Modify the response
-		proxy.ModifyResponse = func(resp *http.Response) error {
-			// Add response headers
-			resp.Header.Set("X-Gateway-Service", serviceName)
+		// Forward the original path, or the route's rewrite of it
+		target := upstreamURL(c)
+		req.URL.Path = target.Path
+		req.URL.RawPath = ""
+		req.URL.RawQuery = target.RawQuery
 
-			// Log response status
-			h.logger.Debug("Received response",
-				"service", serviceName,
-				"status", resp.StatusCode)
+		// Add gateway headers
+		req.Header.Set("X-Gateway-Service", serviceName)
+		req.Header.Set("X-Forwarded-For", c.ClientIP())
 
-			return nil
-		}
+		h.logger.Debug("Proxying request",
+			"service", serviceName,
+			"method", req.Method,
+			"path", req.URL.Path)
+	}
+
+	// Modify the response
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		// Add response headers
+		resp.Header.Set("X-Gateway-Service", serviceName)
+
+		// Log response status
+		h.logger.Debug("Received response",
+			"service", serviceName,
+			"status", resp.StatusCode)
 
-		// Handle errors
-		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			h.logger.Error("Proxy error",
-				"service", serviceName,
-				"error", err)
+		return nil
+	}
+
+	// Handle errors
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		h.logger.Error("Proxy error",
+			"service", serviceName,
+			"error", err)
+
+		respondUpstreamError(r.Context().Value(ginContextKey{}).(*gin.Context), err)
+	}
 
-			c.JSON(http.StatusBadGateway, gin.H{
-				"error": "Service unavailable",
-			})
+	// gRPC streams can run indefinitely, so they aren't captured
+	capture := service.Protocol() != upstream.ProtocolGRPC
+
+	// Mirror configuration errors are reported when routes are built
+	mirror, err := h.mirrorFor(serviceName)
+	if err != nil {
+		h.logger.Error("Mirroring disabled", "service", serviceName, "error", err)
+	}
+
+	return func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), ginContextKey{}, c)
+		if !capture {
+			proxy.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+			return
 		}
 
 		// Save the original response writer
@@ -145,8 +139,16 @@ func (h *ProxyHandler) ProxyRequest(serviceName string) gin.HandlerFunc {
 
 		c.Writer = responseRecorder
 
+		// Copy the request to the shadow service as the primary consumes
+		// the body
+		shadow := mirror.start(c)
+
 		// Serve the request through proxy
-		proxy.ServeHTTP(c.Writer, c.Request)
+		proxy.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+		if shadow != nil {
+			body := responseRecorder.Body.Bytes()
+			shadow.finish(responseRecorder.Status(), body, int64(len(body)) <= mirror.maxBodySize)
+		}
 
 		// Restore the original writer
 		c.Writer = originalWriter
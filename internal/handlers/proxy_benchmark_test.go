@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// BenchmarkProxyHandler compares the shared connection pool with building a
+// transport for every request, reporting the upstream connections opened
+// per request as conns/op
+func BenchmarkProxyHandler(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+
+	var conns int64
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{
+		"bench": {URL: backend.URL, Timeout: 5},
+	}}
+	log := logger.New("error")
+	upstreams, err := upstream.NewRegistry(cfg, log)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer upstreams.Close()
+	service, _ := upstreams.Service("bench")
+
+	// perRequest is how requests were proxied before services had a pool
+	perRequest := func(c *gin.Context) {
+		transport := &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 5 * time.Second,
+		}
+		defer transport.CloseIdleConnections()
+		proxy := &httputil.ReverseProxy{
+			Transport: service.Transport(transport),
+			Director:  func(req *http.Request) {},
+		}
+		proxy.ServeHTTP(c.Writer, c.Request)
+	}
+
+	for name, handler := range map[string]gin.HandlerFunc{
+		"SharedPool": NewProxyHandler(cfg, log, upstreams).ProxyRequest("bench"),
+		"PerRequest": perRequest,
+	} {
+		b.Run(name, func(b *testing.B) {
+			router := gin.New()
+			router.GET("/bench/*path", handler)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req := httptest.NewRequest("GET", "/bench/items", nil).WithContext(ctx)
+
+			atomic.StoreInt64(&conns, 0)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					b.Fatalf("unexpected status %d", w.Code)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&conns))/float64(b.N), "conns/op")
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+    "context"
     "net/http"
     "net/http/httptest"
     "testing"
@@ -9,6 +10,7 @@ import (
     "github.com/stretchr/testify/assert"
     
     "github.com/zahidhasann88/api-gateway/internal/config"
+    "github.com/zahidhasann88/api-gateway/internal/upstream"
     "github.com/zahidhasann88/api-gateway/pkg/logger"
 )
 
@@ -39,7 +41,9 @@ func TestProxyHandler_ProxyRequest(t *testing.T) {
     log := logger.New("debug")
     
     // Create proxy handler
-    proxyHandler := NewProxyHandler(cfg, log)
+    upstreams, err := upstream.NewRegistry(cfg, log)
+    assert.NoError(t, err)
+    proxyHandler := NewProxyHandler(cfg, log, upstreams)
     
     // Create test router
     router := gin.New()
@@ -50,7 +54,10 @@ func TestProxyHandler_ProxyRequest(t *testing.T) {
     router.GET("/test/*path", proxyHandler.ProxyRequest("test-service"))
     
     // Create test request
-    req := httptest.NewRequest("GET", "/test/hello", nil)
+    // Requests served by net/http always carry a cancellable context
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    req := httptest.NewRequest("GET", "/test/hello", nil).WithContext(ctx)
     w := httptest.NewRecorder()
     
     // Execute request
@@ -59,4 +66,102 @@ func TestProxyHandler_ProxyRequest(t *testing.T) {
     // Verify response
     assert.Equal(t, http.StatusOK, w.Code)
     assert.Contains(t, w.Body.String(), "Hello from target service")
-}
\ No newline at end of file
+}
+
+func TestProxyHandler_BalancesAcrossTargets(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    hits := map[string]int{}
+    newBackend := func(name string) *httptest.Server {
+        return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            hits[name]++
+            w.WriteHeader(http.StatusOK)
+        }))
+    }
+    first, second := newBackend("first"), newBackend("second")
+    defer first.Close()
+    defer second.Close()
+
+    cfg := &config.Config{
+        Services: map[string]config.ServiceConfig{
+            "test-service": {
+                Targets: []config.TargetConfig{
+                    {URL: first.URL, Weight: 1},
+                    {URL: second.URL, Weight: 1},
+                },
+                LoadBalancer: config.LoadBalancerConfig{Strategy: "round-robin"},
+                Timeout:      5,
+                RateLimit:    10,
+            },
+        },
+    }
+
+    log := logger.New("error")
+    upstreams, err := upstream.NewRegistry(cfg, log)
+    assert.NoError(t, err)
+    proxyHandler := NewProxyHandler(cfg, log, upstreams)
+
+    router := gin.New()
+    router.GET("/test/*path", proxyHandler.ProxyRequest("test-service"))
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    for i := 0; i < 4; i++ {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest("GET", "/test/hello", nil).WithContext(ctx))
+        assert.Equal(t, http.StatusOK, w.Code)
+    }
+
+    assert.Equal(t, 2, hits["first"])
+    assert.Equal(t, 2, hits["second"])
+}
+
+func TestProxyHandler_CircuitBreakerOpens(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    calls := 0
+    targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls++
+        w.WriteHeader(http.StatusInternalServerError)
+    }))
+    defer targetServer.Close()
+
+    cfg := &config.Config{
+        Services: map[string]config.ServiceConfig{
+            "test-service": {
+                URL:       targetServer.URL,
+                Timeout:   5,
+                RateLimit: 10,
+                CircuitBreaker: config.CircuitBreakerConfig{
+                    Enabled:          true,
+                    FailureThreshold: 2,
+                    ResetTimeout:     "1m",
+                },
+            },
+        },
+    }
+
+    log := logger.New("error")
+    upstreams, err := upstream.NewRegistry(cfg, log)
+    assert.NoError(t, err)
+    proxyHandler := NewProxyHandler(cfg, log, upstreams)
+
+    router := gin.New()
+    router.GET("/test/*path", proxyHandler.ProxyRequest("test-service"))
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    do := func() *httptest.ResponseRecorder {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest("GET", "/test/hello", nil).WithContext(ctx))
+        return w
+    }
+
+    assert.Equal(t, http.StatusInternalServerError, do().Code)
+    assert.Equal(t, http.StatusInternalServerError, do().Code)
+
+    w := do()
+    assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+    assert.Equal(t, "60", w.Header().Get("Retry-After"))
+    assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+// upstreamURLKey is the context key holding the rewritten upstream URL
+const upstreamURLKey = "upstreamURL"
+
+// templateParam matches the {name} references of rewrite templates
+var templateParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// urlRewriter applies the rewrite rules of a route
+type urlRewriter struct {
+	path        string
+	stripPrefix string
+	regex       *regexp.Regexp
+	replacement string
+	addPrefix   string
+	addQuery    []config.QueryParam
+	removeQuery []string
+}
+
+// newURLRewriter compiles the rewrite rules of a route, checking that
+// templates only use parameters of the route pattern
+func newURLRewriter(cfg *config.RewriteConfig, pattern string) (*urlRewriter, error) {
+	params := make(map[string]bool)
+	for _, segment := range strings.Split(pattern, "/") {
+		if len(segment) > 1 && (segment[0] == ':' || segment[0] == '*') {
+			params[segment[1:]] = true
+		}
+	}
+	checkTemplate := func(template string) error {
+		for _, match := range templateParam.FindAllStringSubmatch(template, -1) {
+			if !params[match[1]] {
+				return fmt.Errorf("unknown route parameter {%s}", match[1])
+			}
+		}
+		return nil
+	}
+
+	r := &urlRewriter{
+		path:        cfg.Path,
+		stripPrefix: cfg.StripPrefix,
+		replacement: cfg.Replacement,
+		addPrefix:   strings.TrimSuffix(cfg.AddPrefix, "/"),
+		addQuery:    cfg.AddQuery,
+		removeQuery: cfg.RemoveQuery,
+	}
+	if err := checkTemplate(cfg.Path); err != nil {
+		return nil, err
+	}
+	if cfg.Regex != "" {
+		regex, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite regex: %w", err)
+		}
+		r.regex = regex
+	}
+	for _, param := range cfg.AddQuery {
+		if param.Name == "" {
+			return nil, fmt.Errorf("query parameter without a name")
+		}
+		if err := checkTemplate(param.Value); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// rewrite returns the upstream path and query for a request
+func (r *urlRewriter) rewrite(c *gin.Context) *url.URL {
+	expand := func(template string) string {
+		return templateParam.ReplaceAllStringFunc(template, func(param string) string {
+			return c.Param(param[1 : len(param)-1])
+		})
+	}
+
+	path := c.Request.URL.Path
+	if r.path != "" {
+		path = expand(r.path)
+	}
+	if r.stripPrefix != "" {
+		path = strings.TrimPrefix(path, r.stripPrefix)
+	}
+	if r.regex != nil {
+		path = r.regex.ReplaceAllString(path, r.replacement)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if r.addPrefix != "" {
+		if path == "/" {
+			path = r.addPrefix
+		} else {
+			path = r.addPrefix + path
+		}
+	}
+
+	query := c.Request.URL.RawQuery
+	if len(r.addQuery) > 0 || len(r.removeQuery) > 0 {
+		values := c.Request.URL.Query()
+		for _, name := range r.removeQuery {
+			values.Del(name)
+		}
+		for _, param := range r.addQuery {
+			values.Set(param.Name, expand(param.Value))
+		}
+		query = values.Encode()
+	}
+
+	return &url.URL{Path: path, RawQuery: query}
+}
+
+// handler records the rewritten URL for the route's protocol handler
+func (r *urlRewriter) handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(upstreamURLKey, r.rewrite(c))
+		c.Next()
+	}
+}
+
+// rewrittenURL returns the upstream URL a route's rewrite rules produced
+func rewrittenURL(c *gin.Context) (*url.URL, bool) {
+	value, exists := c.Get(upstreamURLKey)
+	if !exists {
+		return nil, false
+	}
+	return value.(*url.URL), true
+}
+
+// upstreamURL returns the path and query to request from the upstream,
+// the request's own unless the route rewrites them
+func upstreamURL(c *gin.Context) *url.URL {
+	if rewritten, ok := rewrittenURL(c); ok {
+		return rewritten
+	}
+	return &url.URL{Path: c.Request.URL.Path, RawQuery: c.Request.URL.RawQuery}
+}
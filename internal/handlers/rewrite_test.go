@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/server"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// urlEchoBackend answers with the URL it was asked for, over HTTP and
+// WebSocket
+func urlEchoBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			require.NoError(t, err)
+			defer conn.Close()
+			conn.WriteMessage(websocket.TextMessage, []byte(r.URL.RequestURI()))
+			conn.ReadMessage()
+			return
+		}
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func TestRewrite_REST(t *testing.T) {
+	backend := urlEchoBackend(t)
+	srv := newTestServer(t, &config.Config{
+		Services: map[string]config.ServiceConfig{"users": {URL: backend.URL}},
+		Routes: []config.RouteConfig{
+			{
+				Path: "/api/users", Service: "users",
+				Rewrite: &config.RewriteConfig{
+					StripPrefix: "/api/users",
+					AddPrefix:   "/v2",
+					AddQuery:    []config.QueryParam{{Name: "source", Value: "gateway"}},
+					RemoveQuery: []string{"debug"},
+				},
+			},
+			{
+				Path: "/api/accounts/:id", Service: "users",
+				Rewrite: &config.RewriteConfig{Path: "/users/{id}{path}"},
+			},
+			{
+				Path: "/api/legacy", Service: "users",
+				Rewrite: &config.RewriteConfig{Regex: `^/api/legacy/(\w+)/(\d+)$`, Replacement: "/$1?id=$2"},
+			},
+		},
+	})
+
+	get := func(target string) string {
+		return serve(srv, httptest.NewRequest("GET", target, nil)).Body.String()
+	}
+	assert.Equal(t, "/v2/1?page=2&source=gateway", get("/api/users/1?page=2&debug=true"))
+	assert.Equal(t, "/v2?source=gateway", get("/api/users/"))
+	assert.Equal(t, "/users/42/settings?tab=a", get("/api/accounts/42/settings?tab=a"))
+	assert.Equal(t, "/orders%3Fid=7", get("/api/legacy/orders/7"), "regex rewrites only change the path")
+}
+
+func TestRewrite_GraphQLAndWebSocket(t *testing.T) {
+	backend := urlEchoBackend(t)
+	srv := httptest.NewServer(newTestServer(t, &config.Config{
+		Services: map[string]config.ServiceConfig{"users": {URL: backend.URL, Timeout: 5}},
+		Routes: []config.RouteConfig{
+			{Path: "/graphql/users", Service: "users", Protocol: ProtocolGraphQL},
+			{
+				Path: "/graphql/accounts", Service: "users", Protocol: ProtocolGraphQL,
+				Rewrite: &config.RewriteConfig{Path: "/api/query"},
+			},
+			{
+				Path: "/ws/users", Service: "users", Protocol: ProtocolWebSocket,
+				Rewrite: &config.RewriteConfig{StripPrefix: "/ws/users", AddPrefix: "/events"},
+			},
+		},
+	}))
+	defer srv.Close()
+
+	post := func(path string) string {
+		resp, err := http.Post(srv.URL+path, "application/json", bytes.NewBufferString(`{"query":"{ me }"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	assert.Equal(t, "/graphql", post("/graphql/users"))
+	assert.Equal(t, "/api/query", post("/graphql/accounts"))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/users/live?room=1", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, message, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "/events/live?room=1", string(message))
+}
+
+func TestRewrite_Invalid(t *testing.T) {
+	services := map[string]config.ServiceConfig{
+		"users": {URL: "http://users"},
+		"shop":  {URL: "http://shop", Protocol: "grpc", DescriptorSet: shopDescriptorSet},
+	}
+	for name, route := range map[string]config.RouteConfig{
+		"unknown parameter": {Path: "/api/users", Service: "users", Rewrite: &config.RewriteConfig{Path: "/users/{id}"}},
+		"invalid regex":     {Path: "/api/users", Service: "users", Rewrite: &config.RewriteConfig{Regex: "("}},
+		"unnamed query":     {Path: "/api/users", Service: "users", Rewrite: &config.RewriteConfig{AddQuery: []config.QueryParam{{Value: "x"}}}},
+		"grpc-json":         {Path: "/shop", Service: "shop", Protocol: ProtocolGRPCJSON, Rewrite: &config.RewriteConfig{StripPrefix: "/shop"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{
+				CORS:     config.CORSConfig{AllowedOrigins: []string{"*"}},
+				Services: services,
+				Routes:   []config.RouteConfig{route},
+			}
+			assert.Error(t, RegisterRoutes(server.New(cfg, logger.New("error")), cfg))
+		})
+	}
+}
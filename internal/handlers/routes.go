@@ -1,132 +1,575 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"github.com/zahidhasann88/api-gateway/internal/config"
 	"github.com/zahidhasann88/api-gateway/internal/middleware"
 	"github.com/zahidhasann88/api-gateway/internal/server"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
+	"github.com/zahidhasann88/api-gateway/pkg/apikeys"
+	"github.com/zahidhasann88/api-gateway/pkg/cache"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+	"github.com/zahidhasann88/api-gateway/pkg/ratelimit"
+	"github.com/zahidhasann88/api-gateway/pkg/revocation"
 )
 
-// handleLogin handles authentication requests
-func handleLogin(cfg *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Authentication logic - this is a placeholder
-		// In a real implementation, you would validate credentials and generate a token
-		var loginRequest struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
-		}
-
-		if err := c.ShouldBindJSON(&loginRequest); err != nil {
-			c.JSON(400, gin.H{"error": "Invalid request"})
-			return
-		}
-
-		// Simple validation (would be more comprehensive in production)
-		if loginRequest.Username == "" || loginRequest.Password == "" {
-			c.JSON(400, gin.H{"error": "Username and password required"})
-			return
-		}
+// Protocols a route can proxy
+const (
+	ProtocolREST      = "rest"
+	ProtocolGraphQL   = "graphql"
+	ProtocolWebSocket = "websocket"
+	ProtocolGRPC      = "grpc"
+	ProtocolGRPCJSON  = "grpc-json"
+	ProtocolGRPCWeb   = "grpc-web"
+)
 
-		// Generate JWT token (simplified)
-		token, err := middleware.GenerateToken(loginRequest.Username, []string{"user"}, cfg)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to generate token"})
-			return
-		}
+func RegisterRoutes(srv *server.Server, cfg *config.Config) error {
+	// Create the upstream pools shared by all handlers
+	upstreams, err := upstream.NewRegistry(cfg, srv.Logger())
+	if err != nil {
+		return err
+	}
 
-		c.JSON(200, gin.H{
-			"token": token,
-			"user":  loginRequest.Username,
-		})
+	// Tokens are verified with the configured secrets and key sets
+	verifier, err := middleware.NewTokenVerifier(cfg.Auth, srv.Logger())
+	if err != nil {
+		return fmt.Errorf("auth: %w", err)
 	}
-}
 
-func RegisterRoutes(srv *server.Server, cfg *config.Config) {
+	// Probe upstream targets and refresh remote keys until the server shuts
+	// down
+	background, stopBackground := context.WithCancel(context.Background())
+	upstreams.StartHealthChecks(background)
+	verifier.Start(background)
+	srv.OnShutdown(stopBackground)
+	srv.OnShutdown(upstreams.Close)
+
 	// Create handlers
-	proxyHandler := NewProxyHandler(cfg, srv.Logger())
-	graphqlHandler := NewGraphQLHandler(cfg, srv.Logger())
-	wsHandler := NewWebSocketHandler(cfg, srv.Logger())
+	builder := newRouteBuilder(cfg, srv.Logger(), upstreams)
+	builder.handler = srv
+	builder.verifier = verifier
+
+	// Tokens revoked by logouts and reused refresh tokens are rejected
+	denylist, err := builder.denylist()
+	if err != nil {
+		return err
+	}
+	verifier.UseDenylist(denylist)
 
 	// Register global middleware
 	srv.Use(middleware.RequestID())
 	srv.Use(middleware.Logger(srv.Logger()))
+	if cfg.Compression.Enabled {
+		compress, err := middleware.Compress(cfg.Compression)
+		if err != nil {
+			return fmt.Errorf("compression: %w", err)
+		}
+		srv.Use(compress)
+	}
 	srv.Use(middleware.Recovery(srv.Logger()))
 	srv.Use(middleware.CORS(cfg.CORS))
 	srv.Use(middleware.Metrics())
-	srv.Use(middleware.TransformationMiddleware(cfg, srv.Logger()))
 
-	// Healthcheck endpoint
-	srv.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	// Healthcheck endpoints
+	healthHandler := NewHealthHandler(upstreams)
+	srv.GET("/health", healthHandler.Ready)
+	srv.GET("/health/live", healthHandler.Live)
+	srv.GET("/health/ready", healthHandler.Ready)
 
 	// Metrics endpoint
 	srv.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// Authentication endpoints
-	auth := srv.Group("/auth")
-	{
-		auth.POST("/login", handleLogin(cfg))
-	}
-
-	// API routes
-	api := srv.Group("/api")
-	api.Use(middleware.JWTAuthMiddleware(cfg))
-
-	// Create separate GraphQL and WebSocket routes to avoid conflicts with wildcards
-
-	// GraphQL endpoints
-	graphql := api.Group("/graphql")
-	{
-		graphql.POST("/users", graphqlHandler.HandleRequest("users"))
-		graphql.POST("/payments", graphqlHandler.HandleRequest("payments"))
-		graphql.POST("/orders", graphqlHandler.HandleRequest("orders"))
-		// General purpose GraphQL endpoint for service aggregation
-		graphql.POST("", func(c *gin.Context) {
-			// Implementation would depend on your GraphQL schema aggregation strategy
-			c.JSON(501, gin.H{"error": "Not implemented"})
+	if cfg.Auth.Enabled && cfg.Auth.Users.Backend == "" {
+		return errors.New("auth.users.backend is required: set htpasswd, sql or ldap to check the credentials of /auth/login, or none to disable logins")
+	}
+	userStore, err := newUserStore(cfg.Auth.Users)
+	if err != nil {
+		return fmt.Errorf("user store: %w", err)
+	}
+	if closer, ok := userStore.(io.Closer); ok {
+		srv.OnShutdown(func() { closer.Close() })
+	}
+	if userStore != nil && cfg.Auth.JWTSecret == "" {
+		return errors.New("auth.jwtSecret is required to sign the tokens of /auth/login")
+	}
+	if userStore != nil || cfg.Auth.Enabled {
+		sessions, err := middleware.NewSessionManager(cfg.Auth, denylist)
+		if err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+		authHandler := NewAuthHandler(userStore, sessions, verifier, srv.Logger())
+		auth := srv.Group("/auth")
+		{
+			if userStore != nil {
+				auth.POST("/login", authHandler.Login)
+				auth.POST("/refresh", authHandler.Refresh)
+			}
+			auth.POST("/logout", authHandler.Logout)
+		}
+	}
+
+	// Admin endpoints need a token with the admin role, so they are only
+	// served when authentication is enabled
+	if cfg.Auth.Enabled {
+		store, err := builder.cacheStore()
+		if err != nil {
+			return err
+		}
+		versions := NewVersionsHandler(upstreams)
+		purge := NewCacheHandler(store, srv.Logger())
+		admin := srv.Group("/admin", middleware.JWTAuthMiddleware(cfg, verifier), middleware.RequireRole("admin"))
+		{
+			admin.GET("/services/:service/versions", versions.Get)
+			admin.PUT("/services/:service/versions", versions.Update)
+			admin.POST("/cache/purge", purge.Purge)
+		}
+		if cfg.Auth.APIKeys.Enabled {
+			keys, err := builder.apiKeyManager()
+			if err != nil {
+				return err
+			}
+			apiKeys := NewAPIKeysHandler(cfg, keys, srv.Logger())
+			admin.GET("/keys", apiKeys.List)
+			admin.POST("/keys", apiKeys.Create)
+			admin.POST("/keys/:id/rotate", apiKeys.Rotate)
+			admin.DELETE("/keys/:id", apiKeys.Revoke)
+		}
+	}
+
+	// General purpose GraphQL endpoint for service aggregation
+	srv.POST("/api/graphql", middleware.JWTAuthMiddleware(cfg, verifier), func(c *gin.Context) {
+		// Implementation would depend on your GraphQL schema aggregation strategy
+		c.JSON(501, gin.H{"error": "Not implemented"})
+	})
+
+	// Service routes from the configuration
+	var compiled []*compiledRoute
+	for _, route := range routesFor(cfg) {
+		c, err := builder.build(route)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, c)
+	}
+	registerRoutes(srv, compiled)
+
+	return nil
+}
+
+// routesFor returns the configured routes, or a REST route under
+// /api/{service} for every service when none are configured
+func routesFor(cfg *config.Config) []config.RouteConfig {
+	if len(cfg.Routes) > 0 {
+		return cfg.Routes
+	}
+
+	names := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	routes := make([]config.RouteConfig, 0, len(names))
+	for _, name := range names {
+		routes = append(routes, config.RouteConfig{
+			Path:    "/api/" + name,
+			Service: name,
+		})
+	}
+	return routes
+}
+
+// compiledRoute is a route ready to be registered on the router
+type compiledRoute struct {
+	methods  []string
+	pattern  string
+	handlers []gin.HandlerFunc
+	matcher  *routeMatcher
+	priority int
+}
+
+// routeMiddlewareFactory builds a named middleware for a route
+type routeMiddlewareFactory func(route config.RouteConfig) (gin.HandlerFunc, error)
+
+// routeBuilder compiles route configuration into handler chains
+type routeBuilder struct {
+	cfg        *config.Config
+	proxy      *ProxyHandler
+	graphql    *GraphQLHandler
+	ws         *WebSocketHandler
+	transcode  *TranscodingHandler
+	grpcWeb    *GRPCWebHandler
+	middleware map[string]routeMiddlewareFactory
+	upstreams  *upstream.Registry
+
+	logger logger.Logger
+
+	// limiters holds one rate limiter per service so that routes sharing a
+	// service share its quota
+	limiters map[string]ratelimit.Limiter
+	redis    *redis.Client
+
+	// cache holds the responses of every cached route, and handler serves
+	// their background revalidations
+	cache   cache.Store
+	handler http.Handler
+
+	// verifier checks the tokens of authenticated routes
+	verifier *middleware.TokenVerifier
+
+	// apiKeys checks the API keys of consumers
+	apiKeys *apikeys.Manager
+}
+
+func newRouteBuilder(cfg *config.Config, log logger.Logger, upstreams *upstream.Registry) *routeBuilder {
+	b := &routeBuilder{
+		cfg:       cfg,
+		proxy:     NewProxyHandler(cfg, log, upstreams),
+		graphql:   NewGraphQLHandler(cfg, log, upstreams),
+		ws:        NewWebSocketHandler(cfg, log, upstreams),
+		transcode: NewTranscodingHandler(cfg, log, upstreams),
+		grpcWeb:   NewGRPCWebHandler(cfg, log, upstreams),
+		upstreams: upstreams,
+		logger:    log,
+		limiters:  make(map[string]ratelimit.Limiter),
+	}
+
+	b.middleware = map[string]routeMiddlewareFactory{
+		"auth": func(route config.RouteConfig) (gin.HandlerFunc, error) {
+			auth := middleware.JWTAuthMiddleware(cfg, b.verifier)
+			if !cfg.Auth.APIKeys.Enabled {
+				return auth, nil
+			}
+			keys, err := b.apiKeyManager()
+			if err != nil {
+				return nil, err
+			}
+			return middleware.APIKeyAuth(route.Service, cfg, keys, auth), nil
+		},
+		"authorize": func(route config.RouteConfig) (gin.HandlerFunc, error) {
+			return middleware.AuthorizationMiddleware(route.Service, cfg), nil
+		},
+		"ratelimit": func(route config.RouteConfig) (gin.HandlerFunc, error) {
+			limiter, err := b.rateLimiter(route.Service)
+			if err != nil {
+				return nil, err
+			}
+			return middleware.RateLimit(route.Service, cfg, limiter)
+		},
+		"decompress": func(route config.RouteConfig) (gin.HandlerFunc, error) {
+			return middleware.DecompressRequest(cfg.Compression.MaxRequestSize), nil
+		},
+		"transform": func(route config.RouteConfig) (gin.HandlerFunc, error) {
+			return middleware.TransformationMiddleware(cfg, log), nil
+		},
+	}
+	return b
+}
+
+// rateLimiter returns the limiter shared by all routes of a service
+func (b *routeBuilder) rateLimiter(serviceName string) (ratelimit.Limiter, error) {
+	if limiter, exists := b.limiters[serviceName]; exists {
+		return limiter, nil
+	}
+
+	ttl, err := config.ParseDuration(b.cfg.Services[serviceName].RateLimiter.TTL, 10*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate limiter ttl: %w", err)
+	}
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter(ttl)
+
+	switch b.cfg.RateLimiting.Backend {
+	case "", "memory":
+	case "redis":
+		// Fall back to the local buckets while Redis is unreachable
+		cooldown, err := config.ParseDuration(b.cfg.RateLimiting.Cooldown, 5*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limiting cooldown: %w", err)
+		}
+		prefix := b.cfg.RateLimiting.Prefix
+		if prefix == "" {
+			prefix = "gateway:ratelimit:"
+		}
+		shared := ratelimit.NewRedisLimiter(b.redisClient(), prefix)
+		limiter = ratelimit.NewFallbackLimiter(shared, limiter, cooldown, b.logger)
+	default:
+		return nil, fmt.Errorf("unknown rate limiting backend %q", b.cfg.RateLimiting.Backend)
+	}
+
+	b.limiters[serviceName] = limiter
+	return limiter, nil
+}
+
+// redisClient returns the Redis client shared by the gateway's Redis backed
+// components
+func (b *routeBuilder) redisClient() *redis.Client {
+	if b.redis == nil {
+		b.redis = redis.NewClient(&redis.Options{
+			Addr:     b.cfg.Redis.Address,
+			Username: b.cfg.Redis.Username,
+			Password: b.cfg.Redis.Password,
+			DB:       b.cfg.Redis.DB,
 		})
 	}
+	return b.redis
+}
+
+// denylist returns the list of revoked tokens
+func (b *routeBuilder) denylist() (revocation.Denylist, error) {
+	switch b.cfg.Auth.Revocation.Backend {
+	case "", "memory":
+		return revocation.NewMemoryDenylist(), nil
+	case "redis":
+		prefix := b.cfg.Auth.Revocation.Prefix
+		if prefix == "" {
+			prefix = "gateway:revoked:"
+		}
+		return revocation.NewRedisDenylist(b.redisClient(), prefix), nil
+	default:
+		return nil, fmt.Errorf("unknown revocation backend %q", b.cfg.Auth.Revocation.Backend)
+	}
+}
+
+// apiKeyManager returns the manager of the consumers' API keys
+func (b *routeBuilder) apiKeyManager() (*apikeys.Manager, error) {
+	if b.apiKeys != nil {
+		return b.apiKeys, nil
+	}
+
+	names := make(map[string]bool)
+	for _, consumer := range b.cfg.Auth.APIKeys.Consumers {
+		if consumer.Name == "" || names[consumer.Name] {
+			return nil, fmt.Errorf("api key consumers need unique names, got %q", consumer.Name)
+		}
+		names[consumer.Name] = true
+	}
+
+	var store apikeys.Store
+	switch b.cfg.Auth.APIKeys.Backend {
+	case "", "memory":
+		store = apikeys.NewMemoryStore()
+	case "redis":
+		prefix := b.cfg.Auth.APIKeys.Prefix
+		if prefix == "" {
+			prefix = "gateway:apikeys:"
+		}
+		store = apikeys.NewRedisStore(b.redisClient(), prefix)
+	default:
+		return nil, fmt.Errorf("unknown api key backend %q", b.cfg.Auth.APIKeys.Backend)
+	}
+
+	b.apiKeys = apikeys.NewManager(store)
+	return b.apiKeys, nil
+}
+
+// cacheStore returns the response store shared by cached routes
+func (b *routeBuilder) cacheStore() (cache.Store, error) {
+	if b.cache != nil {
+		return b.cache, nil
+	}
+
+	switch b.cfg.Cache.Backend {
+	case "", "memory":
+		maxSize := b.cfg.Cache.MaxSize
+		if maxSize <= 0 {
+			maxSize = 64 << 20
+		}
+		b.cache = cache.NewMemoryStore(maxSize)
+	case "redis":
+		prefix := b.cfg.Cache.Prefix
+		if prefix == "" {
+			prefix = "gateway:cache:"
+		}
+		b.cache = cache.NewRedisStore(b.redisClient(), prefix)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", b.cfg.Cache.Backend)
+	}
+	return b.cache, nil
+}
+
+// build validates a route and compiles its handler chain
+func (b *routeBuilder) build(route config.RouteConfig) (*compiledRoute, error) {
+	if !strings.HasPrefix(route.Path, "/") {
+		return nil, fmt.Errorf("route %q: path must start with /", route.Path)
+	}
+	serviceConfig, exists := b.cfg.Services[route.Service]
+	if !exists {
+		return nil, fmt.Errorf("route %s: unknown service %q", route.Path, route.Service)
+	}
+
+	matcher, err := newRouteMatcher(route.Match)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", route.Path, err)
+	}
+
+	compiled := &compiledRoute{
+		handlers: []gin.HandlerFunc{middleware.Service(route.Service)},
+		matcher:  matcher,
+		priority: route.Priority,
+	}
 
-	// WebSocket endpoints
-	ws := api.Group("/ws")
-	{
-		ws.GET("/users/*path", wsHandler.ProxyWebSocket("users"))
-		ws.GET("/payments/*path", wsHandler.ProxyWebSocket("payments"))
-		ws.GET("/notifications/*path", wsHandler.ProxyWebSocket("notifications"))
+	names := route.Middleware
+	if names == nil {
+		names = defaultMiddleware(serviceConfig)
+	}
+	for _, name := range names {
+		factory, exists := b.middleware[name]
+		if !exists {
+			return nil, fmt.Errorf("route %s: unknown middleware %q", route.Path, name)
+		}
+		handler, err := factory(route)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: middleware %s: %w", route.Path, name, err)
+		}
+		compiled.handlers = append(compiled.handlers, handler)
 	}
 
-	// Service routes for standard REST APIs
+	// Split services pick a version once the middleware has identified the
+	// user
+	if b.upstreams != nil {
+		if service, exists := b.upstreams.Service(route.Service); exists && service.Versions() != nil {
+			compiled.handlers = append(compiled.handlers, selectVersion(service))
+		}
+	}
 
-	// Users service routes
-	users := api.Group("/users")
-	users.Use(middleware.AuthorizationMiddleware("users", cfg))
-	{
-		users.Any("/*path", proxyHandler.ProxyRequest("users"))
+	// Cached responses are kept per version, so the cache runs once the
+	// version is known
+	if route.Cache != nil {
+		if route.Protocol != "" && route.Protocol != ProtocolREST {
+			return nil, fmt.Errorf("route %s: only rest routes can be cached", route.Path)
+		}
+		store, err := b.cacheStore()
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Path, err)
+		}
+		handler, err := middleware.Cache(*route.Cache, store, b.handler, b.logger)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: cache: %w", route.Path, err)
+		}
+		compiled.handlers = append(compiled.handlers, handler)
 	}
 
-	// Payments service routes
-	payments := api.Group("/payments")
-	payments.Use(middleware.AuthorizationMiddleware("payments", cfg))
-	{
-		payments.Any("/*path", proxyHandler.ProxyRequest("payments"))
+	// Coalescing runs behind the cache so that only cache misses wait for
+	// each other
+	if route.Coalesce != nil {
+		if route.Protocol != "" && route.Protocol != ProtocolREST {
+			return nil, fmt.Errorf("route %s: only rest routes can be coalesced", route.Path)
+		}
+		handler, err := middleware.Coalesce(*route.Coalesce)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: coalesce: %w", route.Path, err)
+		}
+		compiled.handlers = append(compiled.handlers, handler)
 	}
 
-	// Notifications service routes
-	notifications := api.Group("/notifications")
-	notifications.Use(middleware.AuthorizationMiddleware("notifications", cfg))
-	{
-		notifications.Any("/*path", proxyHandler.ProxyRequest("notifications"))
+	prefix := strings.TrimSuffix(route.Path, "/")
+	switch route.Protocol {
+	case "", ProtocolREST:
+		if _, err := b.proxy.mirrorFor(route.Service); err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Path, err)
+		}
+		compiled.pattern = prefix + "/*path"
+		compiled.handlers = append(compiled.handlers, b.proxy.ProxyRequest(route.Service))
+	case ProtocolGraphQL:
+		compiled.pattern = route.Path
+		compiled.methods = []string{http.MethodPost}
+		compiled.handlers = append(compiled.handlers, b.graphql.HandleRequest(route.Service))
+	case ProtocolWebSocket:
+		compiled.pattern = prefix + "/*path"
+		compiled.methods = []string{http.MethodGet}
+		compiled.handlers = append(compiled.handlers, b.ws.ProxyWebSocket(route.Service))
+	case ProtocolGRPC:
+		if serviceConfig.Protocol != upstream.ProtocolGRPC {
+			return nil, fmt.Errorf("route %s: service %s does not speak grpc", route.Path, route.Service)
+		}
+		compiled.pattern = prefix + "/*path"
+		compiled.methods = []string{http.MethodPost}
+		compiled.handlers = append(compiled.handlers, clearDeadlines, b.proxy.ProxyRequest(route.Service))
+	case ProtocolGRPCJSON:
+		handler, err := b.transcode.HandleRequest(route.Service)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Path, err)
+		}
+		compiled.pattern = prefix + "/*path"
+		compiled.handlers = append(compiled.handlers, handler)
+	case ProtocolGRPCWeb:
+		handler, err := b.grpcWeb.HandleRequest(route.Service, b.proxy.ProxyRequest(route.Service))
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Path, err)
+		}
+		compiled.pattern = prefix + "/*path"
+		compiled.methods = []string{http.MethodPost}
+		compiled.handlers = append(compiled.handlers, clearDeadlines, handler)
+	default:
+		return nil, fmt.Errorf("route %s: unknown protocol %q", route.Path, route.Protocol)
 	}
 
-	// Orders service routes
-	orders := api.Group("/orders")
-	orders.Use(middleware.AuthorizationMiddleware("orders", cfg))
-	{
-		orders.Any("/*path", proxyHandler.ProxyRequest("orders"))
+	// Rewrites run right before the protocol handler so that middleware
+	// sees the original request
+	if route.Rewrite != nil {
+		if route.Protocol == ProtocolGRPCJSON {
+			return nil, fmt.Errorf("route %s: grpc-json routes can't be rewritten", route.Path)
+		}
+		rewriter, err := newURLRewriter(route.Rewrite, compiled.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Path, err)
+		}
+		last := len(compiled.handlers) - 1
+		compiled.handlers = append(compiled.handlers[:last:last], rewriter.handler(), compiled.handlers[last])
 	}
 
-	// You can add additional service routes here as needed
+	if len(route.Methods) > 0 {
+		compiled.methods = make([]string, 0, len(route.Methods))
+		for _, method := range route.Methods {
+			compiled.methods = append(compiled.methods, strings.ToUpper(method))
+		}
+	} else if compiled.methods == nil {
+		compiled.methods = anyMethods
+	}
+
+	return compiled, nil
+}
+
+// anyMethods are the methods a route without a method list accepts
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodHead, http.MethodOptions, http.MethodDelete, http.MethodConnect,
+	http.MethodTrace,
+}
+
+// clearDeadlines lifts the server's read and write timeouts from gRPC
+// calls, whose streams last as long as the client and upstream keep them
+func clearDeadlines(c *gin.Context) {
+	controller := http.NewResponseController(c.Writer)
+	controller.SetReadDeadline(time.Time{})
+	controller.SetWriteDeadline(time.Time{})
+	c.Next()
+}
+
+// defaultMiddleware is applied to routes that don't list their own. Like
+// the /api group it replaces, every route is authenticated.
+func defaultMiddleware(serviceConfig config.ServiceConfig) []string {
+	names := []string{"auth", "authorize"}
+	if serviceConfig.RateLimit > 0 {
+		names = append(names, "ratelimit")
+	}
+	if serviceConfig.DecompressRequests {
+		names = append(names, "decompress")
+	}
+	if serviceConfig.Transformations != nil {
+		names = append(names, "transform")
+	}
+	return names
 }
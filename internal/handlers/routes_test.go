@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/middleware"
+	"github.com/zahidhasann88/api-gateway/internal/server"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+	"github.com/zahidhasann88/api-gateway/pkg/revocation"
+)
+
+func newTestServer(t *testing.T, cfg *config.Config) *server.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	if cfg.CORS.AllowedOrigins == nil {
+		cfg.CORS.AllowedOrigins = []string{"*"}
+	}
+	srv := server.New(cfg, logger.New("error"))
+	if err := RegisterRoutes(srv, cfg); err != nil {
+		t.Fatalf("RegisterRoutes: %v", err)
+	}
+	return srv
+}
+
+// testToken signs an access token of the gateway
+func testToken(t *testing.T, cfg *config.Config, userID string, roles ...string) string {
+	t.Helper()
+	sessions, err := middleware.NewSessionManager(cfg.Auth, revocation.NewMemoryDenylist())
+	require.NoError(t, err)
+	tokens, err := sessions.Start(userID, roles)
+	require.NoError(t, err)
+	return tokens.AccessToken
+}
+
+func serve(srv http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req.WithContext(ctx))
+	return w
+}
+
+func TestRegisterRoutes_ConfiguredRoute(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("inventory:" + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"inventory": {URL: backend.URL, Timeout: 5, RateLimit: 10},
+		},
+		Routes: []config.RouteConfig{
+			{Path: "/catalog", Service: "inventory", Methods: []string{"get"}},
+		},
+	}
+	srv := newTestServer(t, cfg)
+
+	w := serve(srv, httptest.NewRequest("GET", "/catalog/items/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "inventory:/catalog/items/1", w.Body.String())
+
+	w = serve(srv, httptest.NewRequest("POST", "/catalog/items", nil))
+	assert.NotEqual(t, http.StatusOK, w.Code)
+}
+
+func TestRegisterRoutes_DefaultsToServicePrefix(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"inventory": {URL: backend.URL, Timeout: 5, RateLimit: 10},
+		},
+	}
+	srv := newTestServer(t, cfg)
+
+	w := serve(srv, httptest.NewRequest("DELETE", "/api/inventory/items/1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRegisterRoutes_AuthenticatedByDefault(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Auth: config.AuthConfig{Enabled: true, JWTSecret: "secret", Users: config.UsersConfig{Backend: "none"}},
+		Services: map[string]config.ServiceConfig{
+			"inventory": {URL: backend.URL, Timeout: 5},
+		},
+		Routes: []config.RouteConfig{
+			{Path: "/catalog", Service: "inventory"},
+			{Path: "/public", Service: "inventory", Middleware: []string{}},
+		},
+	}
+	srv := newTestServer(t, cfg)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(srv, httptest.NewRequest("GET", "/catalog/items", nil)).Code)
+	// Routes listing their own middleware can leave out auth
+	assert.Equal(t, http.StatusOK, serve(srv, httptest.NewRequest("GET", "/public/items", nil)).Code)
+}
+
+func TestRegisterRoutes_InvalidRoutes(t *testing.T) {
+	services := map[string]config.ServiceConfig{"inventory": {URL: "http://inventory"}}
+
+	for name, route := range map[string]config.RouteConfig{
+		"unknown service":    {Path: "/catalog", Service: "missing"},
+		"unknown protocol":   {Path: "/catalog", Service: "inventory", Protocol: "soap"},
+		"unknown middleware": {Path: "/catalog", Service: "inventory", Middleware: []string{"nope"}},
+		"relative path":      {Path: "catalog", Service: "inventory"},
+		"grpc to http":       {Path: "/catalog.v1.Catalog", Service: "inventory", Protocol: ProtocolGRPC},
+		"grpc-web to http":   {Path: "/catalog.v1.Catalog", Service: "inventory", Protocol: ProtocolGRPCWeb},
+		"cached websocket":   {Path: "/ws", Service: "inventory", Protocol: ProtocolWebSocket, Cache: &config.RouteCacheConfig{}},
+		"cache ttl":          {Path: "/catalog", Service: "inventory", Cache: &config.RouteCacheConfig{DefaultTTL: "soon"}},
+		"coalesced graphql":  {Path: "/graphql", Service: "inventory", Protocol: ProtocolGraphQL, Coalesce: &config.CoalesceConfig{}},
+		"coalesce wait":      {Path: "/catalog", Service: "inventory", Coalesce: &config.CoalesceConfig{MaxWait: "soon"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{
+				CORS:     config.CORSConfig{AllowedOrigins: []string{"*"}},
+				Services: services,
+				Routes:   []config.RouteConfig{route},
+			}
+			srv := server.New(cfg, logger.New("error"))
+			assert.Error(t, RegisterRoutes(srv, cfg))
+		})
+	}
+}
+
+func TestRegisterRoutes_CachedRoute(t *testing.T) {
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("news:" + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{"public": {URL: backend.URL}},
+		Routes: []config.RouteConfig{
+			{Path: "/news", Service: "public", Cache: &config.RouteCacheConfig{}},
+			{Path: "/live", Service: "public"},
+		},
+	}
+	srv := newTestServer(t, cfg)
+
+	for _, want := range []string{"MISS", "HIT"} {
+		w := serve(srv, httptest.NewRequest("GET", "/news/today", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "news:/news/today", w.Body.String())
+		assert.Equal(t, want, w.Header().Get("X-Cache"))
+		assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+	}
+	assert.Equal(t, 1, calls)
+
+	// Routes without a cache always reach the upstream
+	for i := 0; i < 2; i++ {
+		w := serve(srv, httptest.NewRequest("GET", "/live/today", nil))
+		assert.Empty(t, w.Header().Get("X-Cache"))
+	}
+	assert.Equal(t, 3, calls)
+}
+
+func TestRegisterRoutes_Compression(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"received":"` + string(body) + `","encoding":"` + r.Header.Get("Content-Encoding") + `"}`))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Compression: config.CompressionConfig{Enabled: true, MinSize: 64},
+		Services: map[string]config.ServiceConfig{
+			"orders": {URL: backend.URL, DecompressRequests: true},
+		},
+	}
+	srv := newTestServer(t, cfg)
+
+	payload := strings.Repeat("order ", 20)
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write([]byte(payload))
+	require.NoError(t, gz.Close())
+	req := httptest.NewRequest("POST", "/api/orders/new", &body)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w := serve(srv, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	reader, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	plain, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"received":"`+payload+`","encoding":""}`, string(plain))
+}
+
+func TestRegisterRoutes_HealthEndpoints(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"inventory": {
+				URL:      backend.URL,
+				Critical: true,
+				HealthCheck: config.HealthCheckConfig{
+					Path:               "/healthz",
+					Interval:           "5ms",
+					UnhealthyThreshold: 1,
+				},
+			},
+		},
+	}
+	srv := newTestServer(t, cfg)
+	defer srv.Shutdown(context.Background())
+
+	assert.Equal(t, http.StatusOK, serve(srv, httptest.NewRequest("GET", "/health/live", nil)).Code)
+	assert.Eventually(t, func() bool {
+		return serve(srv, httptest.NewRequest("GET", "/health/ready", nil)).Code == http.StatusServiceUnavailable
+	}, time.Second, 5*time.Millisecond)
+
+	w := serve(srv, httptest.NewRequest("GET", "/health", nil))
+	assert.Contains(t, w.Body.String(), `"status":"not ready"`)
+	assert.Contains(t, w.Body.String(), `"inventory":{"status":"down"`)
+	assert.Equal(t, http.StatusOK, serve(srv, httptest.NewRequest("GET", "/health/live", nil)).Code)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/transcoding"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// maxTranscodedBodySize bounds the JSON bodies read for transcoding
+const maxTranscodedBodySize = 4 << 20
+
+// TranscodingHandler serves JSON/HTTP requests from the gRPC methods of a
+// service, using the google.api.http annotations of its descriptor set
+type TranscodingHandler struct {
+	config      *config.Config
+	logger      logger.Logger
+	upstreams   *upstream.Registry
+	transcoders map[string]*transcoding.Transcoder
+}
+
+// NewTranscodingHandler creates a new transcoding handler
+func NewTranscodingHandler(cfg *config.Config, log logger.Logger, upstreams *upstream.Registry) *TranscodingHandler {
+	return &TranscodingHandler{
+		config:      cfg,
+		logger:      log,
+		upstreams:   upstreams,
+		transcoders: make(map[string]*transcoding.Transcoder),
+	}
+}
+
+// transcoder loads the descriptor set of a service once
+func (h *TranscodingHandler) transcoder(serviceName string) (*transcoding.Transcoder, error) {
+	if transcoder, exists := h.transcoders[serviceName]; exists {
+		return transcoder, nil
+	}
+
+	serviceConfig := h.config.Services[serviceName]
+	if serviceConfig.Protocol != upstream.ProtocolGRPC {
+		return nil, fmt.Errorf("service %s does not speak grpc", serviceName)
+	}
+	if serviceConfig.DescriptorSet == "" {
+		return nil, fmt.Errorf("service %s has no descriptor set", serviceName)
+	}
+	transcoder, err := transcoding.Load(serviceConfig.DescriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", serviceName, err)
+	}
+
+	h.transcoders[serviceName] = transcoder
+	return transcoder, nil
+}
+
+// HandleRequest transcodes requests below a route to gRPC calls. The path
+// below the route prefix is matched against the HTTP bindings.
+func (h *TranscodingHandler) HandleRequest(serviceName string) (gin.HandlerFunc, error) {
+	transcoder, err := h.transcoder(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	service, exists := h.upstreams.Service(serviceName)
+	if !exists {
+		return nil, fmt.Errorf("service %s not found", serviceName)
+	}
+	timeout := time.Duration(h.config.Services[serviceName].Timeout) * time.Second
+
+	return func(c *gin.Context) {
+		path := &url.URL{Path: c.Param("path")}
+		binding, vars := transcoder.Match(c.Request.Method, path.EscapedPath())
+		if binding == nil {
+			respondStatus(c, http.StatusNotFound, grpcNotFound, "no gRPC method for "+c.Request.Method+" "+path.Path)
+			return
+		}
+
+		// Build the request message
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxTranscodedBodySize))
+		if err != nil {
+			respondStatus(c, http.StatusRequestEntityTooLarge, grpcResourceExhausted, "request body too large")
+			return
+		}
+		msg, err := binding.NewRequest(vars, c.Request.URL.Query(), body)
+		if err != nil {
+			respondStatus(c, http.StatusBadRequest, grpcInvalidArgument, err.Error())
+			return
+		}
+		payload, err := proto.Marshal(msg)
+		if err != nil {
+			h.logger.Error("Failed to marshal gRPC request", "service", serviceName, "error", err)
+			respondStatus(c, http.StatusInternalServerError, grpcInternal, "failed to encode request")
+			return
+		}
+
+		// Call the method, the service transport picks the instance
+		ctx := c.Request.Context()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, binding.GRPCPath(), bytes.NewReader(transcoding.Frame(payload)))
+		if err != nil {
+			h.logger.Error("Failed to create gRPC request", "service", serviceName, "error", err)
+			respondStatus(c, http.StatusInternalServerError, grpcInternal, "failed to create request")
+			return
+		}
+		req.Header.Set("Content-Type", "application/grpc+proto")
+		req.Header.Set("TE", "trailers")
+		if timeout > 0 {
+			req.Header.Set("Grpc-Timeout", strconv.FormatInt(timeout.Milliseconds(), 10)+"m")
+		}
+		if requestID, exists := c.Get("RequestID"); exists {
+			req.Header.Set("X-Request-ID", fmt.Sprintf("%v", requestID))
+		}
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+
+		resp, err := service.RoundTripper().RoundTrip(req)
+		if err != nil {
+			h.logger.Error("gRPC request failed", "service", serviceName, "method", binding.GRPCPath(), "error", err)
+			respondUpstreamError(c, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		// The status arrives in the trailers, after the response message
+		reply, readErr := transcoding.ReadMessage(resp.Body)
+		io.Copy(io.Discard, resp.Body)
+
+		code, message := grpcStatusOf(resp)
+		if code != 0 {
+			respondStatus(c, transcoding.HTTPStatus(code), code, message)
+			return
+		}
+		if readErr != nil {
+			h.logger.Error("Invalid gRPC response", "service", serviceName, "method", binding.GRPCPath(), "error", readErr)
+			respondStatus(c, http.StatusBadGateway, grpcInternal, "invalid response from service")
+			return
+		}
+
+		encoded, err := binding.MarshalResponse(reply)
+		if err != nil {
+			h.logger.Error("Failed to convert gRPC response", "service", serviceName, "method", binding.GRPCPath(), "error", err)
+			respondStatus(c, http.StatusBadGateway, grpcInternal, "invalid response from service")
+			return
+		}
+		c.Data(http.StatusOK, "application/json", encoded)
+	}, nil
+}
+
+// grpcStatusOf returns the status of a gRPC response whose body has been
+// read. Responses without a status didn't come from a gRPC server.
+func grpcStatusOf(resp *http.Response) (int, string) {
+	value := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if value == "" {
+		value = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if value == "" {
+		return grpcUnknown, fmt.Sprintf("service responded with HTTP status %d", resp.StatusCode)
+	}
+
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return grpcUnknown, "invalid grpc-status " + value
+	}
+	if decoded, err := url.PathUnescape(message); err == nil {
+		message = decoded
+	}
+	return code, message
+}
+
+// respondStatus answers with a JSON rendering of a google.rpc.Status
+func respondStatus(c *gin.Context, httpStatus, code int, message string) {
+	c.JSON(httpStatus, gin.H{
+		"code":    code,
+		"message": message,
+		"details": []interface{}{},
+	})
+}
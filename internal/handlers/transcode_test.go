@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/transcoding"
+)
+
+const shopDescriptorSet = "../transcoding/testdata/shop.pb"
+
+// shopBackend implements the GetItem and CreateItem methods of the shop
+// test service on top of the raw gRPC framing
+func shopBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	transcoder, err := transcoding.Load(shopDescriptorSet)
+	require.NoError(t, err)
+	getItem, _ := transcoder.Match("GET", "/v1/shops/s/items/i")
+	createItem, _ := transcoder.Match("POST", "/v1/shops/s/items")
+
+	decode := func(r *http.Request, method protoreflect.MethodDescriptor) *dynamicpb.Message {
+		payload, err := transcoding.ReadMessage(r.Body)
+		require.NoError(t, err)
+		msg := dynamicpb.NewMessage(method.Input())
+		require.NoError(t, proto.Unmarshal(payload, msg))
+		return msg
+	}
+	reply := func(w http.ResponseWriter, method protoreflect.MethodDescriptor, json string) {
+		msg := dynamicpb.NewMessage(method.Output())
+		require.NoError(t, protojson.Unmarshal([]byte(json), msg))
+		payload, err := proto.Marshal(msg)
+		require.NoError(t, err)
+		w.Write(transcoding.Frame(payload))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}
+
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		switch r.URL.Path {
+		case getItem.GRPCPath():
+			req := decode(r, getItem.Method)
+			id := req.Get(getItem.Method.Input().Fields().ByName("id")).String()
+			if id == "missing" {
+				w.Header().Set("Grpc-Status", "5")
+				w.Header().Set("Grpc-Message", "item%20not%20found")
+				return
+			}
+			reply(w, getItem.Method, `{"id":"`+id+`","name":"Lamp","quantity":2}`)
+		case createItem.GRPCPath():
+			req := decode(r, createItem.Method)
+			encoded, _ := protojson.Marshal(req)
+			w.Header().Set("X-Request-Message", string(encoded))
+			reply(w, createItem.Method, `{"id":"new","name":"Chair"}`)
+		default:
+			w.Header().Set("Grpc-Status", "12")
+		}
+	}), &http2.Server{}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func newTranscodingServer(t *testing.T, backendURL string) http.Handler {
+	t.Helper()
+	return newTestServer(t, &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"shop": {URL: backendURL, Protocol: "grpc", DescriptorSet: shopDescriptorSet, Timeout: 5},
+		},
+		Routes: []config.RouteConfig{
+			{Path: "/shop", Service: "shop", Protocol: ProtocolGRPCJSON},
+		},
+	})
+}
+
+func TestTranscoding_Get(t *testing.T) {
+	srv := newTranscodingServer(t, shopBackend(t).URL)
+
+	w := serve(srv, httptest.NewRequest("GET", "/shop/v1/shops/main/items/7", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"id":"7","name":"Lamp","quantity":2}`, w.Body.String())
+
+	w = serve(srv, httptest.NewRequest("GET", "/shop/v1/shops/main/items/missing", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"code":5,"message":"item not found","details":[]}`, w.Body.String())
+
+	w = serve(srv, httptest.NewRequest("GET", "/shop/v2/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTranscoding_PostBody(t *testing.T) {
+	srv := newTranscodingServer(t, shopBackend(t).URL)
+
+	req := httptest.NewRequest("POST", "/shop/v1/shops/main/items", bytes.NewBufferString(`{"name":"Chair","quantity":4}`))
+	w := serve(srv, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"new","name":"Chair"}`, w.Body.String())
+
+	req = httptest.NewRequest("POST", "/shop/v1/shops/main/items", bytes.NewBufferString(`{"quantity":"lots"}`))
+	w = serve(srv, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":3`)
+}
+
+func TestTranscoding_RouteValidation(t *testing.T) {
+	for name, service := range map[string]config.ServiceConfig{
+		"not grpc":           {URL: "http://shop", DescriptorSet: shopDescriptorSet},
+		"no descriptor set":  {URL: "http://shop", Protocol: "grpc"},
+		"missing descriptor": {URL: "http://shop", Protocol: "grpc", DescriptorSet: "missing.pb"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{
+				CORS:     config.CORSConfig{AllowedOrigins: []string{"*"}},
+				Services: map[string]config.ServiceConfig{"shop": service},
+				Routes:   []config.RouteConfig{{Path: "/shop", Service: "shop", Protocol: ProtocolGRPCJSON}},
+			}
+			builder := newRouteBuilder(cfg, nil, nil)
+			_, err := builder.build(cfg.Routes[0])
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zahidhasann88/api-gateway/internal/middleware"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
+)
+
+// selectVersion picks the version of a split service serving the request.
+// It runs after the route's middleware so that users stick to a version.
+func selectVersion(service *upstream.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var user string
+		if userID, exists := c.Get("userID"); exists && userID != nil {
+			user = fmt.Sprintf("%v", userID)
+		}
+
+		version := service.SelectVersion(c.Request, user)
+		c.Set(middleware.VersionKey, version)
+		c.Request = c.Request.WithContext(upstream.WithVersion(c.Request.Context(), version))
+		c.Next()
+	}
+}
+
+// VersionsHandler reads and changes the traffic split of services
+type VersionsHandler struct {
+	upstreams *upstream.Registry
+}
+
+// NewVersionsHandler creates a new versions handler
+func NewVersionsHandler(upstreams *upstream.Registry) *VersionsHandler {
+	return &VersionsHandler{upstreams: upstreams}
+}
+
+// splitService returns the service named in the path if its traffic is split
+func (h *VersionsHandler) splitService(c *gin.Context) (*upstream.Service, bool) {
+	service, exists := h.upstreams.Service(c.Param("service"))
+	if !exists || service.Versions() == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service has no traffic split"})
+		return nil, false
+	}
+	return service, true
+}
+
+// Get reports the weight of every version of a service
+func (h *VersionsHandler) Get(c *gin.Context) {
+	service, ok := h.splitService(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"service": service.Name(), "versions": service.Versions()})
+}
+
+// Update changes the weights of versions, taking a JSON object of version
+// names to weights
+func (h *VersionsHandler) Update(c *gin.Context) {
+	service, ok := h.splitService(c)
+	if !ok {
+		return
+	}
+
+	var weights map[string]int
+	if err := c.ShouldBindJSON(&weights); err != nil || len(weights) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected an object of version weights"})
+		return
+	}
+	if err := service.SetVersionWeights(weights); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, upstream.ErrUnknownVersion) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"service": service.Name(), "versions": service.Versions()})
+}
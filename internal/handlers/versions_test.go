@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+func newCanaryServer(t *testing.T) (http.Handler, *config.Config) {
+	t.Helper()
+	backend := func(name string) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+
+	cfg := &config.Config{
+		Auth: config.AuthConfig{Enabled: true, JWTSecret: "secret", Expiration: "1h", Users: config.UsersConfig{Backend: "none"}},
+		Services: map[string]config.ServiceConfig{
+			"checkout": {
+				TrafficSplit: config.TrafficSplitConfig{
+					HashOn:  "header",
+					HashKey: "X-User-ID",
+					Header:  "X-Canary",
+					Versions: []config.VersionConfig{
+						{Name: "stable", Weight: 100, URL: backend("stable")},
+						{Name: "canary", Weight: 0, URL: backend("canary"), HeaderValues: []string{"always"}},
+					},
+				},
+			},
+		},
+		Routes: []config.RouteConfig{{Path: "/checkout", Service: "checkout", Middleware: []string{}}},
+	}
+	return newTestServer(t, cfg), cfg
+}
+
+func TestVersions_Routing(t *testing.T) {
+	srv, _ := newCanaryServer(t)
+
+	get := func(headers map[string]string) string {
+		req := httptest.NewRequest("GET", "/checkout/cart", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		return serve(srv, req).Body.String()
+	}
+	assert.Equal(t, "stable", get(map[string]string{"X-User-ID": "alice"}))
+	assert.Equal(t, "canary", get(map[string]string{"X-User-ID": "alice", "X-Canary": "always"}))
+
+	w := serve(srv, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `api_gateway_requests_total{method="GET",service="checkout",status="200",version="canary"}`)
+}
+
+func TestVersions_AdminUpdatesWeights(t *testing.T) {
+	srv, cfg := newCanaryServer(t)
+
+	admin := func(method, body string, roles ...string) *httptest.ResponseRecorder {
+		token := testToken(t, cfg, "ops", roles...)
+		req := httptest.NewRequest(method, "/admin/services/checkout/versions", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return serve(srv, req)
+	}
+
+	assert.Equal(t, http.StatusForbidden, admin("GET", "", "user").Code)
+
+	w := admin("GET", "", "admin")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"service":"checkout","versions":[{"name":"stable","weight":100},{"name":"canary","weight":0}]}`, w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, admin("PUT", `{"beta":5}`, "admin").Code)
+	assert.Equal(t, http.StatusBadRequest, admin("PUT", `{"stable":0}`, "admin").Code)
+
+	w = admin("PUT", `{"stable":0,"canary":100}`, "admin")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req := httptest.NewRequest("GET", "/checkout/cart", nil)
+	req.Header.Set("X-User-ID", "alice")
+	assert.Equal(t, "canary", serve(srv, req).Body.String())
+}
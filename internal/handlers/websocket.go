@@ -2,27 +2,29 @@ package handlers
 
 import (
 	"net/http"
-	"net/url"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/internal/upstream"
 	"github.com/zahidhasann88/api-gateway/pkg/logger"
 )
 
 // WebSocketHandler handles WebSocket connections
 type WebSocketHandler struct {
-	config   *config.Config
-	logger   logger.Logger
-	upgrader websocket.Upgrader
+	config    *config.Config
+	logger    logger.Logger
+	upstreams *upstream.Registry
+	upgrader  websocket.Upgrader
 }
 
 // NewWebSocketHandler creates a new WebSocket handler
-func NewWebSocketHandler(cfg *config.Config, log logger.Logger) *WebSocketHandler {
+func NewWebSocketHandler(cfg *config.Config, log logger.Logger, upstreams *upstream.Registry) *WebSocketHandler {
 	return &WebSocketHandler{
-		config: cfg,
-		logger: log,
+		config:    cfg,
+		logger:    log,
+		upstreams: upstreams,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
@@ -35,32 +37,45 @@ func NewWebSocketHandler(cfg *config.Config, log logger.Logger) *WebSocketHandle
 
 // ProxyWebSocket handles WebSocket connections
 func (h *WebSocketHandler) ProxyWebSocket(serviceName string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Check if service exists
-		serviceConfig, exists := h.config.Services[serviceName]
-		if !exists {
+	// Check if service exists
+	service, exists := h.upstreams.Service(serviceName)
+	if !exists {
+		return func(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
-			return
 		}
+	}
+
+	// Dial with the settings of the service's connection pool. Upgraded
+	// connections can't go back to the pool, so only the dialer is shared.
+	pool := service.Pool()
+	dialer := &websocket.Dialer{
+		Proxy:            pool.Proxy,
+		NetDialContext:   pool.DialContext,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+	}
+	if pool.TLSClientConfig != nil {
+		// The pool offers HTTP/2 but the upgrade needs HTTP/1.1
+		dialer.TLSClientConfig = pool.TLSClientConfig.Clone()
+		dialer.TLSClientConfig.NextProtos = nil
+	}
+
+	return func(c *gin.Context) {
 
-		// Parse the target URL
-		targetURL, err := url.Parse(serviceConfig.URL)
+		// Pick the instance that will hold the connection
+		target, err := service.Pick(c.Request)
 		if err != nil {
-			h.logger.Error("Failed to parse WebSocket URL", "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			h.logger.Error("No WebSocket upstream available", "service", serviceName, "error", err)
+			respondUpstreamError(c, err)
 			return
 		}
+		target.Acquire()
+		defer target.Release()
 
 		// Modify the target URL for WebSocket
-		wsScheme := "ws"
-		if strings.HasPrefix(targetURL.Scheme, "https") {
-			wsScheme = "wss"
-		}
-		wsURL := url.URL{
-			Scheme:   wsScheme,
-			Host:     targetURL.Host,
-			Path:     c.Request.URL.Path,
-			RawQuery: c.Request.URL.RawQuery,
+		wsURL := upstream.TargetURL(target, upstreamURL(c))
+		wsURL.Scheme = "ws"
+		if strings.HasPrefix(target.URL.Scheme, "https") {
+			wsURL.Scheme = "wss"
 		}
 
 		// Log the connection attempt
@@ -78,7 +93,12 @@ func (h *WebSocketHandler) ProxyWebSocket(serviceName string) gin.HandlerFunc {
 		defer conn.Close()
 
 		// Connect to the backend WebSocket
-		backendConn, _, err := websocket.DefaultDialer.Dial(wsURL.String(), nil)
+		backendConn, resp, err := dialer.Dial(wsURL.String(), nil)
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		service.Observe(target, statusCode, err, 0)
 		if err != nil {
 			h.logger.Error("Failed to connect to backend WebSocket", "error", err)
 			conn.WriteMessage(websocket.CloseMessage,
@@ -0,0 +1,717 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/cache"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// Values of the X-Cache header
+const (
+	cacheHit         = "HIT"
+	cacheMiss        = "MISS"
+	cacheStale       = "STALE"
+	cacheRevalidated = "REVALIDATED"
+)
+
+var cacheRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_cache_requests_total",
+		Help: "Total number of requests to cached routes by cache result",
+	},
+	[]string{"service", "result"},
+)
+
+// staleRetention is how long responses with validators are kept past their
+// stale windows, so that they can be revalidated rather than fetched again
+const staleRetention = time.Hour
+
+// revalidationTimeout bounds background revalidations
+const revalidationTimeout = time.Minute
+
+// revalidationKey marks the requests refreshing stale responses in the
+// background
+type revalidationKey struct{}
+
+// cacheableStatus lists the statuses cached when the upstream allows it
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// Headers that describe a connection rather than a response
+var unstoredHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding",
+	"Trailer", "Upgrade", "Age", "X-Cache",
+}
+
+// responseCache serves a route's GET requests from a store
+type responseCache struct {
+	store   cache.Store
+	handler http.Handler
+	logger  logger.Logger
+
+	defaultTTL           time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	maxBodySize          int64
+
+	// revalidating holds the keys being refreshed in the background
+	revalidating sync.Map
+	now          func() time.Time
+}
+
+// cachedResponse is an upstream response kept in the store
+type cachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Tags are the surrogate keys the upstream tagged the response with
+	Tags []string
+	// Stored is when the response was received and Age its age then
+	Stored               time.Time
+	Age                  time.Duration
+	Lifetime             time.Duration
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+}
+
+// variants lists the request headers the responses under a key vary on
+type variants struct {
+	Headers []string
+	// ID changes whenever the record is replaced, so variants stored for
+	// an earlier record are no longer found
+	ID string
+}
+
+// cacheEntry is the value stored under a key, either a response or the
+// variants of a response that varies
+type cacheEntry struct {
+	Response *cachedResponse `json:",omitempty"`
+	Variants *variants       `json:",omitempty"`
+}
+
+// Cache serves GET and HEAD requests from store as Cache-Control allows
+func Cache(cfg config.RouteCacheConfig, store cache.Store, handler http.Handler, log logger.Logger) (gin.HandlerFunc, error) {
+	rc, err := newResponseCache(cfg, store, handler, log)
+	if err != nil {
+		return nil, err
+	}
+	return rc.handle, nil
+}
+
+func newResponseCache(cfg config.RouteCacheConfig, store cache.Store, handler http.Handler, log logger.Logger) (*responseCache, error) {
+	rc := &responseCache{
+		store:       store,
+		handler:     handler,
+		logger:      log,
+		maxBodySize: cfg.MaxBodySize,
+		now:         time.Now,
+	}
+	if rc.maxBodySize <= 0 {
+		rc.maxBodySize = 1 << 20
+	}
+
+	var err error
+	if rc.defaultTTL, err = config.ParseDuration(cfg.DefaultTTL, 0); err != nil {
+		return nil, fmt.Errorf("invalid default ttl: %w", err)
+	}
+	if rc.staleWhileRevalidate, err = config.ParseDuration(cfg.StaleWhileRevalidate, 0); err != nil {
+		return nil, fmt.Errorf("invalid stale while revalidate: %w", err)
+	}
+	if rc.staleIfError, err = config.ParseDuration(cfg.StaleIfError, 0); err != nil {
+		return nil, fmt.Errorf("invalid stale if error: %w", err)
+	}
+	return rc, nil
+}
+
+func (rc *responseCache) handle(c *gin.Context) {
+	ctx := c.Request.Context()
+	key := cacheKey(c)
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead:
+	default:
+		c.Next()
+		// A changed resource outdates its cached response
+		if c.Writer.Status() < http.StatusBadRequest {
+			if _, err := rc.store.Delete(ctx, key); err != nil {
+				rc.logger.Warn("Failed to invalidate cached response", "key", key, "error", err)
+			}
+		}
+		return
+	}
+
+	cached, vary := rc.lookup(ctx, key, c.Request)
+	if cached != nil && ctx.Value(revalidationKey{}) == nil {
+		age := cached.age(rc.now())
+		switch {
+		case age < cached.Lifetime:
+			rc.serve(c, cached, cacheHit)
+			return
+		case age < cached.Lifetime+cached.StaleWhileRevalidate:
+			rc.serve(c, cached, cacheStale)
+			rc.revalidate(c.Request, key)
+			return
+		}
+	}
+	if c.Request.Method == http.MethodHead {
+		c.Header("X-Cache", cacheMiss)
+		cacheRequests.WithLabelValues(serviceName(c), strings.ToLower(cacheMiss)).Inc()
+		c.Next()
+		return
+	}
+
+	// The cache answers the client's conditions itself and asks the
+	// upstream whether the cached response is still current
+	original := c.Request
+	c.Request = original.Clone(ctx)
+	c.Request.Header.Del("If-None-Match")
+	c.Request.Header.Del("If-Modified-Since")
+	validated := false
+	if cached != nil {
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			c.Request.Header.Set("If-None-Match", etag)
+			validated = true
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			c.Request.Header.Set("If-Modified-Since", modified)
+			validated = true
+		}
+	}
+
+	// Responses are held back while a cached one may replace them
+	gatewayHeader := c.Writer.Header().Clone()
+	writer := &cacheWriter{ResponseWriter: c.Writer, limit: rc.maxBodySize, held: cached != nil}
+	c.Writer = writer
+	c.Header("X-Cache", cacheMiss)
+
+	c.Next()
+
+	c.Request = original
+	c.Writer = writer.ResponseWriter
+	status := writer.status()
+	header := upstreamHeader(gatewayHeader, writer.recordedHeader())
+
+	if writer.held {
+		switch {
+		case validated && status == http.StatusNotModified:
+			cached.refresh(header, writer.tags, rc.now())
+			rc.freshen(cached, cached.Header)
+			rc.save(ctx, key, c.Request, cached, vary)
+			resetHeader(c.Writer.Header(), gatewayHeader)
+			rc.serve(c, cached, cacheRevalidated)
+			return
+		case status >= http.StatusInternalServerError && cached.age(rc.now()) < cached.Lifetime+cached.StaleIfError:
+			resetHeader(c.Writer.Header(), gatewayHeader)
+			rc.serve(c, cached, cacheStale)
+			return
+		}
+		writer.release()
+	}
+	cacheRequests.WithLabelValues(serviceName(c), strings.ToLower(cacheMiss)).Inc()
+
+	if writer.tooLarge || c.IsAborted() || !rc.storable(c, status, header) {
+		return
+	}
+	response := &cachedResponse{
+		Status: status,
+		Header: header,
+		Body:   writer.body.Bytes(),
+		Tags:   writer.tags,
+		Stored: rc.now(),
+		Age:    headerAge(header),
+	}
+	rc.freshen(response, header)
+	rc.save(ctx, key, c.Request, response, vary)
+}
+
+// cacheKey identifies the responses for a request. HEAD requests share the
+// responses of GET requests.
+func cacheKey(c *gin.Context) string {
+	return CacheKey(serviceName(c), c.GetString(VersionKey), c.Request.Host, c.Request.URL.RequestURI())
+}
+
+// CacheKey returns the key of the cached response for uri on host
+func CacheKey(service, version, host, uri string) string {
+	return strings.Join([]string{service, version, strings.ToLower(host), uri}, "|")
+}
+
+// CacheKeyURI returns the path and query of the request a cache key was
+// made for, followed by the variant for responses that vary
+func CacheKeyURI(key string) string {
+	parts := strings.SplitN(key, "|", 4)
+	if len(parts) < 4 {
+		return ""
+	}
+	return parts[3]
+}
+
+// lookup returns the cached response for a request and the variants of
+// its key, if any
+func (rc *responseCache) lookup(ctx context.Context, key string, r *http.Request) (*cachedResponse, *variants) {
+	entry := rc.load(ctx, key)
+	if entry == nil {
+		return nil, nil
+	}
+	if entry.Variants == nil {
+		return entry.Response, nil
+	}
+	variant := rc.load(ctx, variantKey(key, entry.Variants, r))
+	if variant == nil {
+		return nil, entry.Variants
+	}
+	return variant.Response, entry.Variants
+}
+
+func (rc *responseCache) load(ctx context.Context, key string) *cacheEntry {
+	value, found, err := rc.store.Get(ctx, key)
+	if err != nil {
+		rc.logger.Warn("Failed to read cached response", "key", key, "error", err)
+		return nil
+	}
+	if !found {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(value, &entry); err != nil || (entry.Response == nil && entry.Variants == nil) {
+		return nil
+	}
+	return &entry
+}
+
+// save stores a response under its key, or under the variant of the
+// request when the response varies
+func (rc *responseCache) save(ctx context.Context, key string, r *http.Request, response *cachedResponse, vary *variants) {
+	headers := varyHeaders(response.Header)
+	if slices.Contains(headers, "*") {
+		return
+	}
+	ttl := response.Lifetime + max(response.StaleWhileRevalidate, response.StaleIfError)
+	if response.Header.Get("ETag") != "" || response.Header.Get("Last-Modified") != "" {
+		ttl += staleRetention
+	}
+	ttl -= response.Age
+	if ttl <= 0 {
+		return
+	}
+
+	if len(headers) > 0 {
+		if vary == nil || !slices.Equal(vary.Headers, headers) {
+			vary = &variants{Headers: headers, ID: strconv.FormatInt(rc.now().UnixNano(), 36)}
+		}
+		rc.set(ctx, key, &cacheEntry{Variants: vary}, ttl, response.Tags)
+		key = variantKey(key, vary, r)
+	}
+	rc.set(ctx, key, &cacheEntry{Response: response}, ttl, response.Tags)
+}
+
+func (rc *responseCache) set(ctx context.Context, key string, entry *cacheEntry, ttl time.Duration, tags []string) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		rc.logger.Error("Failed to encode cached response", "key", key, "error", err)
+		return
+	}
+	if err := rc.store.Set(ctx, key, value, ttl, tags...); err != nil {
+		rc.logger.Warn("Failed to store cached response", "key", key, "error", err)
+	}
+}
+
+// storable reports whether a response may be kept by a shared cache
+func (rc *responseCache) storable(c *gin.Context, status int, header http.Header) bool {
+	if !cacheableStatus[status] || !shareable(header) {
+		return false
+	}
+	directives := parseCacheControl(header)
+	// Responses to authenticated requests need the upstream's permission
+	if authenticated(c) {
+		_, public := directives["public"]
+		_, shared := directives["s-maxage"]
+		_, mustRevalidate := directives["must-revalidate"]
+		if !public && !shared && !mustRevalidate {
+			return false
+		}
+	}
+	return true
+}
+
+// authenticated reports whether a request carries credentials. API keys
+// are removed from requests once checked, leaving their consumer.
+func authenticated(c *gin.Context) bool {
+	if c.GetHeader("Authorization") != "" || c.GetString(ConsumerKey) != "" {
+		return true
+	}
+	userID, exists := c.Get("userID")
+	return exists && userID != nil
+}
+
+// shareable reports whether a response may be served to other clients than
+// the one it was made for
+func shareable(header http.Header) bool {
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	directives := parseCacheControl(header)
+	_, noStore := directives["no-store"]
+	_, private := directives["private"]
+	return !noStore && !private
+}
+
+// freshen sets how long a response is fresh and may be served stale from
+// its headers, falling back to the route's defaults
+func (rc *responseCache) freshen(response *cachedResponse, header http.Header) {
+	directives := parseCacheControl(header)
+	response.Lifetime = rc.defaultTTL
+	if seconds, ok := directiveSeconds(directives, "s-maxage"); ok {
+		response.Lifetime = seconds
+	} else if seconds, ok := directiveSeconds(directives, "max-age"); ok {
+		response.Lifetime = seconds
+	} else if expires := header.Get("Expires"); expires != "" {
+		response.Lifetime = 0
+		if at, err := http.ParseTime(expires); err == nil {
+			date, err := http.ParseTime(header.Get("Date"))
+			if err != nil {
+				date = response.Stored
+			}
+			response.Lifetime = max(at.Sub(date), 0)
+		}
+	}
+	if _, noCache := directives["no-cache"]; noCache {
+		response.Lifetime = 0
+	}
+
+	response.StaleWhileRevalidate = rc.staleWhileRevalidate
+	if seconds, ok := directiveSeconds(directives, "stale-while-revalidate"); ok {
+		response.StaleWhileRevalidate = seconds
+	}
+	response.StaleIfError = rc.staleIfError
+	if seconds, ok := directiveSeconds(directives, "stale-if-error"); ok {
+		response.StaleIfError = seconds
+	}
+	// Stale responses must not be served at all
+	_, mustRevalidate := directives["must-revalidate"]
+	_, proxyRevalidate := directives["proxy-revalidate"]
+	if mustRevalidate || proxyRevalidate {
+		response.StaleWhileRevalidate, response.StaleIfError = 0, 0
+	}
+}
+
+// serve answers the request with a cached response
+func (rc *responseCache) serve(c *gin.Context, response *cachedResponse, result string) {
+	header := c.Writer.Header()
+	for name, values := range response.Header {
+		header[name] = append(header[name], values...)
+	}
+	header.Set("Age", strconv.Itoa(int(response.age(rc.now())/time.Second)))
+	header.Set("X-Cache", result)
+	cacheRequests.WithLabelValues(serviceName(c), strings.ToLower(result)).Inc()
+
+	c.Abort()
+	if notModified(c.Request, response) {
+		header.Del("Content-Length")
+		c.Writer.WriteHeader(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Writer.WriteHeader(response.Status)
+	if c.Request.Method == http.MethodHead || len(response.Body) == 0 {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Writer.Write(response.Body)
+}
+
+// revalidate refreshes a stale response in the background, once per key
+func (rc *responseCache) revalidate(r *http.Request, key string) {
+	if rc.handler == nil {
+		return
+	}
+	if _, running := rc.revalidating.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), revalidationKey{}, true), revalidationTimeout)
+	req := r.Clone(ctx)
+	req.Method = http.MethodGet
+	go func() {
+		defer rc.revalidating.Delete(key)
+		defer cancel()
+		rc.handler.ServeHTTP(&discardWriter{header: make(http.Header)}, req)
+	}()
+}
+
+// age returns how old the response is now
+func (r *cachedResponse) age(now time.Time) time.Duration {
+	return r.Age + max(now.Sub(r.Stored), 0)
+}
+
+// refresh updates a response with the headers of a 304 Not Modified
+func (r *cachedResponse) refresh(header http.Header, tags []string, now time.Time) {
+	for name, values := range header {
+		if name == "Content-Length" {
+			continue
+		}
+		r.Header[name] = values
+	}
+	if len(tags) > 0 {
+		r.Tags = tags
+	}
+	r.Stored = now
+	r.Age = headerAge(header)
+}
+
+// notModified evaluates the client's conditional headers against a cached
+// response
+func notModified(r *http.Request, response *cachedResponse) bool {
+	if response.Status != http.StatusOK {
+		return false
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(response.Header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(response.Header.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+// parseCacheControl returns the Cache-Control directives and their values
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, argument, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(argument, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+func directiveSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, exists := directives[name]
+	if !exists {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+func headerAge(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Age"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// varyHeaders returns the canonical names listed by the Vary header
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// variantKey identifies the variant of a response that matches a request
+func variantKey(key string, vary *variants, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	b.WriteString("|")
+	b.WriteString(vary.ID)
+	for _, name := range vary.Headers {
+		b.WriteString("|")
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// upstreamHeader returns the headers added to the response after the
+// gateway's own middleware had set gatewayHeader
+func upstreamHeader(gatewayHeader, header http.Header) http.Header {
+	result := make(http.Header)
+	for name, values := range header {
+		if slices.Contains(unstoredHeaders, name) {
+			continue
+		}
+		set := gatewayHeader[name]
+		if len(values) >= len(set) && slices.Equal(values[:len(set)], set) {
+			values = values[len(set):]
+		}
+		if len(values) > 0 {
+			result[name] = slices.Clone(values)
+		}
+	}
+	return result
+}
+
+// resetHeader drops the headers added since the gateway's own middleware
+func resetHeader(header, gatewayHeader http.Header) {
+	for name := range header {
+		delete(header, name)
+	}
+	for name, values := range gatewayHeader {
+		header[name] = values
+	}
+}
+
+// cacheWriter records the response for the cache. While held the response
+// is only buffered, so that a cached response can still replace it.
+type cacheWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	tags     []string
+	limit    int64
+	code     int
+	held     bool
+	wrote    bool
+	tooLarge bool
+	// header is the response header as written, before the gateway's outer
+	// middleware, such as compression, rewrites it
+	header http.Header
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	w.code = code
+	// Surrogate keys are meant for the cache, not for clients
+	header := w.ResponseWriter.Header()
+	if values := header.Values("Surrogate-Key"); len(values) > 0 {
+		w.tags = strings.Fields(strings.Join(values, " "))
+		header.Del("Surrogate-Key")
+	}
+	w.header = header.Clone()
+	if !w.held {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *cacheWriter) WriteHeaderNow() {
+	if !w.held {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *cacheWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.wrote = true
+	if !w.tooLarge && int64(w.body.Len()+len(p)) <= w.limit {
+		w.body.Write(p)
+		if w.held {
+			return len(p), nil
+		}
+	} else {
+		// Too large to cache or to be replaced
+		w.tooLarge = true
+		w.release()
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *cacheWriter) Status() int {
+	if w.held {
+		return w.status()
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *cacheWriter) Written() bool {
+	if w.held {
+		return w.wrote
+	}
+	return w.ResponseWriter.Written()
+}
+
+func (w *cacheWriter) Flush() {
+	if !w.held {
+		if w.header == nil {
+			w.header = w.ResponseWriter.Header().Clone()
+		}
+		w.ResponseWriter.Flush()
+	}
+}
+
+// recordedHeader returns the header of the response being recorded
+func (w *cacheWriter) recordedHeader() http.Header {
+	if w.header != nil {
+		return w.header
+	}
+	return w.ResponseWriter.Header()
+}
+
+func (w *cacheWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// release sends the held response on to the client
+func (w *cacheWriter) release() {
+	if !w.held {
+		return
+	}
+	w.held = false
+	w.ResponseWriter.WriteHeader(w.status())
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+	} else {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// discardWriter is the response writer of background revalidations
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/cache"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// cacheTest is a router caching the responses of backend at a fixed time
+type cacheTest struct {
+	router *gin.Engine
+	cache  *responseCache
+	now    atomic.Int64
+	calls  atomic.Int32
+}
+
+func newCacheTest(t *testing.T, cfg config.RouteCacheConfig, backend gin.HandlerFunc) *cacheTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	ct := &cacheTest{router: gin.New()}
+	ct.now.Store(time.Unix(1700000000, 0).UnixNano())
+	rc, err := newResponseCache(cfg, cache.NewMemoryStore(1<<20), ct.router, logger.New("error"))
+	require.NoError(t, err)
+	rc.now = func() time.Time { return time.Unix(0, ct.now.Load()) }
+	ct.cache = rc
+
+	ct.router.Any("/*path", Service("public"), rc.handle, func(c *gin.Context) {
+		ct.calls.Add(1)
+		backend(c)
+	})
+	return ct
+}
+
+func (ct *cacheTest) advance(d time.Duration) {
+	ct.now.Add(int64(d))
+}
+
+func (ct *cacheTest) do(method string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/articles?page=1", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	ct.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCache_HitsAndRevalidates(t *testing.T) {
+	version := "v1"
+	ct := newCacheTest(t, config.RouteCacheConfig{}, func(c *gin.Context) {
+		c.Header("Cache-Control", "max-age=60")
+		c.Header("ETag", `"`+version+`"`)
+		if c.GetHeader("If-None-Match") == `"`+version+`"` {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.String(http.StatusOK, "articles "+version)
+	})
+
+	w := ct.do("GET", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "articles v1", w.Body.String())
+
+	ct.advance(30 * time.Second)
+	w = ct.do("GET", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "30", w.Header().Get("Age"))
+	assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+	assert.Equal(t, "articles v1", w.Body.String())
+	assert.Equal(t, int32(1), ct.calls.Load())
+
+	// The cache answers conditional requests itself
+	w = ct.do("GET", map[string]string{"If-None-Match": `"v1"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = ct.do("HEAD", nil)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Empty(t, w.Body.String())
+
+	// Once stale, the response is revalidated with its ETag
+	ct.advance(time.Minute)
+	w = ct.do("GET", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "REVALIDATED", w.Header().Get("X-Cache"))
+	assert.Equal(t, "articles v1", w.Body.String())
+	assert.Equal(t, "HIT", ct.do("GET", nil).Header().Get("X-Cache"))
+	assert.Equal(t, int32(2), ct.calls.Load())
+
+	// A changed resource replaces the cached response
+	version = "v2"
+	ct.advance(2 * time.Minute)
+	w = ct.do("GET", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "articles v2", w.Body.String())
+	assert.Equal(t, "articles v2", ct.do("GET", nil).Body.String())
+}
+
+func TestCache_NotStored(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.RouteCacheConfig
+		header  map[string]string
+		request map[string]string
+		status  int
+	}{
+		{"no-store", config.RouteCacheConfig{}, map[string]string{"Cache-Control": "no-store, max-age=60"}, nil, http.StatusOK},
+		{"private", config.RouteCacheConfig{}, map[string]string{"Cache-Control": "private, max-age=60"}, nil, http.StatusOK},
+		{"cookie", config.RouteCacheConfig{}, map[string]string{"Cache-Control": "max-age=60", "Set-Cookie": "session=1"}, nil, http.StatusOK},
+		{"no freshness", config.RouteCacheConfig{}, nil, nil, http.StatusOK},
+		{"authorized", config.RouteCacheConfig{}, map[string]string{"Cache-Control": "max-age=60"}, map[string]string{"Authorization": "Bearer token"}, http.StatusOK},
+		{"server error", config.RouteCacheConfig{DefaultTTL: "1m"}, nil, nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ct := newCacheTest(t, tt.cfg, func(c *gin.Context) {
+				for name, value := range tt.header {
+					c.Header(name, value)
+				}
+				c.String(tt.status, "articles")
+			})
+
+			ct.do("GET", tt.request)
+			w := ct.do("GET", tt.request)
+			assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+			assert.Equal(t, int32(2), ct.calls.Load())
+		})
+	}
+}
+
+func TestCache_DefaultTTLAndPublicAuthorized(t *testing.T) {
+	ct := newCacheTest(t, config.RouteCacheConfig{DefaultTTL: "10s"}, func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" {
+			c.Header("Cache-Control", "public, max-age=60")
+		}
+		c.String(http.StatusOK, "articles")
+	})
+
+	ct.do("GET", nil)
+	assert.Equal(t, "HIT", ct.do("GET", nil).Header().Get("X-Cache"))
+	ct.advance(10 * time.Second)
+	assert.Equal(t, "MISS", ct.do("GET", nil).Header().Get("X-Cache"))
+
+	auth := map[string]string{"Authorization": "Bearer token"}
+	ct.advance(10 * time.Second)
+	ct.do("GET", auth)
+	ct.advance(30 * time.Second)
+	assert.Equal(t, "HIT", ct.do("GET", auth).Header().Get("X-Cache"))
+}
+
+func TestCache_Vary(t *testing.T) {
+	ct := newCacheTest(t, config.RouteCacheConfig{}, func(c *gin.Context) {
+		c.Header("Cache-Control", "max-age=60")
+		c.Header("Vary", "Accept-Language")
+		c.String(http.StatusOK, "articles in "+c.GetHeader("Accept-Language"))
+	})
+
+	en := map[string]string{"Accept-Language": "en"}
+	fr := map[string]string{"Accept-Language": "fr"}
+	assert.Equal(t, "MISS", ct.do("GET", en).Header().Get("X-Cache"))
+	assert.Equal(t, "MISS", ct.do("GET", fr).Header().Get("X-Cache"))
+
+	w := ct.do("GET", en)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "articles in en", w.Body.String())
+	w = ct.do("GET", fr)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "articles in fr", w.Body.String())
+	assert.Equal(t, "MISS", ct.do("GET", nil).Header().Get("X-Cache"))
+}
+
+func TestCache_StaleIfError(t *testing.T) {
+	failing := false
+	ct := newCacheTest(t, config.RouteCacheConfig{}, func(c *gin.Context) {
+		if failing {
+			c.String(http.StatusBadGateway, "upstream down")
+			return
+		}
+		c.Header("Cache-Control", "max-age=10, stale-if-error=60")
+		c.String(http.StatusOK, "articles")
+	})
+
+	ct.do("GET", nil)
+	failing = true
+	ct.advance(30 * time.Second)
+	w := ct.do("GET", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	assert.Equal(t, "articles", w.Body.String())
+
+	// Past the window the error reaches the client
+	ct.advance(time.Minute)
+	w = ct.do("GET", nil)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "upstream down", w.Body.String())
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	var version atomic.Value
+	version.Store("v1")
+	ct := newCacheTest(t, config.RouteCacheConfig{StaleWhileRevalidate: "1m"}, func(c *gin.Context) {
+		c.Header("Cache-Control", "max-age=10")
+		c.String(http.StatusOK, "articles "+version.Load().(string))
+	})
+
+	ct.do("GET", nil)
+	version.Store("v2")
+	ct.advance(30 * time.Second)
+
+	w := ct.do("GET", nil)
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	assert.Equal(t, "articles v1", w.Body.String())
+
+	assert.Eventually(t, func() bool {
+		w := ct.do("GET", nil)
+		return w.Header().Get("X-Cache") == "HIT" && w.Body.String() == "articles v2"
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), ct.calls.Load())
+}
+
+func TestCache_UnsafeMethodsInvalidate(t *testing.T) {
+	ct := newCacheTest(t, config.RouteCacheConfig{}, func(c *gin.Context) {
+		c.Header("Cache-Control", "max-age=60")
+		c.String(http.StatusOK, c.Request.Method)
+	})
+
+	ct.do("GET", nil)
+	assert.Equal(t, "HIT", ct.do("GET", nil).Header().Get("X-Cache"))
+	assert.Equal(t, "POST", ct.do("POST", nil).Body.String())
+	assert.Equal(t, "MISS", ct.do("GET", nil).Header().Get("X-Cache"))
+}
+
+func TestCache_InvalidConfig(t *testing.T) {
+	_, err := Cache(config.RouteCacheConfig{DefaultTTL: "soon"}, cache.NewMemoryStore(1024), nil, logger.New("error"))
+	assert.Error(t, err)
+}
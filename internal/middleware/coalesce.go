@@ -0,0 +1,275 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+// Outcomes of coalesced requests
+const (
+	coalesceLeader  = "leader"
+	coalesceShared  = "shared"
+	coalesceTimeout = "timeout"
+	coalesceRetried = "retried"
+)
+
+var coalescedRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_coalesced_requests_total",
+		Help: "Total number of requests to coalescing routes by outcome",
+	},
+	[]string{"service", "result"},
+)
+
+// coalescer collapses identical concurrent requests into the request of a
+// leader whose response is copied to the others
+type coalescer struct {
+	headers     []string
+	maxWait     time.Duration
+	maxBodySize int64
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is a leader's request in flight
+type coalescedCall struct {
+	done chan struct{}
+	// waiting counts the requests waiting for the response
+	waiting int
+	// response is nil when it couldn't be shared
+	response *sharedResponse
+}
+
+// sharedResponse is a response copied to every waiting request. It is
+// never modified once shared.
+type sharedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	// varied holds the leader's values of the request headers the
+	// response varies on
+	varied http.Header
+}
+
+// Coalesce shares one upstream response between identical concurrent GET
+// and HEAD requests
+func Coalesce(cfg config.CoalesceConfig) (gin.HandlerFunc, error) {
+	co, err := newCoalescer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return co.handle, nil
+}
+
+func newCoalescer(cfg config.CoalesceConfig) (*coalescer, error) {
+	co := &coalescer{
+		maxWait:     5 * time.Second,
+		maxBodySize: cfg.MaxBodySize,
+		calls:       make(map[string]*coalescedCall),
+	}
+	if cfg.MaxWait != "" {
+		maxWait, err := time.ParseDuration(cfg.MaxWait)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max wait: %w", err)
+		}
+		co.maxWait = maxWait
+	}
+	if co.maxBodySize <= 0 {
+		co.maxBodySize = 1 << 20
+	}
+	for _, header := range cfg.Headers {
+		co.headers = append(co.headers, http.CanonicalHeaderKey(header))
+	}
+	return co, nil
+}
+
+func (co *coalescer) handle(c *gin.Context) {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		c.Next()
+		return
+	}
+	service := serviceName(c)
+	key := co.key(c)
+
+	co.mu.Lock()
+	if call, exists := co.calls[key]; exists {
+		call.waiting++
+		co.mu.Unlock()
+		if co.wait(c, call) {
+			return
+		}
+		c.Next()
+		return
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	co.calls[key] = call
+	co.mu.Unlock()
+
+	gatewayHeader := c.Writer.Header().Clone()
+	writer := &sharedWriter{ResponseWriter: c.Writer, limit: co.maxBodySize}
+	c.Writer = writer
+	completed := false
+	defer func() {
+		c.Writer = writer.ResponseWriter
+		// A response cut short by a panic or the leader's client going away
+		// isn't shared, nor is one meant for the leader's client only
+		if completed && !writer.tooLarge && c.Request.Context().Err() == nil {
+			header := upstreamHeader(gatewayHeader, writer.recordedHeader())
+			vary := varyHeaders(header)
+			if shareable(header) && !slices.Contains(vary, "*") {
+				call.response = &sharedResponse{
+					status: c.Writer.Status(),
+					header: header,
+					body:   writer.body.Bytes(),
+					varied: make(http.Header, len(vary)),
+				}
+				for _, name := range vary {
+					call.response.varied[name] = c.Request.Header.Values(name)
+				}
+			}
+		}
+
+		co.mu.Lock()
+		delete(co.calls, key)
+		co.mu.Unlock()
+		close(call.done)
+		coalescedRequests.WithLabelValues(service, coalesceLeader).Inc()
+	}()
+
+	c.Next()
+	completed = true
+}
+
+// wait waits for the leader's response and serves it. It returns false
+// when the request has to be made on its own.
+func (co *coalescer) wait(c *gin.Context, call *coalescedCall) bool {
+	service := serviceName(c)
+	timer := time.NewTimer(co.maxWait)
+	defer timer.Stop()
+
+	select {
+	case <-call.done:
+	case <-timer.C:
+		coalescedRequests.WithLabelValues(service, coalesceTimeout).Inc()
+		return false
+	case <-c.Request.Context().Done():
+		// The client went away
+		c.Abort()
+		return true
+	}
+	if call.response == nil {
+		coalescedRequests.WithLabelValues(service, coalesceRetried).Inc()
+		return false
+	}
+
+	response := call.response
+	// The response may be a different representation than the one asked for
+	for name, values := range response.varied {
+		if !slices.Equal(c.Request.Header.Values(name), values) {
+			coalescedRequests.WithLabelValues(service, coalesceRetried).Inc()
+			return false
+		}
+	}
+	header := c.Writer.Header()
+	for name, values := range response.header {
+		header[name] = append(header[name], values...)
+	}
+	c.Abort()
+	c.Writer.WriteHeader(response.status)
+	if len(response.body) > 0 {
+		c.Writer.Write(response.body)
+	} else {
+		c.Writer.WriteHeaderNow()
+	}
+	coalescedRequests.WithLabelValues(service, coalesceShared).Inc()
+	return true
+}
+
+// key identifies the identical requests of a route
+func (co *coalescer) key(c *gin.Context) string {
+	var b strings.Builder
+	b.WriteString(c.Request.Method)
+	b.WriteString("|")
+	b.WriteString(c.GetString(VersionKey))
+	b.WriteString("|")
+	b.WriteString(strings.ToLower(c.Request.Host))
+	b.WriteString("|")
+	b.WriteString(c.Request.URL.RequestURI())
+	// The upstream may encode the response as the client accepts
+	b.WriteString("|")
+	b.WriteString(strings.Join(c.Request.Header.Values("Accept-Encoding"), ","))
+	for _, name := range co.headers {
+		b.WriteString("|")
+		b.WriteString(strings.Join(c.Request.Header.Values(name), ","))
+	}
+	// Authenticated clients only share responses with themselves
+	b.WriteString("|")
+	if consumer := c.GetString(ConsumerKey); consumer != "" {
+		b.WriteString("consumer:" + consumer)
+	} else if userID, exists := c.Get("userID"); exists && userID != nil {
+		fmt.Fprintf(&b, "user:%v", userID)
+	}
+	return b.String()
+}
+
+// sharedWriter passes the leader's response on while keeping a copy for
+// the waiting requests
+type sharedWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int64
+	tooLarge bool
+	// header is the leader's response header before compression
+	header http.Header
+}
+
+func (w *sharedWriter) WriteHeader(code int) {
+	w.header = w.ResponseWriter.Header().Clone()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sharedWriter) Write(p []byte) (int, error) {
+	if w.header == nil {
+		w.header = w.ResponseWriter.Header().Clone()
+	}
+	if !w.tooLarge {
+		if int64(w.body.Len()+len(p)) <= w.limit {
+			w.body.Write(p)
+		} else {
+			w.tooLarge = true
+			w.body = bytes.Buffer{}
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *sharedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *sharedWriter) Flush() {
+	if w.header == nil {
+		w.header = w.ResponseWriter.Header().Clone()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// recordedHeader returns the header of the response being shared
+func (w *sharedWriter) recordedHeader() http.Header {
+	if w.header != nil {
+		return w.header
+	}
+	return w.ResponseWriter.Header()
+}
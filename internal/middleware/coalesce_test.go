@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+// coalesceTest is a router coalescing requests to a backend that answers
+// once released
+type coalesceTest struct {
+	router    *gin.Engine
+	coalescer *coalescer
+	release   chan struct{}
+	calls     atomic.Int32
+}
+
+func newCoalesceTest(t *testing.T, cfg config.CoalesceConfig) *coalesceTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	co, err := newCoalescer(cfg)
+	require.NoError(t, err)
+	ct := &coalesceTest{router: gin.New(), coalescer: co, release: make(chan struct{})}
+	// X-User stands in for an authenticated user
+	authenticate := func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Set("userID", user)
+		}
+	}
+	ct.router.Any("/*path", Service("users"), authenticate, co.handle, func(c *gin.Context) {
+		n := ct.calls.Add(1)
+		<-ct.release
+		c.Header("X-Upstream-Call", strconv.Itoa(int(n)))
+		if cacheControl := c.Query("cache-control"); cacheControl != "" {
+			c.Header("Cache-Control", cacheControl)
+		}
+		if vary := c.Query("vary"); vary != "" {
+			c.Header("Vary", vary)
+		}
+		if cookie := c.Query("cookie"); cookie != "" {
+			c.Header("Set-Cookie", cookie)
+		}
+		c.String(http.StatusOK, "user %s for %s", c.Param("path"), c.GetHeader("X-Tenant"))
+	})
+	return ct
+}
+
+// waiting returns the number of requests waiting for a response
+func (ct *coalesceTest) waiting() int {
+	ct.coalescer.mu.Lock()
+	defer ct.coalescer.mu.Unlock()
+	total := 0
+	for _, call := range ct.coalescer.calls {
+		total += call.waiting
+	}
+	return total
+}
+
+// send makes requests concurrently, returning their responses once all
+// have completed
+func (ct *coalesceTest) send(reqs ...*http.Request) func() []*httptest.ResponseRecorder {
+	responses := make([]*httptest.ResponseRecorder, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		responses[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder, req *http.Request) {
+			defer wg.Done()
+			ct.router.ServeHTTP(w, req)
+		}(responses[i], req)
+	}
+	return func() []*httptest.ResponseRecorder {
+		wg.Wait()
+		return responses
+	}
+}
+
+func TestCoalesce_SharesOneUpstreamRequest(t *testing.T) {
+	ct := newCoalesceTest(t, config.CoalesceConfig{})
+
+	reqs := make([]*http.Request, 10)
+	for i := range reqs {
+		reqs[i] = httptest.NewRequest("GET", "/42", nil)
+	}
+	wait := ct.send(reqs...)
+	require.Eventually(t, func() bool { return ct.waiting() == 9 }, 2*time.Second, time.Millisecond)
+	close(ct.release)
+
+	for _, w := range wait() {
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "user /42 for ", w.Body.String())
+		assert.Equal(t, []string{"1"}, w.Header().Values("X-Upstream-Call"))
+	}
+	assert.Equal(t, int32(1), ct.calls.Load())
+
+	// Requests after the response has been shared reach the upstream
+	w := httptest.NewRecorder()
+	ct.router.ServeHTTP(w, httptest.NewRequest("GET", "/42", nil))
+	assert.Equal(t, int32(2), ct.calls.Load())
+}
+
+func TestCoalesce_KeyedOnHeaders(t *testing.T) {
+	ct := newCoalesceTest(t, config.CoalesceConfig{Headers: []string{"x-tenant"}})
+
+	request := func(path, tenant string) *http.Request {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Tenant", tenant)
+		return req
+	}
+	wait := ct.send(request("/1", "acme"), request("/1", "acme"), request("/1", "globex"), request("/2", "acme"))
+	require.Eventually(t, func() bool { return ct.waiting() == 1 && ct.calls.Load() == 3 }, 2*time.Second, time.Millisecond)
+	close(ct.release)
+
+	responses := wait()
+	assert.Equal(t, "user /1 for acme", responses[0].Body.String())
+	assert.Equal(t, "user /1 for acme", responses[1].Body.String())
+	assert.Equal(t, "user /1 for globex", responses[2].Body.String())
+	assert.Equal(t, "user /2 for acme", responses[3].Body.String())
+	assert.Equal(t, int32(3), ct.calls.Load())
+}
+
+func TestCoalesce_KeyedOnUser(t *testing.T) {
+	ct := newCoalesceTest(t, config.CoalesceConfig{})
+
+	request := func(user string) *http.Request {
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.Header.Set("X-User", user)
+		return req
+	}
+	wait := ct.send(request("alice"), request("alice"), request("bob"), httptest.NewRequest("GET", "/me", nil))
+	require.Eventually(t, func() bool { return ct.waiting() == 1 && ct.calls.Load() == 3 }, 2*time.Second, time.Millisecond)
+	close(ct.release)
+
+	responses := wait()
+	assert.Equal(t, responses[0].Header().Get("X-Upstream-Call"), responses[1].Header().Get("X-Upstream-Call"))
+	assert.NotEqual(t, responses[0].Header().Get("X-Upstream-Call"), responses[2].Header().Get("X-Upstream-Call"))
+	assert.Equal(t, int32(3), ct.calls.Load())
+}
+
+func TestCoalesce_PrivateResponsesNotShared(t *testing.T) {
+	for _, query := range []string{"cache-control=private", "cache-control=no-store", "cookie=session%3D1"} {
+		t.Run(query, func(t *testing.T) {
+			ct := newCoalesceTest(t, config.CoalesceConfig{})
+
+			path := "/42?" + query
+			wait := ct.send(httptest.NewRequest("GET", path, nil), httptest.NewRequest("GET", path, nil))
+			require.Eventually(t, func() bool { return ct.waiting() == 1 }, 2*time.Second, time.Millisecond)
+			close(ct.release)
+
+			responses := wait()
+			assert.NotEqual(t, responses[0].Header().Get("X-Upstream-Call"), responses[1].Header().Get("X-Upstream-Call"))
+			assert.Equal(t, int32(2), ct.calls.Load())
+		})
+	}
+}
+
+func TestCoalesce_CompressedResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	compress, err := Compress(config.CompressionConfig{Encodings: []string{"gzip"}, MinSize: 16})
+	require.NoError(t, err)
+	co, err := newCoalescer(config.CoalesceConfig{})
+	require.NoError(t, err)
+
+	body := strings.Repeat("compressible ", 10)
+	release := make(chan struct{})
+	var calls atomic.Int32
+	router := gin.New()
+	router.Use(compress)
+	router.GET("/*path", co.handle, func(c *gin.Context) {
+		calls.Add(1)
+		<-release
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(body))
+	})
+
+	gzipped := func() *http.Request {
+		req := httptest.NewRequest("GET", "/42", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		return req
+	}
+	ct := &coalesceTest{router: router, coalescer: co}
+	wait := ct.send(gzipped())
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, 2*time.Second, time.Millisecond)
+	waitGzipped := ct.send(gzipped())
+	require.Eventually(t, func() bool { return ct.waiting() == 1 }, 2*time.Second, time.Millisecond)
+
+	// Requests accepting other encodings aren't identical
+	waitPlain := ct.send(httptest.NewRequest("GET", "/42", nil))
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, 2*time.Second, time.Millisecond)
+	close(release)
+
+	// The waiting request shares the response as the upstream sent it, and
+	// compresses it itself
+	for _, w := range []*httptest.ResponseRecorder{wait()[0], waitGzipped()[0]} {
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		reader, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		plain, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, body, string(plain))
+	}
+	w := waitPlain()[0]
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, w.Body.String())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCoalesce_VariesOnRequestHeaders(t *testing.T) {
+	ct := newCoalesceTest(t, config.CoalesceConfig{})
+
+	request := func(language string) *http.Request {
+		req := httptest.NewRequest("GET", "/42?vary=Accept-Language", nil)
+		req.Header.Set("Accept-Language", language)
+		return req
+	}
+	wait := ct.send(request("en"))
+	require.Eventually(t, func() bool { return ct.calls.Load() == 1 }, 2*time.Second, time.Millisecond)
+	waitOthers := ct.send(request("en"), request("de"))
+	require.Eventually(t, func() bool { return ct.waiting() == 2 }, 2*time.Second, time.Millisecond)
+	close(ct.release)
+
+	// Only the waiting request asking for the same representation shares
+	// the response
+	assert.Equal(t, "1", wait()[0].Header().Get("X-Upstream-Call"))
+	others := waitOthers()
+	assert.Equal(t, "1", others[0].Header().Get("X-Upstream-Call"))
+	assert.Equal(t, "2", others[1].Header().Get("X-Upstream-Call"))
+	assert.Equal(t, int32(2), ct.calls.Load())
+}
+
+func TestCoalesce_MaxWait(t *testing.T) {
+	ct := newCoalesceTest(t, config.CoalesceConfig{MaxWait: "20ms"})
+
+	wait := ct.send(httptest.NewRequest("GET", "/42", nil))
+	require.Eventually(t, func() bool { return ct.calls.Load() == 1 }, 2*time.Second, time.Millisecond)
+
+	// The second request gives up waiting and makes its own
+	waitSecond := ct.send(httptest.NewRequest("GET", "/42", nil))
+	require.Eventually(t, func() bool { return ct.calls.Load() == 2 }, 2*time.Second, time.Millisecond)
+	close(ct.release)
+
+	assert.Equal(t, http.StatusOK, wait()[0].Code)
+	assert.Equal(t, http.StatusOK, waitSecond()[0].Code)
+}
+
+func TestCoalesce_OnlyGetAndHead(t *testing.T) {
+	ct := newCoalesceTest(t, config.CoalesceConfig{})
+
+	wait := ct.send(httptest.NewRequest("POST", "/42", nil), httptest.NewRequest("POST", "/42", nil))
+	require.Eventually(t, func() bool { return ct.calls.Load() == 2 }, 2*time.Second, time.Millisecond)
+	close(ct.release)
+	wait()
+}
+
+func TestCoalesce_LargeResponsesNotShared(t *testing.T) {
+	ct := newCoalesceTest(t, config.CoalesceConfig{MaxBodySize: 4})
+
+	wait := ct.send(httptest.NewRequest("GET", "/42", nil), httptest.NewRequest("GET", "/42", nil))
+	require.Eventually(t, func() bool { return ct.waiting() == 1 }, 2*time.Second, time.Millisecond)
+	close(ct.release)
+
+	for _, w := range wait() {
+		assert.Equal(t, "user /42 for ", w.Body.String())
+	}
+	assert.Equal(t, int32(2), ct.calls.Load())
+}
+
+func TestCoalesce_InvalidConfig(t *testing.T) {
+	_, err := Coalesce(config.CoalesceConfig{MaxWait: "soon"})
+	assert.Error(t, err)
+}
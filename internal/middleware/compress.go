@@ -0,0 +1,397 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+var compressedResponses = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_compressed_responses_total",
+		Help: "Total number of responses compressed by the gateway",
+	},
+	[]string{"service", "encoding"},
+)
+
+// Content codings the gateway compresses with
+const (
+	encodingBrotli = "br"
+	encodingZstd   = "zstd"
+	encodingGzip   = "gzip"
+)
+
+// defaultContentTypes are the media types compressed unless configured
+var defaultContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/javascript",
+	"application/xml",
+	"application/*+xml",
+	"image/svg+xml",
+}
+
+// encoder is a compressor that can be reused for another response
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoders pools the compressors of every encoding
+var encoders = map[string]*sync.Pool{
+	encodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	encodingZstd: {New: func() any {
+		// A single goroutine per encoder keeps flushes synchronous
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return w
+	}},
+	encodingGzip: {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+}
+
+// compressor compresses the responses of clients accepting one of its
+// encodings
+type compressor struct {
+	encodings    []string
+	minSize      int64
+	contentTypes []string
+}
+
+// Compress compresses responses with the encoding the client prefers
+func Compress(cfg config.CompressionConfig) (gin.HandlerFunc, error) {
+	co, err := newCompressor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return co.handle, nil
+}
+
+func newCompressor(cfg config.CompressionConfig) (*compressor, error) {
+	co := &compressor{
+		encodings:    []string{encodingBrotli, encodingZstd, encodingGzip},
+		minSize:      cfg.MinSize,
+		contentTypes: defaultContentTypes,
+	}
+	if len(cfg.Encodings) > 0 {
+		co.encodings = nil
+		for _, encoding := range cfg.Encodings {
+			encoding = strings.ToLower(encoding)
+			if _, exists := encoders[encoding]; !exists {
+				return nil, fmt.Errorf("unknown encoding %q", encoding)
+			}
+			co.encodings = append(co.encodings, encoding)
+		}
+	}
+	if co.minSize <= 0 {
+		co.minSize = 1024
+	}
+	if len(cfg.ContentTypes) > 0 {
+		co.contentTypes = nil
+		for _, pattern := range cfg.ContentTypes {
+			pattern = strings.ToLower(pattern)
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid content type %q: %w", pattern, err)
+			}
+			co.contentTypes = append(co.contentTypes, pattern)
+		}
+	}
+	return co, nil
+}
+
+func (co *compressor) handle(c *gin.Context) {
+	// Upgraded connections and HEAD responses have no body to compress
+	if c.Request.Method == http.MethodHead || c.Request.Header.Get("Upgrade") != "" {
+		c.Next()
+		return
+	}
+
+	writer := &compressWriter{
+		ResponseWriter: c.Writer,
+		compressor:     co,
+		encoding:       negotiateEncoding(c.Request.Header.Values("Accept-Encoding"), co.encodings),
+	}
+	c.Writer = writer
+	defer func() {
+		c.Writer = writer.ResponseWriter
+		writer.finish()
+		if writer.encoder != nil {
+			compressedResponses.WithLabelValues(serviceName(c), writer.encoding).Inc()
+		}
+	}()
+
+	c.Next()
+}
+
+// compressible reports whether a response is of a type to compress
+func (co *compressor) compressible(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	// gRPC has its own message compression, which clients expect instead
+	if strings.HasPrefix(mediaType, "application/grpc") {
+		return false
+	}
+	for _, pattern := range co.contentTypes {
+		if matched, _ := path.Match(pattern, mediaType); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding returns the offered encoding the client prefers, or ""
+func negotiateEncoding(accept []string, offered []string) string {
+	weights := make(map[string]float64)
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(part, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding == "" {
+				continue
+			}
+			if coding == "x-gzip" {
+				coding = encodingGzip
+			}
+			weight := 1.0
+			for _, param := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(name, "q") {
+					if q, err := strconv.ParseFloat(value, 64); err == nil {
+						weight = q
+					}
+				}
+			}
+			weights[coding] = weight
+		}
+	}
+
+	best, bestWeight := "", 0.0
+	for _, encoding := range offered {
+		weight, exists := weights[encoding]
+		if !exists {
+			weight = weights["*"]
+		}
+		if weight > bestWeight {
+			best, bestWeight = encoding, weight
+		}
+	}
+	return best
+}
+
+// compressWriter holds the start of a response back until it knows whether
+// to compress it, then streams the rest through the encoder
+type compressWriter struct {
+	gin.ResponseWriter
+	compressor *compressor
+	// encoding is the encoding the client accepts, if any
+	encoding string
+
+	decided bool
+	pending []byte
+	encoder encoder
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		size := w.contentLength()
+		if size < 0 && int64(len(w.pending)+len(p)) < w.compressor.minSize {
+			w.pending = append(w.pending, p...)
+			return len(p), nil
+		}
+		if err := w.decide(append(w.pending, p...), size); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap returns the writer being compressed to, for http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WriteHeaderNow leaves the header to be written along with the body, when
+// the encoding is known
+func (w *compressWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Flush sends what was written so far, compressing streamed responses of
+// unknown length
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(w.pending, w.contentLength()); err != nil {
+			return
+		}
+	}
+	if w.encoder != nil {
+		if err := w.encoder.Flush(); err != nil {
+			return
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// finish writes the response out once the handlers are done with it
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.decide(w.pending, int64(len(w.pending)))
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+		w.encoder.Reset(nil)
+		encoders[w.encoding].Put(w.encoder)
+	}
+}
+
+// contentLength returns the length of the response, or -1 when unknown
+func (w *compressWriter) contentLength() int64 {
+	size, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// decide picks the encoding of a response of the given size, -1 when
+// unknown, and writes its start
+func (w *compressWriter) decide(start []byte, size int64) error {
+	w.decided = true
+	header := w.Header()
+	// Type the body now, as it can't be sniffed once compressed
+	if _, typed := header["Content-Type"]; !typed && len(start) > 0 {
+		header.Set("Content-Type", http.DetectContentType(start))
+	}
+
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" ||
+		strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-transform") ||
+		!w.compressor.compressible(header) {
+		return w.write(start)
+	}
+
+	addVary(header, "Accept-Encoding")
+	if w.encoding == "" || (size >= 0 && size < w.compressor.minSize) {
+		return w.write(start)
+	}
+
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	// The compressed body is no longer byte for byte the one tagged
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		header.Set("ETag", "W/"+etag)
+	}
+	w.encoder = encoders[w.encoding].Get().(encoder)
+	w.encoder.Reset(w.ResponseWriter)
+	if len(start) == 0 {
+		return nil
+	}
+	_, err := w.encoder.Write(start)
+	return err
+}
+
+// write passes the start of a response on as is
+func (w *compressWriter) write(start []byte) error {
+	w.pending = nil
+	if len(start) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(start)
+	return err
+}
+
+// addVary adds a header to the Vary list unless it is already there
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
+
+// DecompressRequest gunzips request bodies of up to maxSize bytes
+func DecompressRequest(maxSize int64) gin.HandlerFunc {
+	if maxSize <= 0 {
+		maxSize = 10 << 20
+	}
+	return func(c *gin.Context) {
+		encoding := strings.ToLower(strings.TrimSpace(c.Request.Header.Get("Content-Encoding")))
+		if encoding != encodingGzip && encoding != "x-gzip" {
+			c.Next()
+			return
+		}
+
+		body, err := gunzip(c.Request.Body, maxSize)
+		c.Request.Body.Close()
+		switch {
+		case errors.Is(err, errBodyTooLarge):
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid gzip request body"})
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		c.Request.Header.Del("Content-Encoding")
+		c.Next()
+	}
+}
+
+var errBodyTooLarge = errors.New("body too large")
+
+// gunzip decompresses a body of at most maxSize bytes
+func gunzip(body io.Reader, maxSize int64) ([]byte, error) {
+	reader, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	plain, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(plain)) > maxSize {
+		return nil, errBodyTooLarge
+	}
+	return plain, nil
+}
@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+func newCompressRouter(t *testing.T, cfg config.CompressionConfig, handler gin.HandlerFunc) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	compress, err := Compress(cfg)
+	require.NoError(t, err)
+	router := gin.New()
+	router.Any("/*path", compress, handler)
+	return router
+}
+
+// decode returns the plain body of a response
+func decode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var reader io.Reader = w.Body
+	switch w.Header().Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		reader = gz
+	case "br":
+		reader = brotli.NewReader(w.Body)
+	case "zstd":
+		zr, err := zstd.NewReader(w.Body)
+		require.NoError(t, err)
+		defer zr.Close()
+		reader = zr
+	}
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func compressRequest(method, acceptEncoding string) *http.Request {
+	req := httptest.NewRequest(method, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	return req
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	offered := []string{"br", "zstd", "gzip"}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"zstd;q=0.8, gzip;q=0.8", "zstd"},
+		{"x-gzip", "gzip"},
+		{"*", "br"},
+		{"*;q=0.5, br;q=0", "zstd"},
+		{"br;q=0, gzip;q=0", ""},
+		{"identity", ""},
+		{"GZIP ; Q=0.3", "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			var accept []string
+			if tt.accept != "" {
+				accept = []string{tt.accept}
+			}
+			assert.Equal(t, tt.want, negotiateEncoding(accept, offered))
+		})
+	}
+}
+
+func TestCompress_Encodings(t *testing.T) {
+	body := strings.Repeat(`{"name":"gateway"}`, 100)
+	router := newCompressRouter(t, config.CompressionConfig{}, func(c *gin.Context) {
+		c.Header("ETag", `"v1"`)
+		c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(body))
+	})
+
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		t.Run(encoding, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, compressRequest("GET", encoding))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			assert.Equal(t, `W/"v1"`, w.Header().Get("ETag"))
+			assert.Empty(t, w.Header().Get("Content-Length"))
+			assert.Less(t, w.Body.Len(), len(body))
+			assert.Equal(t, body, decode(t, w))
+		})
+	}
+
+	// Clients without Accept-Encoding get the body as is
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, compressRequest("GET", ""))
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, body, w.Body.String())
+}
+
+func TestCompress_Skipped(t *testing.T) {
+	large := strings.Repeat("a", 2048)
+	tests := []struct {
+		name    string
+		method  string
+		handler gin.HandlerFunc
+	}{
+		{"small body", "GET", func(c *gin.Context) {
+			c.String(http.StatusOK, "small")
+		}},
+		{"small content length", "GET", func(c *gin.Context) {
+			c.Header("Content-Length", "5")
+			c.Writer.Write([]byte("sm"))
+			c.Writer.Write([]byte("all"))
+		}},
+		{"content type", "GET", func(c *gin.Context) {
+			c.Data(http.StatusOK, "image/png", []byte(large))
+		}},
+		{"already encoded", "GET", func(c *gin.Context) {
+			c.Header("Content-Encoding", "br")
+			c.Data(http.StatusOK, "text/plain", []byte(large))
+		}},
+		{"no-transform", "GET", func(c *gin.Context) {
+			c.Header("Cache-Control", "public, no-transform")
+			c.Data(http.StatusOK, "text/plain", []byte(large))
+		}},
+		{"grpc", "POST", func(c *gin.Context) {
+			c.Data(http.StatusOK, "application/grpc+json", []byte(large))
+		}},
+		{"partial content", "GET", func(c *gin.Context) {
+			c.Header("Content-Range", "bytes 0-2047/4096")
+			c.Data(http.StatusPartialContent, "text/plain", []byte(large))
+		}},
+		{"head", "HEAD", func(c *gin.Context) {
+			c.Data(http.StatusOK, "text/plain", []byte(large))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newCompressRouter(t, config.CompressionConfig{}, tt.handler)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, compressRequest(tt.method, "gzip"))
+
+			assert.NotEqual(t, "gzip", w.Header().Get("Content-Encoding"))
+			if tt.method != "HEAD" {
+				assert.NotEmpty(t, w.Body.String())
+				assert.NotContains(t, w.Body.String(), "\x1f\x8b")
+			}
+		})
+	}
+}
+
+func TestCompress_SniffsContentType(t *testing.T) {
+	body := "<html><body>" + strings.Repeat("hello ", 300) + "</body></html>"
+	router := newCompressRouter(t, config.CompressionConfig{}, func(c *gin.Context) {
+		c.Writer.Write([]byte(body))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, compressRequest("GET", "gzip"))
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, decode(t, w))
+}
+
+func TestCompress_Streams(t *testing.T) {
+	var flushed int
+	router := newCompressRouter(t, config.CompressionConfig{Encodings: []string{"gzip"}}, func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Writer.WriteString("data: 1\n\n")
+		c.Writer.Flush()
+		// The event is sent before the response is complete
+		flushed = c.Writer.(*compressWriter).ResponseWriter.Size()
+		c.Writer.WriteString("data: 2\n\n")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, compressRequest("GET", "br, gzip"))
+	assert.Greater(t, flushed, 0)
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", decode(t, w))
+}
+
+func TestCompress_InvalidConfig(t *testing.T) {
+	_, err := Compress(config.CompressionConfig{Encodings: []string{"deflate"}})
+	assert.Error(t, err)
+	_, err = Compress(config.CompressionConfig{ContentTypes: []string{"text/["}})
+	assert.Error(t, err)
+}
+
+func gzipped(t *testing.T, body string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return &buf
+}
+
+func TestDecompressRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", DecompressRequest(16), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, "%d %q %s", c.Request.ContentLength, c.GetHeader("Content-Encoding"), body)
+	})
+	send := func(body io.Reader, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", body)
+		req.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(gzipped(t, `{"id":1}`), "gzip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `8 "" {"id":1}`, w.Body.String())
+
+	// Other encodings are passed on
+	w = send(strings.NewReader("plain"), "")
+	assert.Equal(t, `5 "" plain`, w.Body.String())
+	w = send(strings.NewReader("compressed"), "br")
+	assert.Equal(t, `10 "br" compressed`, w.Body.String())
+
+	w = send(gzipped(t, strings.Repeat("a", 17)), "gzip")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = send(strings.NewReader("not gzip"), "gzip")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -3,7 +3,6 @@ package middleware
 
 import (
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,7 +16,7 @@ var (
 			Name: "api_gateway_requests_total",
 			Help: "Total number of requests",
 		},
-		[]string{"service", "method", "status"},
+		[]string{"service", "version", "method", "status"},
 	)
 
 	requestDuration = promauto.NewHistogramVec(
@@ -26,7 +25,7 @@ var (
 			Help:    "Duration of requests in seconds",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"service", "method"},
+		[]string{"service", "version", "method"},
 	)
 )
 
@@ -35,25 +34,15 @@ func Metrics() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 
-		// Get service name from path
-		service := "unknown"
-		path := c.Request.URL.Path
-
-		// Extract service name from path
-		// Assuming format: /api/{service}/...
-		if len(path) > 5 && path[:5] == "/api/" {
-			parts := strings.Split(path[5:], "/")
-			if len(parts) > 0 {
-				service = parts[0]
-			}
-		}
-
 		c.Next()
 
+		// The route tags the service while the request is being handled
+		service := serviceName(c)
+		version := c.GetString(VersionKey)
 		status := strconv.Itoa(c.Writer.Status())
 		duration := time.Since(start).Seconds()
 
-		requestCount.WithLabelValues(service, c.Request.Method, status).Inc()
-		requestDuration.WithLabelValues(service, c.Request.Method).Observe(duration)
+		requestCount.WithLabelValues(service, version, c.Request.Method, status).Inc()
+		requestDuration.WithLabelValues(service, version, c.Request.Method).Observe(duration)
 	}
 }
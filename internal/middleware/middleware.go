@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -9,6 +11,38 @@ import (
 	"github.com/zahidhasann88/api-gateway/pkg/logger"
 )
 
+// ServiceKey is the context key holding the name of the service a route targets
+const ServiceKey = "service"
+
+// VersionKey is the context key holding the version of the service chosen
+// for the request when its traffic is split
+const VersionKey = "version"
+
+// Service tags the request with the service its route targets
+func Service(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ServiceKey, name)
+		c.Next()
+	}
+}
+
+// serviceName returns the service tagged on the request, falling back to
+// the /api/{service}/... path convention for untagged requests
+func serviceName(c *gin.Context) string {
+	if name := c.GetString(ServiceKey); name != "" {
+		return name
+	}
+
+	path := c.Request.URL.Path
+	if strings.HasPrefix(path, "/api/") {
+		parts := strings.Split(path[5:], "/")
+		if len(parts) > 0 && parts[0] != "" {
+			return parts[0]
+		}
+	}
+	return "unknown"
+}
+
 // RequestID adds a unique ID to each request
 func RequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -71,6 +105,13 @@ func CORS(config config.CORSConfig) gin.HandlerFunc {
 		c.Writer.Header().Set("Access-Control-Allow-Methods", joinStrings(config.AllowedMethods))
 		c.Writer.Header().Set("Access-Control-Allow-Headers", joinStrings(config.AllowedHeaders))
 
+		// Browsers only hand gRPC-Web clients the headers listed here
+		if isGRPCWeb(c.Request) {
+			allowed := append(append([]string{}, config.AllowedHeaders...), grpcWebRequestHeaders...)
+			c.Writer.Header().Set("Access-Control-Allow-Headers", joinStrings(allowed))
+			c.Writer.Header().Set("Access-Control-Expose-Headers", joinStrings(grpcWebResponseHeaders))
+		}
+
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -80,6 +121,26 @@ func CORS(config config.CORSConfig) gin.HandlerFunc {
 	}
 }
 
+// Headers gRPC-Web clients send and need to read
+var (
+	grpcWebRequestHeaders  = []string{"Content-Type", "X-Grpc-Web", "X-User-Agent", "Grpc-Timeout"}
+	grpcWebResponseHeaders = []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"}
+)
+
+// isGRPCWeb reports whether a request, or the request a preflight asks
+// about, is a gRPC-Web call
+func isGRPCWeb(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc-web") || r.Header.Get("X-Grpc-Web") != "" {
+		return true
+	}
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if strings.EqualFold(strings.TrimSpace(header), "x-grpc-web") {
+			return true
+		}
+	}
+	return false
+}
+
 func joinStrings(strings []string) string {
 	result := ""
 	for i, s := range strings {
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/ratelimit"
+)
+
+// keyFunc extracts one part of a rate limit key from the request
+type keyFunc func(c *gin.Context) string
+
+// RateLimit limits each client of a service to its RateLimit per second
+func RateLimit(serviceName string, cfg *config.Config, limiter ratelimit.Limiter) (gin.HandlerFunc, error) {
+	serviceConfig, exists := cfg.Services[serviceName]
+	if !exists {
+		return nil, fmt.Errorf("unknown service %q", serviceName)
+	}
+
+	keys, err := rateLimitKeys(serviceConfig.RateLimiter.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	burst := serviceConfig.RateLimiter.Burst
+	if burst < 1 {
+		burst = serviceConfig.RateLimit
+	}
+	defaultLimit := ratelimit.Limit{Rate: float64(serviceConfig.RateLimit), Burst: burst}
+
+	return func(c *gin.Context) {
+		if serviceConfig.RateLimit <= 0 {
+			c.Next()
+			return
+		}
+
+		limit, tier := defaultLimit, "default"
+		if roleLimit, role, ok := roleRateLimit(c, serviceConfig.RateLimiter.Roles); ok {
+			limit, tier = ratelimit.Limit{Rate: float64(roleLimit), Burst: roleLimit}, "role:"+role
+		}
+
+		parts := make([]string, 0, len(keys)+2)
+		parts = append(parts, serviceName, tier)
+		for _, key := range keys {
+			parts = append(parts, key(c))
+		}
+
+		result, err := limiter.Allow(c.Request.Context(), strings.Join(parts, "|"), limit)
+		if err != nil {
+			// Fail open rather than turning a limiter outage into an outage
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			return
+		}
+
+		c.Next()
+	}, nil
+}
+
+// rateLimitKeys parses the configured key parts. Requests are keyed by
+// client IP when none are configured.
+func rateLimitKeys(names []string) ([]keyFunc, error) {
+	if len(names) == 0 {
+		names = []string{"ip"}
+	}
+
+	keys := make([]keyFunc, 0, len(names))
+	for _, name := range names {
+		switch {
+		case name == "ip":
+			keys = append(keys, func(c *gin.Context) string {
+				return "ip:" + c.ClientIP()
+			})
+		case name == "user":
+			// Anonymous requests fall back to the client IP
+			keys = append(keys, func(c *gin.Context) string {
+				if userID, exists := c.Get("userID"); exists && userID != nil {
+					return fmt.Sprintf("user:%v", userID)
+				}
+				return "ip:" + c.ClientIP()
+			})
+		case strings.HasPrefix(name, "header:") && len(name) > len("header:"):
+			header := name[len("header:"):]
+			keys = append(keys, func(c *gin.Context) string {
+				if value := c.GetHeader(header); value != "" {
+					return "header:" + value
+				}
+				return "ip:" + c.ClientIP()
+			})
+		default:
+			return nil, fmt.Errorf("unknown rate limit key %q", name)
+		}
+	}
+	return keys, nil
+}
+
+// roleRateLimit returns the most generous limit among the user's roles
+func roleRateLimit(c *gin.Context, limits map[string]int) (int, string, bool) {
+	if len(limits) == 0 {
+		return 0, "", false
+	}
+	userRoles, exists := c.Get("roles")
+	if !exists {
+		return 0, "", false
+	}
+	roles, ok := userRoles.([]interface{})
+	if !ok {
+		return 0, "", false
+	}
+
+	best, bestRole := 0, ""
+	for _, role := range roles {
+		name, ok := role.(string)
+		if !ok {
+			continue
+		}
+		if limit, exists := limits[strings.ToLower(name)]; exists && limit > best {
+			best, bestRole = limit, name
+		}
+	}
+	return best, bestRole, bestRole != ""
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
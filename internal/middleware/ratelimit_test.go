@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/ratelimit"
+)
+
+func newRateLimitRouter(t *testing.T, serviceConfig config.ServiceConfig, identify gin.HandlerFunc) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{"users": serviceConfig}}
+	limit, err := RateLimit("users", cfg, ratelimit.NewMemoryLimiter(time.Minute))
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/", identify, limit, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func request(router http.Handler, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = remoteAddr
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_PerClientIP(t *testing.T) {
+	router := newRateLimitRouter(t, config.ServiceConfig{RateLimit: 1}, func(c *gin.Context) {})
+
+	w := request(router, "10.0.0.1:1234", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Reset"))
+
+	w = request(router, "10.0.0.1:1234", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// A different client has its own bucket
+	assert.Equal(t, http.StatusOK, request(router, "10.0.0.2:1234", nil).Code)
+}
+
+func TestRateLimit_UserAndHeaderKeys(t *testing.T) {
+	identify := func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Set("userID", user)
+		}
+	}
+	router := newRateLimitRouter(t, config.ServiceConfig{
+		RateLimit:   1,
+		RateLimiter: config.RateLimiterConfig{Keys: []string{"user", "header:X-Tenant"}},
+	}, identify)
+
+	alice := map[string]string{"X-Test-User": "alice", "X-Tenant": "a"}
+	assert.Equal(t, http.StatusOK, request(router, "10.0.0.1:1", alice).Code)
+	// Same user from another address shares the bucket
+	assert.Equal(t, http.StatusTooManyRequests, request(router, "10.0.0.2:1", alice).Code)
+	// Same user under another tenant does not
+	assert.Equal(t, http.StatusOK, request(router, "10.0.0.2:1", map[string]string{"X-Test-User": "alice", "X-Tenant": "b"}).Code)
+}
+
+func TestRateLimit_RoleLimits(t *testing.T) {
+	identify := func(c *gin.Context) {
+		c.Set("userID", "root")
+		c.Set("roles", []interface{}{"user", "admin"})
+	}
+	router := newRateLimitRouter(t, config.ServiceConfig{
+		RateLimit:   1,
+		RateLimiter: config.RateLimiterConfig{Keys: []string{"user"}, Roles: map[string]int{"admin": 3}},
+	}, identify)
+
+	for i := 0; i < 3; i++ {
+		w := request(router, "10.0.0.1:1", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, request(router, "10.0.0.1:1", nil).Code)
+}
+
+func TestRateLimit_InvalidKey(t *testing.T) {
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{
+		"users": {RateLimit: 1, RateLimiter: config.RateLimiterConfig{Keys: []string{"cookie"}}},
+	}}
+	_, err := RateLimit("users", cfg, ratelimit.NewMemoryLimiter(time.Minute))
+	assert.Error(t, err)
+}
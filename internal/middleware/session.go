@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/revocation"
+)
+
+// Claims of the gateway's session tokens
+const (
+	// tokenUseClaim tells refresh tokens from access tokens
+	tokenUseClaim   = "token_use"
+	tokenUseRefresh = "refresh"
+	// sessionClaim holds the ID shared by the tokens of one login
+	sessionClaim = "sid"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for refresh tokens that are
+	// malformed, expired or of a revoked session
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned for refresh tokens used before,
+	// which revokes their session
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	// ErrTokenNotRevocable is returned for tokens without a token or
+	// session ID
+	ErrTokenNotRevocable = errors.New("token has no jti or sid claim")
+)
+
+// Tokens are issued at login and on every refresh
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresIn is the lifetime of the access token
+	ExpiresIn time.Duration
+}
+
+// SessionManager issues access tokens along with single-use refresh tokens
+type SessionManager struct {
+	cfg        config.AuthConfig
+	denylist   revocation.Denylist
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	secrets    []jwt.VerificationKey
+	parser     *jwt.Parser
+	now        func() time.Time
+}
+
+// NewSessionManager signs tokens with the gateway's secret, if any
+func NewSessionManager(cfg config.AuthConfig, denylist revocation.Denylist) (*SessionManager, error) {
+	m := &SessionManager{
+		cfg:        cfg,
+		denylist:   denylist,
+		accessTTL:  15 * time.Minute,
+		refreshTTL: 7 * 24 * time.Hour,
+		now:        time.Now,
+	}
+	var err error
+	if cfg.Expiration != "" {
+		if m.accessTTL, err = time.ParseDuration(cfg.Expiration); err != nil {
+			return nil, fmt.Errorf("invalid expiration: %w", err)
+		}
+	}
+	if cfg.RefreshExpiration != "" {
+		if m.refreshTTL, err = time.ParseDuration(cfg.RefreshExpiration); err != nil {
+			return nil, fmt.Errorf("invalid refresh expiration: %w", err)
+		}
+	}
+	if m.accessTTL <= 0 || m.refreshTTL < m.accessTTL {
+		return nil, errors.New("refresh expiration must be at least the access token expiration")
+	}
+
+	for _, secret := range append([]string{cfg.JWTSecret}, cfg.JWTSecrets...) {
+		if secret != "" {
+			m.secrets = append(m.secrets, []byte(secret))
+		}
+	}
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(hmacMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(func() time.Time { return m.now() }),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	m.parser = jwt.NewParser(options...)
+	return m, nil
+}
+
+// Start opens a session for a user who logged in
+func (m *SessionManager) Start(userID string, roles []string) (*Tokens, error) {
+	return m.issue(userID, roles, uuid.NewString(), m.now().Add(m.refreshTTL))
+}
+
+// Refresh replaces a refresh token with new tokens of its session. The
+// roles of the session are those of the login.
+func (m *SessionManager) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	token, err := m.parser.Parse(refreshToken, func(*jwt.Token) (interface{}, error) {
+		return jwt.VerificationKeySet{Keys: m.secrets}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRefreshToken, err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	id, _ := claims["jti"].(string)
+	session, _ := claims[sessionClaim].(string)
+	if claims[tokenUseClaim] != tokenUseRefresh || id == "" || session == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	expires, err := claims.GetExpirationTime()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRefreshToken, err)
+	}
+
+	userID, _ := claims.GetSubject()
+	issuer := m.cfg.Issuer
+	revoked, err := m.denylist.Contains(ctx, sessionKey(issuer, session))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Every refresh token is used once. Its ID stays on the denylist for
+	// as long as the token is valid.
+	remaining := expires.Sub(m.now())
+	first, err := m.denylist.Add(ctx, usedKey(issuer, id), remaining)
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		// The access tokens refreshed last live beyond the session
+		if _, err := m.denylist.Add(ctx, sessionKey(issuer, session), max(remaining, m.accessTTL)); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: session %s of user %q", ErrRefreshTokenReused, session, userID)
+	}
+
+	var roles []string
+	if list, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range list {
+			if role, ok := role.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return m.issue(userID, roles, session, expires.Time)
+}
+
+// Revoke denies the token for the rest of its lifetime, and the other
+// tokens of its session for as long as the session lasts
+func (m *SessionManager) Revoke(ctx context.Context, identity *Identity) error {
+	id, _ := identity.Claims["jti"].(string)
+	session, _ := identity.Claims[sessionClaim].(string)
+	if id == "" && session == "" {
+		return ErrTokenNotRevocable
+	}
+
+	if id != "" {
+		remaining := m.refreshTTL
+		if expires, err := identity.Claims.GetExpirationTime(); err == nil && expires != nil {
+			remaining = expires.Sub(m.now())
+		}
+		if _, err := m.denylist.Add(ctx, tokenKey(identity.Issuer, id), remaining); err != nil {
+			return err
+		}
+	}
+	if session != "" {
+		if _, err := m.denylist.Add(ctx, sessionKey(identity.Issuer, session), m.refreshTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// issue signs an access token and a refresh token for a session ending at
+// expires
+func (m *SessionManager) issue(userID string, roles []string, session string, expires time.Time) (*Tokens, error) {
+	if m.cfg.JWTSecret == "" {
+		return nil, errors.New("jwt secret is required to sign tokens")
+	}
+	now := m.now()
+	access := tokenClaims(userID, roles, m.cfg, now, m.accessTTL)
+	access[sessionClaim] = session
+	refresh := jwt.MapClaims{
+		"sub":         userID,
+		"roles":       roles,
+		"iss":         m.cfg.Issuer,
+		"exp":         expires.Unix(),
+		"iat":         now.Unix(),
+		"jti":         uuid.NewString(),
+		sessionClaim:  session,
+		tokenUseClaim: tokenUseRefresh,
+	}
+
+	secret := []byte(m.cfg.JWTSecret)
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, access).SignedString(secret)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refresh).SignedString(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: m.accessTTL}, nil
+}
+
+// revocationIDs returns the denylist entries revoking a token
+func revocationIDs(issuer string, claims jwt.MapClaims) []string {
+	var ids []string
+	if id, _ := claims["jti"].(string); id != "" {
+		ids = append(ids, tokenKey(issuer, id))
+	}
+	if session, _ := claims[sessionClaim].(string); session != "" {
+		ids = append(ids, sessionKey(issuer, session))
+	}
+	return ids
+}
+
+func tokenKey(issuer, id string) string {
+	return "token|" + issuer + "|" + id
+}
+
+func sessionKey(issuer, session string) string {
+	return "session|" + issuer + "|" + session
+}
+
+// usedKey marks a refresh token as used
+func usedKey(issuer, id string) string {
+	return "refresh|" + issuer + "|" + id
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+	"github.com/zahidhasann88/api-gateway/pkg/revocation"
+)
+
+func newSessionManager(t *testing.T, cfg config.AuthConfig) (*SessionManager, *TokenVerifier) {
+	t.Helper()
+	denylist := revocation.NewMemoryDenylist()
+	sessions, err := NewSessionManager(cfg, denylist)
+	require.NoError(t, err)
+	verifier, err := NewTokenVerifier(cfg, logger.New("error"))
+	require.NoError(t, err)
+	verifier.UseDenylist(denylist)
+	return sessions, verifier
+}
+
+func TestSessionManager_Refresh(t *testing.T) {
+	sessions, verifier := newSessionManager(t, config.AuthConfig{JWTSecret: "secret", Issuer: "api-gateway", Expiration: "5m"})
+	ctx := context.Background()
+
+	tokens, err := sessions.Start("alice", []string{"admin"})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, tokens.ExpiresIn)
+	first, err := verifier.Verify(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"admin"}, first.Roles)
+
+	// Refresh tokens aren't access tokens
+	_, err = verifier.Verify(ctx, tokens.RefreshToken)
+	assert.Error(t, err)
+	_, err = sessions.Refresh(ctx, tokens.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	refreshed, err := sessions.Refresh(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+	identity, err := verifier.Verify(ctx, refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", identity.UserID)
+	assert.Equal(t, []interface{}{"admin"}, identity.Roles)
+	assert.Equal(t, first.Claims[sessionClaim], identity.Claims[sessionClaim])
+}
+
+func TestSessionManager_ReuseRevokesSession(t *testing.T) {
+	sessions, verifier := newSessionManager(t, config.AuthConfig{JWTSecret: "secret"})
+	ctx := context.Background()
+
+	tokens, err := sessions.Start("alice", nil)
+	require.NoError(t, err)
+	refreshed, err := sessions.Refresh(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+
+	// Replaying the first refresh token revokes every token of the session
+	_, err = sessions.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, err = sessions.Refresh(ctx, refreshed.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	for _, token := range []string{tokens.AccessToken, refreshed.AccessToken} {
+		_, err = verifier.Verify(ctx, token)
+		assert.Error(t, err)
+	}
+
+	// Other sessions of the user are unaffected
+	other, err := sessions.Start("alice", nil)
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, other.AccessToken)
+	assert.NoError(t, err)
+	_, err = sessions.Refresh(ctx, other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestSessionManager_Revoke(t *testing.T) {
+	sessions, verifier := newSessionManager(t, config.AuthConfig{JWTSecret: "secret"})
+	ctx := context.Background()
+
+	tokens, err := sessions.Start("alice", nil)
+	require.NoError(t, err)
+	identity, err := verifier.Verify(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	require.NoError(t, sessions.Revoke(ctx, identity))
+
+	_, err = verifier.Verify(ctx, tokens.AccessToken)
+	assert.Error(t, err)
+	_, err = sessions.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// Tokens outside of sessions are revoked by their ID
+	claims := tokenClaims("bob", nil, config.AuthConfig{}, time.Now(), time.Hour)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	identity, err = verifier.Verify(ctx, token)
+	require.NoError(t, err)
+	require.NoError(t, sessions.Revoke(ctx, identity))
+	_, err = verifier.Verify(ctx, token)
+	assert.Error(t, err)
+
+	assert.ErrorIs(t, sessions.Revoke(ctx, &Identity{Claims: map[string]interface{}{"sub": "carol"}}), ErrTokenNotRevocable)
+}
+
+func TestSessionManager_RefreshExpires(t *testing.T) {
+	sessions, _ := newSessionManager(t, config.AuthConfig{JWTSecret: "secret", Expiration: "1m", RefreshExpiration: "1h"})
+	now := time.Now()
+	sessions.now = func() time.Time { return now }
+
+	tokens, err := sessions.Start("alice", nil)
+	require.NoError(t, err)
+
+	// Refreshing doesn't extend the session
+	now = now.Add(50 * time.Minute)
+	tokens, err = sessions.Refresh(context.Background(), tokens.RefreshToken)
+	require.NoError(t, err)
+	now = now.Add(11 * time.Minute)
+	_, err = sessions.Refresh(context.Background(), tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestNewSessionManager_Invalid(t *testing.T) {
+	for _, cfg := range []config.AuthConfig{
+		{JWTSecret: "secret", Expiration: "soon"},
+		{JWTSecret: "secret", Expiration: "1h", RefreshExpiration: "30m"},
+	} {
+		_, err := NewSessionManager(cfg, revocation.NewMemoryDenylist())
+		assert.Error(t, err)
+	}
+
+	// Without a secret tokens can be revoked but not signed
+	sessions, err := NewSessionManager(config.AuthConfig{}, revocation.NewMemoryDenylist())
+	require.NoError(t, err)
+	_, err = sessions.Start("alice", nil)
+	assert.Error(t, err)
+}
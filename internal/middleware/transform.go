@@ -14,20 +14,8 @@ import (
 // TransformationMiddleware applies request/response transformations
 func TransformationMiddleware(cfg *config.Config, log logger.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Extract service name from path
-		path := c.Request.URL.Path
-		serviceName := "unknown"
-
-		// Assuming format: /api/{service}/...
-		if strings.HasPrefix(path, "/api/") {
-			parts := strings.Split(path[5:], "/")
-			if len(parts) > 0 {
-				serviceName = parts[0]
-			}
-		}
-
 		// Get service config
-		serviceConfig, exists := cfg.Services[serviceName]
+		serviceConfig, exists := cfg.Services[serviceName(c)]
 		if !exists || serviceConfig.Transformations == nil {
 			c.Next()
 			return
@@ -0,0 +1,346 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/jwks"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+	"github.com/zahidhasann88/api-gateway/pkg/revocation"
+)
+
+// Signing algorithms verified with shared secrets and with public keys
+var (
+	hmacMethods   = []string{"HS256", "HS384", "HS512"}
+	publicMethods = []string{
+		"RS256", "RS384", "RS512",
+		"PS256", "PS384", "PS512",
+		"ES256", "ES384", "ES512",
+		"EdDSA",
+	}
+)
+
+// Identity is the user a verified token was issued to
+type Identity struct {
+	Issuer string
+	UserID string
+	// Roles are strings, in the form AuthorizationMiddleware expects them
+	Roles  []interface{}
+	Claims jwt.MapClaims
+}
+
+// TokenVerifier checks tokens with the keys of the issuer they name
+type TokenVerifier struct {
+	issuers map[string]*trustedIssuer
+	// unnamed verifies the tokens of no trusted issuer when the gateway
+	// doesn't name itself
+	unnamed *trustedIssuer
+	// denylist holds the revoked token and session IDs
+	denylist revocation.Denylist
+	log      logger.Logger
+}
+
+// trustedIssuer verifies the tokens of one issuer
+type trustedIssuer struct {
+	name    string
+	secrets []jwt.VerificationKey
+	local   *jwks.Set
+	remote  *jwks.Remote
+	refresh time.Duration
+	parser  *jwt.Parser
+
+	userClaim  string
+	rolesClaim []string
+}
+
+// NewTokenVerifier reads the secrets and key sets of the configuration.
+// Remote key sets are fetched when first needed.
+func NewTokenVerifier(cfg config.AuthConfig, log logger.Logger) (*TokenVerifier, error) {
+	v := &TokenVerifier{issuers: make(map[string]*trustedIssuer), log: log}
+
+	// The gateway's own tokens are only checked when it has keys for them
+	own := config.IssuerConfig{
+		Issuer:      cfg.Issuer,
+		JWKSFile:    cfg.JWKSFile,
+		JWKSURL:     cfg.JWKSURL,
+		JWKSRefresh: cfg.JWKSRefresh,
+		Secrets:     append([]string{cfg.JWTSecret}, cfg.JWTSecrets...),
+		Audience:    cfg.Audience,
+		Leeway:      cfg.Leeway,
+	}
+	issuer, err := newTrustedIssuer(own)
+	if err != nil {
+		return nil, err
+	}
+	if len(issuer.secrets) > 0 || issuer.local != nil || issuer.remote != nil {
+		if cfg.Issuer == "" {
+			v.unnamed = issuer
+		} else {
+			v.issuers[cfg.Issuer] = issuer
+		}
+	}
+
+	for _, issuerConfig := range cfg.Issuers {
+		if issuerConfig.Issuer == "" {
+			return nil, errors.New("trusted issuers must be named")
+		}
+		if _, exists := v.issuers[issuerConfig.Issuer]; exists {
+			return nil, fmt.Errorf("issuer %s is configured twice", issuerConfig.Issuer)
+		}
+		issuer, err := newTrustedIssuer(issuerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("issuer %s: %w", issuerConfig.Issuer, err)
+		}
+		if len(issuer.secrets) == 0 && issuer.local == nil && issuer.remote == nil {
+			return nil, fmt.Errorf("issuer %s: no discovery, key set or secret configured", issuerConfig.Issuer)
+		}
+		v.issuers[issuerConfig.Issuer] = issuer
+	}
+	return v, nil
+}
+
+func newTrustedIssuer(cfg config.IssuerConfig) (*trustedIssuer, error) {
+	issuer := &trustedIssuer{name: cfg.Issuer, userClaim: cfg.UserClaim}
+	for _, secret := range cfg.Secrets {
+		if secret != "" {
+			issuer.secrets = append(issuer.secrets, []byte(secret))
+		}
+	}
+
+	if cfg.JWKSFile != "" {
+		data, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading key set: %w", err)
+		}
+		if issuer.local, err = jwks.Parse(data); err != nil {
+			return nil, fmt.Errorf("key set %s: %w", cfg.JWKSFile, err)
+		}
+	}
+	switch {
+	case cfg.Discovery && cfg.JWKSURL != "":
+		return nil, errors.New("discovery and a key set URL can't both be configured")
+	case cfg.Discovery:
+		issuer.remote = jwks.NewDiscovered(cfg.Issuer, nil)
+	case cfg.JWKSURL != "":
+		issuer.remote = jwks.NewRemote(cfg.JWKSURL, nil)
+	}
+	refresh, err := config.ParseDuration(cfg.JWKSRefresh, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key set refresh: %w", err)
+	}
+	if issuer.refresh = refresh; refresh <= 0 {
+		issuer.refresh = 15 * time.Minute
+	}
+
+	methods := cfg.Algorithms
+	if len(methods) == 0 {
+		if len(issuer.secrets) > 0 {
+			methods = append(methods, hmacMethods...)
+		}
+		if issuer.local != nil || issuer.remote != nil {
+			methods = append(methods, publicMethods...)
+		}
+	}
+	for _, method := range methods {
+		if jwt.GetSigningMethod(method) == nil || method == "none" {
+			return nil, fmt.Errorf("unknown algorithm %q", method)
+		}
+	}
+	leeway, err := config.ParseDuration(cfg.Leeway, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid leeway: %w", err)
+	}
+	options := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithLeeway(leeway)}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if len(cfg.Audience) > 0 {
+		options = append(options, jwt.WithAudience(cfg.Audience...))
+	}
+	issuer.parser = jwt.NewParser(options...)
+
+	if issuer.userClaim == "" {
+		issuer.userClaim = "sub"
+	}
+	rolesClaim := cfg.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	issuer.rolesClaim = strings.Split(rolesClaim, ".")
+	return issuer, nil
+}
+
+// Start refreshes the remote key sets until ctx is done
+func (v *TokenVerifier) Start(ctx context.Context) {
+	issuers := make([]*trustedIssuer, 0, len(v.issuers)+1)
+	for _, issuer := range v.issuers {
+		issuers = append(issuers, issuer)
+	}
+	if v.unnamed != nil {
+		issuers = append(issuers, v.unnamed)
+	}
+
+	for _, issuer := range issuers {
+		if issuer.remote == nil {
+			continue
+		}
+		go func(issuer *trustedIssuer) {
+			ticker := time.NewTicker(issuer.refresh)
+			defer ticker.Stop()
+			for {
+				if err := issuer.remote.Refresh(ctx); err != nil && ctx.Err() == nil {
+					v.log.Warn("Failed to refresh key set", "issuer", issuer.name, "url", issuer.remote.URL(), "error", err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(issuer)
+	}
+}
+
+// UseDenylist rejects tokens once their ID or session is on the denylist
+func (v *TokenVerifier) UseDenylist(denylist revocation.Denylist) {
+	v.denylist = denylist
+}
+
+// Verify checks a token and returns who it was issued to
+func (v *TokenVerifier) Verify(ctx context.Context, tokenString string) (*Identity, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
+	name, _ := unverified.Claims.GetIssuer()
+	issuer, exists := v.issuers[name]
+	if !exists {
+		if v.unnamed == nil {
+			return nil, fmt.Errorf("untrusted issuer %q", name)
+		}
+		issuer = v.unnamed
+	}
+
+	token, err := issuer.parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return issuer.keys(ctx, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims[tokenUseClaim] == tokenUseRefresh {
+		return nil, errors.New("refresh tokens can't be used as access tokens")
+	}
+	if v.denylist != nil {
+		revoked, err := v.denylist.Contains(ctx, revocationIDs(name, claims)...)
+		if err != nil {
+			return nil, fmt.Errorf("checking revocations: %w", err)
+		}
+		if revoked {
+			return nil, errors.New("token revoked")
+		}
+	}
+	return &Identity{
+		Issuer: name,
+		UserID: issuer.user(claims),
+		Roles:  issuer.roles(claims),
+		Claims: claims,
+	}, nil
+}
+
+// keys returns the keys that may have signed the token
+func (i *trustedIssuer) keys(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(i.secrets) == 0 {
+			return nil, errors.New("no secret configured")
+		}
+		return jwt.VerificationKeySet{Keys: i.secrets}, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	candidates := i.local.Find(kid)
+	if len(candidates) == 0 && i.remote != nil {
+		var err error
+		if candidates, err = i.remote.Find(ctx, kid); err != nil {
+			return nil, err
+		}
+	}
+
+	var keys []jwt.VerificationKey
+	for _, key := range candidates {
+		if verifies(token.Method, key) {
+			keys = append(keys, key.Public)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no %s key %q", token.Method.Alg(), kid)
+	}
+	return jwt.VerificationKeySet{Keys: keys}, nil
+}
+
+// user returns the user ID claim
+func (i *trustedIssuer) user(claims jwt.MapClaims) string {
+	switch user := claims[i.userClaim].(type) {
+	case nil:
+		return ""
+	case string:
+		return user
+	default:
+		return fmt.Sprint(user)
+	}
+}
+
+// roles returns the roles claim, following its path through nested claims
+func (i *trustedIssuer) roles(claims jwt.MapClaims) []interface{} {
+	var value interface{} = map[string]interface{}(claims)
+	for _, name := range i.rolesClaim {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	switch value := value.(type) {
+	case []interface{}:
+		return value
+	case string:
+		var roles []interface{}
+		for _, role := range strings.Fields(value) {
+			roles = append(roles, role)
+		}
+		return roles
+	default:
+		return nil
+	}
+}
+
+// verifies reports whether a key can verify signatures of the method
+func verifies(method jwt.SigningMethod, key jwks.Key) bool {
+	if key.Algorithm != "" && key.Algorithm != method.Alg() {
+		return false
+	}
+	switch method := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.Public.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		public, ok := key.Public.(*ecdsa.PublicKey)
+		return ok && public.Curve.Params().BitSize == method.CurveBits
+	case *jwt.SigningMethodEd25519:
+		_, ok := key.Public.(ed25519.PublicKey)
+		return ok
+	default:
+		return false
+	}
+}
@@ -0,0 +1,281 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// signingKey is a private key with the kid of its public key
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+func newSigningKeys(t *testing.T) map[string]signingKey {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return map[string]signingKey{
+		"RS256": {"rsa-1", jwt.SigningMethodRS256, rsaKey},
+		"PS256": {"rsa-1", jwt.SigningMethodPS256, rsaKey},
+		"ES256": {"ec-1", jwt.SigningMethodES256, ecKey},
+		"EdDSA": {"ed-1", jwt.SigningMethodEdDSA, edKey},
+	}
+}
+
+// keySet encodes the public keys as a JSON Web Key Set
+func keySet(t *testing.T, keys ...signingKey) []byte {
+	t.Helper()
+	encode := base64.RawURLEncoding.EncodeToString
+	var jwks []map[string]string
+	for _, key := range keys {
+		jwk := map[string]string{"kid": key.id}
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk["kty"], jwk["n"], jwk["e"] = "RSA", encode(public.N.Bytes()), encode(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			jwk["kty"], jwk["crv"] = "EC", "P-256"
+			jwk["x"], jwk["y"] = encode(public.X.FillBytes(make([]byte, 32))), encode(public.Y.FillBytes(make([]byte, 32)))
+		case ed25519.PublicKey:
+			jwk["kty"], jwk["crv"], jwk["x"] = "OKP", "Ed25519", encode(public)
+		}
+		jwks = append(jwks, jwk)
+	}
+	data, err := json.Marshal(map[string]interface{}{"keys": jwks})
+	require.NoError(t, err)
+	return data
+}
+
+func sign(t *testing.T, key signingKey, subject string) string {
+	t.Helper()
+	return signClaims(t, key, jwt.MapClaims{
+		"sub":   subject,
+		"roles": []string{"user"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+}
+
+func signClaims(t *testing.T, key signingKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	signed, err := token.SignedString(key.private)
+	require.NoError(t, err)
+	return signed
+}
+
+func signHMAC(t *testing.T, secret string) string {
+	t.Helper()
+	return signHMACClaims(t, secret, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+}
+
+func signHMACClaims(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return signed
+}
+
+// authenticate sends a request with the token through JWTAuthMiddleware
+func authenticate(t *testing.T, auth config.AuthConfig, verifier *TokenVerifier, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{Auth: auth}
+	cfg.Auth.Enabled = true
+	router := gin.New()
+	router.GET("/", JWTAuthMiddleware(cfg, verifier), func(c *gin.Context) {
+		roles, _ := c.Get("roles")
+		c.String(http.StatusOK, "%s %v", c.GetString("userID"), roles)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTokenVerifier_KeySetFile(t *testing.T) {
+	keys := newSigningKeys(t)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, keySet(t, keys["RS256"], keys["ES256"], keys["EdDSA"]), 0o600))
+
+	auth := config.AuthConfig{JWKSFile: file}
+	verifier, err := NewTokenVerifier(auth, logger.New("error"))
+	require.NoError(t, err)
+
+	for alg, key := range keys {
+		t.Run(alg, func(t *testing.T) {
+			w := authenticate(t, auth, verifier, sign(t, key, "alice"))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "alice [user]", w.Body.String())
+		})
+	}
+
+	// Keys only verify the algorithms of their type
+	confused := keys["ES256"]
+	confused.id = "rsa-1"
+	assert.Equal(t, http.StatusUnauthorized, authenticate(t, auth, verifier, sign(t, confused, "alice")).Code)
+
+	// HMAC tokens aren't accepted without a secret
+	assert.Equal(t, http.StatusUnauthorized, authenticate(t, auth, verifier, signHMAC(t, "")).Code)
+}
+
+func TestTokenVerifier_KeySetURL(t *testing.T) {
+	keys := newSigningKeys(t)
+	var mu sync.Mutex
+	served := keySet(t, keys["RS256"])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(served)
+	}))
+	defer server.Close()
+
+	auth := config.AuthConfig{JWKSURL: server.URL}
+	verifier, err := NewTokenVerifier(auth, logger.New("error"))
+	require.NoError(t, err)
+	verifier.unnamed.remote.MinInterval = 0
+
+	assert.Equal(t, http.StatusOK, authenticate(t, auth, verifier, sign(t, keys["RS256"], "alice")).Code)
+	assert.Equal(t, http.StatusUnauthorized, authenticate(t, auth, verifier, sign(t, keys["EdDSA"], "alice")).Code)
+
+	// Rotated keys are picked up as tokens name them
+	mu.Lock()
+	served = keySet(t, keys["EdDSA"])
+	mu.Unlock()
+	assert.Equal(t, http.StatusOK, authenticate(t, auth, verifier, sign(t, keys["EdDSA"], "alice")).Code)
+}
+
+func TestTokenVerifier_RotatedSecrets(t *testing.T) {
+	auth := config.AuthConfig{JWTSecret: "new", JWTSecrets: []string{"old"}}
+	verifier, err := NewTokenVerifier(auth, logger.New("error"))
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, authenticate(t, auth, verifier, signHMAC(t, "new")).Code)
+	assert.Equal(t, http.StatusOK, authenticate(t, auth, verifier, signHMAC(t, "old")).Code)
+	assert.Equal(t, http.StatusUnauthorized, authenticate(t, auth, verifier, signHMAC(t, "other")).Code)
+
+	// Public key algorithms aren't accepted without key sets
+	keys := newSigningKeys(t)
+	assert.Equal(t, http.StatusUnauthorized, authenticate(t, auth, verifier, sign(t, keys["EdDSA"], "alice")).Code)
+}
+
+func TestTokenVerifier_Issuers(t *testing.T) {
+	keys := newSigningKeys(t)
+	mux := http.NewServeMux()
+	idp := httptest.NewServer(mux)
+	defer idp.Close()
+	mux.HandleFunc("/realms/corp/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   idp.URL + "/realms/corp",
+			"jwks_uri": idp.URL + "/realms/corp/certs",
+		})
+	})
+	mux.HandleFunc("/realms/corp/certs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(keySet(t, keys["RS256"]))
+	})
+	corp := idp.URL + "/realms/corp"
+
+	auth := config.AuthConfig{
+		JWTSecret: "gateway-secret",
+		Issuer:    "api-gateway",
+		Issuers: []config.IssuerConfig{
+			{
+				Issuer:     corp,
+				Discovery:  true,
+				Audience:   []string{"gateway"},
+				Algorithms: []string{"RS256"},
+				UserClaim:  "preferred_username",
+				RolesClaim: "realm_access.roles",
+			},
+			{Issuer: "https://partner.example.com", Secrets: []string{"partner-secret"}, RolesClaim: "groups", Leeway: "30s"},
+		},
+	}
+	verifier, err := NewTokenVerifier(auth, logger.New("error"))
+	require.NoError(t, err)
+
+	expires := time.Now().Add(time.Hour).Unix()
+	corpClaims := func(audience string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": corp, "aud": audience, "sub": "f81d4fae", "exp": expires,
+			"preferred_username": "alice",
+			"realm_access":       map[string]interface{}{"roles": []string{"admin", "user"}},
+		}
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"discovered issuer", signClaims(t, keys["RS256"], corpClaims("gateway")), "alice [admin user]"},
+		{"wrong audience", signClaims(t, keys["RS256"], corpClaims("billing")), ""},
+		{"disallowed algorithm", signClaims(t, keys["PS256"], corpClaims("gateway")), ""},
+		{"gateway", signHMACClaims(t, "gateway-secret", jwt.MapClaims{"iss": "api-gateway", "sub": "bob", "roles": []string{"user"}, "exp": expires}), "bob [user]"},
+		{"gateway without issuer", signHMACClaims(t, "gateway-secret", jwt.MapClaims{"sub": "bob", "exp": expires}), ""},
+		{"partner", signHMACClaims(t, "partner-secret", jwt.MapClaims{"iss": "https://partner.example.com", "sub": "carol", "groups": "billing reports", "exp": expires}), "carol [billing reports]"},
+		{"partner within leeway", signHMACClaims(t, "partner-secret", jwt.MapClaims{"iss": "https://partner.example.com", "sub": "carol", "exp": time.Now().Add(-10 * time.Second).Unix()}), "carol []"},
+		{"partner signed by gateway", signHMACClaims(t, "gateway-secret", jwt.MapClaims{"iss": "https://partner.example.com", "sub": "carol", "exp": expires}), ""},
+		{"untrusted issuer", signHMACClaims(t, "gateway-secret", jwt.MapClaims{"iss": "https://evil.example.com", "sub": "mallory", "exp": expires}), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := authenticate(t, auth, verifier, tt.token)
+			if tt.want == "" {
+				assert.Equal(t, http.StatusUnauthorized, w.Code)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+func TestTokenVerifier_InvalidConfig(t *testing.T) {
+	_, err := NewTokenVerifier(config.AuthConfig{JWKSFile: "missing.json"}, logger.New("error"))
+	assert.Error(t, err)
+	_, err = NewTokenVerifier(config.AuthConfig{JWKSURL: "http://idp", JWKSRefresh: "hourly"}, logger.New("error"))
+	assert.Error(t, err)
+
+	for name, issuer := range map[string]config.IssuerConfig{
+		"unnamed":    {Secrets: []string{"secret"}},
+		"no keys":    {Issuer: "https://idp"},
+		"algorithm":  {Issuer: "https://idp", Secrets: []string{"secret"}, Algorithms: []string{"none"}},
+		"leeway":     {Issuer: "https://idp", Secrets: []string{"secret"}, Leeway: "a bit"},
+		"key set":    {Issuer: "https://idp", Discovery: true, JWKSURL: "https://idp/keys"},
+		"duplicated": {Issuer: "api-gateway", Secrets: []string{"secret"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			auth := config.AuthConfig{JWTSecret: "secret", Issuer: "api-gateway", Issuers: []config.IssuerConfig{issuer}}
+			_, err := NewTokenVerifier(auth, logger.New("error"))
+			assert.Error(t, err)
+		})
+	}
+}
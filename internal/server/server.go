@@ -6,6 +6,8 @@ import (
     "time"
     
     "github.com/gin-gonic/gin"
+    "golang.org/x/net/http2"
+    "golang.org/x/net/http2/h2c"
     "github.com/zahidhasann88/api-gateway/internal/config"
     "github.com/zahidhasann88/api-gateway/pkg/logger"
 )
@@ -26,9 +28,14 @@ func New(cfg *config.Config, log logger.Logger) *Server {
     
     router := gin.New()
     
+    // Accept cleartext HTTP/2 so gRPC clients can connect without TLS
+    handler := h2c.NewHandler(router, &http2.Server{
+        IdleTimeout: time.Duration(cfg.Proxy.IdleTimeout) * time.Second,
+    })
+    
     server := &http.Server{
         Addr:         cfg.Server.Address,
-        Handler:      router,
+        Handler:      handler,
         ReadTimeout:  time.Duration(cfg.Proxy.ReadTimeout) * time.Second,
         WriteTimeout: time.Duration(cfg.Proxy.WriteTimeout) * time.Second,
         IdleTimeout:  time.Duration(cfg.Proxy.IdleTimeout) * time.Second,
@@ -82,6 +89,11 @@ func (s *Server) OPTIONS(path string, handlers ...gin.HandlerFunc) {
     s.router.OPTIONS(path, handlers...)
 }
 
+// Handle registers a route for the given HTTP method
+func (s *Server) Handle(method, path string, handlers ...gin.HandlerFunc) {
+    s.router.Handle(method, path, handlers...)
+}
+
 // Any registers a route that matches all HTTP methods
 func (s *Server) Any(path string, handlers ...gin.HandlerFunc) {
     s.router.Any(path, handlers...)
@@ -97,8 +109,22 @@ func (s *Server) Group(path string, handlers ...gin.HandlerFunc) *gin.RouterGrou
     return s.router.Group(path, handlers...)
 }
 
-// Start starts the HTTP server
+// ServeHTTP dispatches a request to the router, accepting h2c like the
+// listener does
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.server.Handler.ServeHTTP(w, r)
+}
+
+// OnShutdown registers a function to call when the server shuts down
+func (s *Server) OnShutdown(f func()) {
+    s.server.RegisterOnShutdown(f)
+}
+
+// Start starts the HTTP server, serving TLS when a certificate is configured
 func (s *Server) Start() error {
+    if s.config.Server.TLSCertFile != "" && s.config.Server.TLSKeyFile != "" {
+        return s.server.ListenAndServeTLS(s.config.Server.TLSCertFile, s.config.Server.TLSKeyFile)
+    }
     return s.server.ListenAndServe()
 }
 
@@ -0,0 +1,89 @@
+package transcoding
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxMessageSize bounds the gRPC messages read from upstreams
+const maxMessageSize = 16 << 20
+
+// compressedFlag marks a compressed gRPC message
+const compressedFlag = 1
+
+var ErrCompressed = errors.New("compressed gRPC messages are not supported")
+
+// Frame prefixes a message with the gRPC length-prefixed framing
+func Frame(message []byte) []byte {
+	frame := make([]byte, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(message)))
+	copy(frame[5:], message)
+	return frame
+}
+
+// ReadFrame reads one length-prefixed message. It returns the frame's flags
+// byte along with the message, and io.EOF when there are no more messages.
+func ReadFrame(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, fmt.Errorf("truncated gRPC frame header")
+		}
+		return 0, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxMessageSize {
+		return 0, nil, fmt.Errorf("gRPC message of %d bytes exceeds %d", length, maxMessageSize)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return 0, nil, fmt.Errorf("truncated gRPC message: %w", err)
+	}
+	return header[0], message, nil
+}
+
+// ReadMessage reads a single uncompressed message
+func ReadMessage(r io.Reader) ([]byte, error) {
+	flags, message, err := ReadFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	if flags&compressedFlag != 0 {
+		return nil, ErrCompressed
+	}
+	return message, nil
+}
+
+// grpcToHTTP maps gRPC status codes to HTTP statuses, following
+// https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto
+var grpcToHTTP = []int{
+	http.StatusOK,                  // OK
+	499,                            // CANCELLED
+	http.StatusInternalServerError, // UNKNOWN
+	http.StatusBadRequest,          // INVALID_ARGUMENT
+	http.StatusGatewayTimeout,      // DEADLINE_EXCEEDED
+	http.StatusNotFound,            // NOT_FOUND
+	http.StatusConflict,            // ALREADY_EXISTS
+	http.StatusForbidden,           // PERMISSION_DENIED
+	http.StatusTooManyRequests,     // RESOURCE_EXHAUSTED
+	http.StatusBadRequest,          // FAILED_PRECONDITION
+	http.StatusConflict,            // ABORTED
+	http.StatusBadRequest,          // OUT_OF_RANGE
+	http.StatusNotImplemented,      // UNIMPLEMENTED
+	http.StatusInternalServerError, // INTERNAL
+	http.StatusServiceUnavailable,  // UNAVAILABLE
+	http.StatusInternalServerError, // DATA_LOSS
+	http.StatusUnauthorized,        // UNAUTHENTICATED
+}
+
+// HTTPStatus returns the HTTP status for a gRPC status code
+func HTTPStatus(code int) int {
+	if code < 0 || code >= len(grpcToHTTP) {
+		return http.StatusInternalServerError
+	}
+	return grpcToHTTP[code]
+}
@@ -0,0 +1,268 @@
+package transcoding
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// RequestError is a problem with the HTTP request being transcoded
+type RequestError struct {
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func requestError(format string, args ...interface{}) error {
+	return &RequestError{Err: fmt.Errorf(format, args...)}
+}
+
+// NewRequest builds the gRPC request message from the HTTP body, the path
+// variables and the query parameters, in increasing order of precedence
+func (b *Binding) NewRequest(vars map[string]string, query url.Values, body []byte) (proto.Message, error) {
+	input := b.Method.Input()
+	msg := dynamicpb.NewMessage(input)
+
+	body = bytes.TrimSpace(body)
+	bound := make(map[string]bool)
+	switch {
+	case b.body == "*":
+		if len(body) > 0 {
+			if err := protojson.Unmarshal(body, msg); err != nil {
+				return nil, requestError("invalid request body: %v", err)
+			}
+		}
+	case b.body != "":
+		bound[b.body] = true
+		if len(body) > 0 {
+			field := input.Fields().ByName(protoreflect.Name(b.body))
+			if err := unmarshalField(msg, field, body); err != nil {
+				return nil, requestError("invalid request body: %v", err)
+			}
+		}
+	}
+
+	for variable, value := range vars {
+		bound[variable] = true
+		if err := setField(msg, variable, []string{value}); err != nil {
+			return nil, requestError("invalid path parameter %s: %v", variable, err)
+		}
+	}
+
+	// Query parameters fill the fields not bound to the path or the body
+	if b.body != "*" {
+		for name, values := range query {
+			if isBound(bound, name) {
+				continue
+			}
+			if _, err := fieldPath(input, name); err != nil {
+				// Unknown parameters are left for the gateway and proxies
+				continue
+			}
+			if err := setField(msg, name, values); err != nil {
+				return nil, requestError("invalid query parameter %s: %v", name, err)
+			}
+		}
+	}
+
+	return msg, nil
+}
+
+// isBound reports whether a field path is, or is inside, a bound field
+func isBound(bound map[string]bool, path string) bool {
+	for prefix := range bound {
+		if path == prefix || strings.HasPrefix(path, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalResponse converts a serialized gRPC response message to JSON
+func (b *Binding) MarshalResponse(data []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(b.Method.Output())
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	if b.responseBody == "" {
+		return protojson.Marshal(msg)
+	}
+
+	// Marshal the enclosing message and pick the field so that every field
+	// kind is rendered the way protojson renders it
+	field := msg.Descriptor().Fields().ByName(protoreflect.Name(b.responseBody))
+	wrapper := dynamicpb.NewMessage(msg.Descriptor())
+	options := protojson.MarshalOptions{}
+	if msg.Has(field) {
+		wrapper.Set(field, msg.Get(field))
+	} else {
+		// Render the field's zero value instead of leaving the body empty
+		options.EmitUnpopulated = true
+	}
+	encoded, err := options.Marshal(wrapper)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	return fields[field.JSONName()], nil
+}
+
+// fieldPath resolves a dotted field path, accepting proto and JSON names
+func fieldPath(msg protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, error) {
+	var fields []protoreflect.FieldDescriptor
+	for i, name := range strings.Split(path, ".") {
+		if msg == nil {
+			return nil, fmt.Errorf("field path %q: %s is not a message", path, fields[i-1].Name())
+		}
+		field := msg.Fields().ByName(protoreflect.Name(name))
+		if field == nil {
+			field = msg.Fields().ByJSONName(name)
+		}
+		if field == nil {
+			return nil, fmt.Errorf("field path %q: unknown field %q in %s", path, name, msg.FullName())
+		}
+		fields = append(fields, field)
+		msg = nil
+		if field.Kind() == protoreflect.MessageKind && !field.IsList() && !field.IsMap() {
+			msg = field.Message()
+		}
+	}
+	return fields, nil
+}
+
+// setField sets the field at path from its string form. Repeated fields
+// take every value.
+func setField(msg protoreflect.Message, path string, values []string) error {
+	fields, err := fieldPath(msg.Descriptor(), path)
+	if err != nil {
+		return err
+	}
+	for _, field := range fields[:len(fields)-1] {
+		msg = msg.Mutable(field).Message()
+	}
+
+	field := fields[len(fields)-1]
+	switch {
+	case field.IsMap():
+		return fmt.Errorf("map fields can't be set from strings")
+	case field.IsList():
+		list := msg.Mutable(field).List()
+		for _, value := range values {
+			v, err := parseValue(msg, field, value)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+		return nil
+	default:
+		if len(values) == 0 {
+			return nil
+		}
+		v, err := parseValue(msg, field, values[len(values)-1])
+		if err != nil {
+			return err
+		}
+		msg.Set(field, v)
+		return nil
+	}
+}
+
+// parseValue parses the string form of a single field value
+func parseValue(msg protoreflect.Message, field protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BytesKind:
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			decoded, err = base64.URLEncoding.DecodeString(value)
+		}
+		return protoreflect.ValueOfBytes(decoded), err
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByName(protoreflect.Name(value)); enumValue != nil {
+			return protoreflect.ValueOfEnum(enumValue.Number()), nil
+		}
+		v, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), err
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		// Well-known types such as Timestamp and the wrappers have a JSON
+		// string form
+		quoted, err := json.Marshal(value)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		element := msg.NewField(field)
+		if field.IsList() {
+			element = protoreflect.ValueOfMessage(dynamicpb.NewMessage(field.Message()))
+		}
+		if err := protojson.Unmarshal(quoted, element.Message().Interface()); err != nil {
+			return protoreflect.Value{}, err
+		}
+		return element, nil
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", field.Kind())
+}
+
+// unmarshalField decodes a JSON value into a single field of msg
+func unmarshalField(msg protoreflect.Message, field protoreflect.FieldDescriptor, body []byte) error {
+	key, err := json.Marshal(field.JSONName())
+	if err != nil {
+		return err
+	}
+	wrapped := make([]byte, 0, len(body)+len(key)+3)
+	wrapped = append(wrapped, '{')
+	wrapped = append(wrapped, key...)
+	wrapped = append(wrapped, ':')
+	wrapped = append(wrapped, body...)
+	wrapped = append(wrapped, '}')
+
+	holder := dynamicpb.NewMessage(msg.Descriptor())
+	if err := protojson.Unmarshal(wrapped, holder); err != nil {
+		return err
+	}
+	if holder.Has(field) {
+		msg.Set(field, holder.Get(field))
+	}
+	return nil
+}
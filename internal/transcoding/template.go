@@ -0,0 +1,185 @@
+package transcoding
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Kinds of path template segments
+const (
+	literalSegment = iota
+	singleWildcard
+	multiWildcard
+)
+
+// segment is one element of a path template. Segments that belong to a
+// variable carry its field path.
+type segment struct {
+	kind     int
+	literal  string
+	variable string
+}
+
+// pathTemplate is a parsed google.api.http path template such as
+// /v1/{name=shelves/*}/books/{book}:publish
+type pathTemplate struct {
+	segments  []segment
+	verb      string
+	variables []string
+}
+
+// parseTemplate parses a path template
+func parseTemplate(template string) (*pathTemplate, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("path template %q must start with /", template)
+	}
+
+	parsed := &pathTemplate{}
+	rest := template[1:]
+
+	// The verb follows the last segment, outside of any variable
+	if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.ContainsAny(rest[i:], "/}") {
+		parsed.verb = rest[i+1:]
+		rest = rest[:i]
+	}
+
+	for len(rest) > 0 {
+		var part string
+		if strings.HasPrefix(rest, "{") {
+			end := strings.Index(rest, "}")
+			if end < 0 {
+				return nil, fmt.Errorf("path template %q: unterminated variable", template)
+			}
+			part, rest = rest[1:end], rest[end+1:]
+
+			variable, pattern := part, "*"
+			if i := strings.Index(part, "="); i >= 0 {
+				variable, pattern = part[:i], part[i+1:]
+			}
+			if variable == "" {
+				return nil, fmt.Errorf("path template %q: empty variable name", template)
+			}
+			for _, p := range strings.Split(pattern, "/") {
+				seg, err := parseSegment(p)
+				if err != nil {
+					return nil, fmt.Errorf("path template %q: %w", template, err)
+				}
+				seg.variable = variable
+				parsed.segments = append(parsed.segments, seg)
+			}
+			parsed.variables = append(parsed.variables, variable)
+		} else {
+			end := strings.Index(rest, "/")
+			if end < 0 {
+				end = len(rest)
+			}
+			part, rest = rest[:end], rest[end:]
+			seg, err := parseSegment(part)
+			if err != nil {
+				return nil, fmt.Errorf("path template %q: %w", template, err)
+			}
+			parsed.segments = append(parsed.segments, seg)
+		}
+
+		if rest != "" {
+			if !strings.HasPrefix(rest, "/") {
+				return nil, fmt.Errorf("path template %q: expected / after %q", template, part)
+			}
+			rest = rest[1:]
+		}
+	}
+
+	return parsed, nil
+}
+
+func parseSegment(value string) (segment, error) {
+	switch value {
+	case "":
+		return segment{}, fmt.Errorf("empty segment")
+	case "*":
+		return segment{kind: singleWildcard}, nil
+	case "**":
+		return segment{kind: multiWildcard}, nil
+	}
+	if strings.ContainsAny(value, "{}=*") {
+		return segment{}, fmt.Errorf("invalid segment %q", value)
+	}
+	return segment{kind: literalSegment, literal: value}, nil
+}
+
+// match matches an escaped request path against the template and returns
+// the value of every variable
+func (t *pathTemplate) match(escapedPath string) (map[string]string, bool) {
+	if !strings.HasPrefix(escapedPath, "/") {
+		return nil, false
+	}
+	path := escapedPath[1:]
+	if t.verb != "" {
+		if !strings.HasSuffix(path, ":"+t.verb) {
+			return nil, false
+		}
+		path = strings.TrimSuffix(path, ":"+t.verb)
+	}
+
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	matched := make([][]string, len(t.segments))
+	if !t.matchFrom(0, parts, matched) {
+		return nil, false
+	}
+
+	vars := make(map[string]string, len(t.variables))
+	for i, seg := range t.segments {
+		if seg.variable == "" {
+			continue
+		}
+		for _, part := range matched[i] {
+			decoded, err := url.PathUnescape(part)
+			if err != nil {
+				return nil, false
+			}
+			if prev, exists := vars[seg.variable]; exists {
+				decoded = prev + "/" + decoded
+			}
+			vars[seg.variable] = decoded
+		}
+	}
+	return vars, true
+}
+
+// matchFrom matches parts against the segments starting at index i,
+// recording the parts each segment consumed
+func (t *pathTemplate) matchFrom(i int, parts []string, matched [][]string) bool {
+	if i == len(t.segments) {
+		return len(parts) == 0
+	}
+
+	seg := t.segments[i]
+	switch seg.kind {
+	case multiWildcard:
+		// Consume as much as possible while leaving enough for the rest
+		for n := len(parts); n >= 0; n-- {
+			if t.matchFrom(i+1, parts[n:], matched) {
+				matched[i] = parts[:n]
+				return true
+			}
+		}
+		return false
+	default:
+		if len(parts) == 0 || parts[0] == "" {
+			return false
+		}
+		if seg.kind == literalSegment && parts[0] != seg.literal {
+			return false
+		}
+		if !t.matchFrom(i+1, parts[1:], matched) {
+			return false
+		}
+		matched[i] = parts[:1]
+		return true
+	}
+}
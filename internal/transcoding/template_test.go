@@ -0,0 +1,55 @@
+package transcoding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Match(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		vars     map[string]string
+		matches  bool
+	}{
+		{"/v1/items/{id}", "/v1/items/42", map[string]string{"id": "42"}, true},
+		{"/v1/items/{id}", "/v1/items/a%2Fb", map[string]string{"id": "a/b"}, true},
+		{"/v1/items/{id}", "/v1/items", nil, false},
+		{"/v1/items/{id}", "/v1/items/42/parts", nil, false},
+		{"/v1/{name=shops/*}/items", "/v1/shops/main/items", map[string]string{"name": "shops/main"}, true},
+		{"/v1/{name=shops/*}/items", "/v1/stores/main/items", nil, false},
+		{"/v1/{name=files/**}", "/v1/files/a/b/c", map[string]string{"name": "files/a/b/c"}, true},
+		{"/v1/{item.id}:cancel", "/v1/42:cancel", map[string]string{"item.id": "42"}, true},
+		{"/v1/{item.id}:cancel", "/v1/42", nil, false},
+		{"/v1/*/items", "/v1/anything/items", map[string]string{}, true},
+		{"/v1/**/items", "/v1/a/b/items", map[string]string{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template+" "+tt.path, func(t *testing.T) {
+			template, err := parseTemplate(tt.template)
+			require.NoError(t, err)
+
+			vars, ok := template.match(tt.path)
+			assert.Equal(t, tt.matches, ok)
+			if tt.matches {
+				assert.Equal(t, tt.vars, vars)
+			}
+		})
+	}
+}
+
+func TestTemplate_Invalid(t *testing.T) {
+	for _, template := range []string{
+		"v1/items",
+		"/v1/{id",
+		"/v1/{=items/*}",
+		"/v1//items",
+		"/v1/{id}x",
+	} {
+		_, err := parseTemplate(template)
+		assert.Error(t, err, template)
+	}
+}
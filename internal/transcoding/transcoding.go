@@ -0,0 +1,173 @@
+// Package transcoding maps JSON/HTTP requests onto gRPC methods using the
+// google.api.http annotations of a protobuf descriptor set.
+package transcoding
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var ErrNoBindings = errors.New("descriptor set has no methods with HTTP bindings")
+
+// Transcoder holds the HTTP bindings of the gRPC methods in a descriptor set
+type Transcoder struct {
+	bindings []*Binding
+}
+
+// Binding maps an HTTP method and path template onto a gRPC method
+type Binding struct {
+	Method     protoreflect.MethodDescriptor
+	HTTPMethod string
+	Pattern    string
+
+	template *pathTemplate
+	// body is the request field the HTTP body is decoded into, "*" for the
+	// whole request message and empty when the body is ignored
+	body string
+	// responseBody is the response field written as the HTTP body, empty
+	// for the whole response message
+	responseBody string
+}
+
+// Load reads a binary FileDescriptorSet, as produced by
+// protoc --include_imports --descriptor_set_out
+func Load(path string) (*Transcoder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse descriptor set %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("load descriptor set %s: %w", path, err)
+	}
+	return New(files)
+}
+
+// New collects the HTTP bindings of the unary methods in files
+func New(files *protoregistry.Files) (*Transcoder, error) {
+	t := &Transcoder{}
+
+	var err error
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				if err = t.addMethod(methods.Get(j)); err != nil {
+					return false
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(t.bindings) == 0 {
+		return nil, ErrNoBindings
+	}
+	return t, nil
+}
+
+// addMethod adds the bindings of a method's google.api.http option
+func (t *Transcoder) addMethod(method protoreflect.MethodDescriptor) error {
+	options, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || !proto.HasExtension(options, annotations.E_Http) {
+		return nil
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		// Only unary calls map onto a single HTTP exchange
+		return nil
+	}
+
+	rule := proto.GetExtension(options, annotations.E_Http).(*annotations.HttpRule)
+	rules := append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+	for _, rule := range rules {
+		binding, err := newBinding(method, rule)
+		if err != nil {
+			return fmt.Errorf("method %s: %w", method.FullName(), err)
+		}
+		t.bindings = append(t.bindings, binding)
+	}
+	return nil
+}
+
+func newBinding(method protoreflect.MethodDescriptor, rule *annotations.HttpRule) (*Binding, error) {
+	binding := &Binding{
+		Method:       method,
+		body:         rule.GetBody(),
+		responseBody: rule.GetResponseBody(),
+	}
+
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		binding.HTTPMethod, binding.Pattern = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		binding.HTTPMethod, binding.Pattern = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		binding.HTTPMethod, binding.Pattern = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		binding.HTTPMethod, binding.Pattern = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		binding.HTTPMethod, binding.Pattern = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		binding.HTTPMethod, binding.Pattern = strings.ToUpper(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		return nil, fmt.Errorf("http rule without a pattern")
+	}
+
+	var err error
+	if binding.template, err = parseTemplate(binding.Pattern); err != nil {
+		return nil, err
+	}
+	for _, variable := range binding.template.variables {
+		if _, err := fieldPath(method.Input(), variable); err != nil {
+			return nil, err
+		}
+	}
+	if binding.body != "" && binding.body != "*" {
+		if method.Input().Fields().ByName(protoreflect.Name(binding.body)) == nil {
+			return nil, fmt.Errorf("unknown body field %q", binding.body)
+		}
+	}
+	if binding.responseBody != "" {
+		if method.Output().Fields().ByName(protoreflect.Name(binding.responseBody)) == nil {
+			return nil, fmt.Errorf("unknown response body field %q", binding.responseBody)
+		}
+	}
+	return binding, nil
+}
+
+// Match returns the binding for an HTTP request, along with the values of
+// its path variables
+func (t *Transcoder) Match(httpMethod, escapedPath string) (*Binding, map[string]string) {
+	for _, binding := range t.bindings {
+		if binding.HTTPMethod != httpMethod {
+			continue
+		}
+		if vars, ok := binding.template.match(escapedPath); ok {
+			return binding, vars
+		}
+	}
+	return nil, nil
+}
+
+// GRPCPath returns the path of the binding's gRPC method
+func (b *Binding) GRPCPath() string {
+	return "/" + string(b.Method.Parent().FullName()) + "/" + string(b.Method.Name())
+}
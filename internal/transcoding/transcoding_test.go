@@ -0,0 +1,136 @@
+package transcoding
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func loadShop(t *testing.T) *Transcoder {
+	t.Helper()
+	transcoder, err := Load("testdata/shop.pb")
+	require.NoError(t, err)
+	return transcoder
+}
+
+// requestJSON transcodes a request and renders the resulting message as JSON
+func requestJSON(t *testing.T, transcoder *Transcoder, method, target string, body string) string {
+	t.Helper()
+	u, err := url.Parse(target)
+	require.NoError(t, err)
+
+	binding, vars := transcoder.Match(method, u.EscapedPath())
+	require.NotNil(t, binding, "no binding for %s %s", method, target)
+
+	msg, err := binding.NewRequest(vars, u.Query(), []byte(body))
+	require.NoError(t, err)
+	encoded, err := protojson.Marshal(msg)
+	require.NoError(t, err)
+	return string(encoded)
+}
+
+func TestLoad_Bindings(t *testing.T) {
+	transcoder := loadShop(t)
+
+	binding, _ := transcoder.Match(http.MethodGet, "/v1/shops/main/items/7")
+	require.NotNil(t, binding)
+	assert.Equal(t, "/shop.v1.ItemService/GetItem", binding.GRPCPath())
+
+	binding, _ = transcoder.Match(http.MethodPost, "/v1/shops/main/items:search")
+	require.NotNil(t, binding, "additional bindings are registered")
+	assert.Equal(t, "/shop.v1.ItemService/ListItems", binding.GRPCPath())
+
+	binding, _ = transcoder.Match(http.MethodGet, "/v1/shops/main/items:watch")
+	assert.Nil(t, binding, "streaming methods are skipped")
+
+	binding, _ = transcoder.Match(http.MethodDelete, "/v1/shops/main/items/7")
+	assert.Nil(t, binding)
+
+	_, err := Load("testdata/missing.pb")
+	assert.Error(t, err)
+}
+
+func TestBinding_NewRequest(t *testing.T) {
+	transcoder := loadShop(t)
+
+	assert.JSONEq(t,
+		`{"shop":"main","id":"7","includeArchived":true}`,
+		requestJSON(t, transcoder, "GET", "/v1/shops/main/items/7?include_archived=true&shop=ignored", ""))
+
+	assert.JSONEq(t,
+		`{"shop":"main","item":{"name":"Lamp","quantity":3,"tags":["home"]}}`,
+		requestJSON(t, transcoder, "POST", "/v1/shops/main/items", `{"name":"Lamp","quantity":3,"tags":["home"]}`))
+
+	assert.JSONEq(t,
+		`{"parent":"shops/main","pageSize":10,"tags":["a","b"],"status":"ACTIVE","filter":{"minQuantity":2,"updatedAfter":"2024-01-02T03:04:05Z"}}`,
+		requestJSON(t, transcoder, "GET",
+			"/v1/shops/main/items?pageSize=10&tags=a&tags=b&status=ACTIVE&filter.min_quantity=2&filter.updatedAfter=2024-01-02T03:04:05Z&utm_source=x", ""))
+
+	assert.JSONEq(t,
+		`{"parent":"shops/main","pageSize":5}`,
+		requestJSON(t, transcoder, "POST", "/v1/shops/main/items:search?pageSize=99", `{"pageSize":5}`))
+}
+
+func TestBinding_NewRequestErrors(t *testing.T) {
+	transcoder := loadShop(t)
+	binding, vars := transcoder.Match("GET", "/v1/shops/main/items")
+	require.NotNil(t, binding)
+
+	_, err := binding.NewRequest(vars, url.Values{"pageSize": {"ten"}}, nil)
+	var requestErr *RequestError
+	assert.ErrorAs(t, err, &requestErr)
+
+	binding, vars = transcoder.Match("POST", "/v1/shops/main/items")
+	_, err = binding.NewRequest(vars, nil, []byte(`{"quantity":"many"}`))
+	assert.ErrorAs(t, err, &requestErr)
+}
+
+func TestBinding_MarshalResponse(t *testing.T) {
+	transcoder := loadShop(t)
+	binding, _ := transcoder.Match("GET", "/v1/shops/main/items")
+	require.NotNil(t, binding)
+
+	response := dynamicpb.NewMessage(binding.Method.Output())
+	require.NoError(t, protojson.Unmarshal([]byte(`{"items":[{"id":"1","status":"ARCHIVED"}],"nextPageToken":"next"}`), response))
+	data, err := proto.Marshal(response)
+	require.NoError(t, err)
+
+	// The binding's response_body selects the items
+	encoded, err := binding.MarshalResponse(data)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"id":"1","status":"ARCHIVED"}]`, string(encoded))
+
+	binding, _ = transcoder.Match("POST", "/v1/shops/main/items:search")
+	encoded, err = binding.MarshalResponse(data)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"items":[{"id":"1","status":"ARCHIVED"}],"nextPageToken":"next"}`, string(encoded))
+}
+
+func TestFrames(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(Frame([]byte("first")))
+	stream.Write(Frame(nil))
+
+	message, err := ReadMessage(&stream)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(message))
+
+	message, err = ReadMessage(&stream)
+	require.NoError(t, err)
+	assert.Empty(t, message)
+
+	_, err = ReadMessage(&stream)
+	assert.ErrorIs(t, err, io.EOF)
+
+	assert.Equal(t, http.StatusNotFound, HTTPStatus(5))
+	assert.Equal(t, http.StatusServiceUnavailable, HTTPStatus(14))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus(99))
+}
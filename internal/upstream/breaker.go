@@ -0,0 +1,116 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/circuitbreaker"
+	"github.com/zahidhasann88/api-gateway/pkg/loadbalancer"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// serviceTarget is the target label used for the service-wide breaker
+const serviceTarget = "all"
+
+// CircuitOpenError is returned when a service or all of its instances are
+// rejecting requests because their circuit breakers are open
+type CircuitOpenError struct {
+	Service    string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("service %s: %v", e.Service, circuitbreaker.ErrCircuitOpen)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return circuitbreaker.ErrCircuitOpen
+}
+
+// newBreaker creates a breaker from the service configuration that reports
+// its transitions to the logger and metrics
+func newBreaker(service, target string, cfg config.CircuitBreakerConfig, log logger.Logger) (*circuitbreaker.CircuitBreaker, error) {
+	resetTimeout := 30 * time.Second
+	if cfg.ResetTimeout != "" {
+		parsed, err := time.ParseDuration(cfg.ResetTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid circuit breaker reset timeout: %w", err)
+		}
+		resetTimeout = parsed
+	}
+	failureThreshold := cfg.FailureThreshold
+	if failureThreshold < 1 {
+		failureThreshold = 5
+	}
+	halfOpenSuccessThreshold := cfg.HalfOpenSuccessThreshold
+	if halfOpenSuccessThreshold < 1 {
+		halfOpenSuccessThreshold = 1
+	}
+
+	breaker := circuitbreaker.NewCircuitBreaker(failureThreshold, resetTimeout, halfOpenSuccessThreshold)
+	circuitBreakerState.WithLabelValues(service, target).Set(circuitbreaker.StateClosed)
+	breaker.OnStateChange(func(from, to int) {
+		circuitBreakerState.WithLabelValues(service, target).Set(float64(to))
+		circuitBreakerTransitions.WithLabelValues(service, target, circuitbreaker.StateName(to)).Inc()
+
+		logFn := log.Info
+		if to == circuitbreaker.StateOpen {
+			logFn = log.Warn
+		}
+		logFn("Circuit breaker state changed",
+			"service", service,
+			"target", target,
+			"from", circuitbreaker.StateName(from),
+			"to", circuitbreaker.StateName(to))
+	})
+	return breaker, nil
+}
+
+// isFailure reports whether an upstream outcome counts against its breaker
+func isFailure(statusCode int, err error) bool {
+	if err != nil {
+		// A client going away says nothing about the upstream
+		return !errors.Is(err, context.Canceled)
+	}
+	return statusCode >= http.StatusInternalServerError
+}
+
+// Observe records the outcome and latency of a request sent to an instance
+// in a single attempt
+func (s *Service) Observe(target *loadbalancer.Target, statusCode int, err error, latency time.Duration) {
+	s.observeAttempt(target, statusCode, err, latency)
+	s.observeRequest(statusCode, err)
+}
+
+// observeAttempt records the outcome of one attempt against an instance
+func (s *Service) observeAttempt(target *loadbalancer.Target, statusCode int, err error, latency time.Duration) {
+	inst, exists := s.instances[target]
+	if !exists {
+		return
+	}
+	if s.outlier != nil {
+		s.observeOutlier(inst, statusCode, err, latency)
+	}
+	record(inst.breaker, statusCode, err)
+}
+
+// observeRequest records the outcome of a client request on the service's
+// breaker, however many attempts it took
+func (s *Service) observeRequest(statusCode int, err error) {
+	record(s.breaker, statusCode, err)
+}
+
+func record(breaker *circuitbreaker.CircuitBreaker, statusCode int, err error) {
+	if breaker == nil {
+		return
+	}
+	if isFailure(statusCode, err) {
+		breaker.RecordFailure()
+	} else {
+		breaker.RecordSuccess()
+	}
+}
@@ -0,0 +1,59 @@
+package upstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/circuitbreaker"
+	"github.com/zahidhasann88/api-gateway/pkg/loadbalancer"
+)
+
+func TestBreaker_PickLeavesOtherInstancesOpen(t *testing.T) {
+	service := newTestService(t, config.ServiceConfig{
+		Targets:        []config.TargetConfig{{URL: "http://first"}, {URL: "http://second"}},
+		CircuitBreaker: config.CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, ResetTimeout: "1ms"},
+	})
+	first, second := service.targets[0], service.targets[1]
+	service.instances[first].breaker.RecordFailure()
+	time.Sleep(5 * time.Millisecond)
+
+	// Picking another instance doesn't use up the open instance's trial
+	target, err := service.pick(httptest.NewRequest("GET", "/", nil), []*loadbalancer.Target{first})
+	require.NoError(t, err)
+	assert.Equal(t, second, target)
+	assert.Equal(t, circuitbreaker.StateOpen, service.instances[first].breaker.GetState())
+
+	target, err = service.pick(httptest.NewRequest("GET", "/", nil), []*loadbalancer.Target{second})
+	require.NoError(t, err)
+	assert.Equal(t, first, target)
+	assert.Equal(t, circuitbreaker.StateHalfOpen, service.instances[first].breaker.GetState())
+}
+
+func TestBreaker_CountsRequestsNotRetries(t *testing.T) {
+	backend, calls := flakyBackend(t, 100, http.StatusServiceUnavailable)
+	service := newTestService(t, config.ServiceConfig{
+		URL:            backend.URL,
+		RetryCount:     3,
+		Retry:          config.RetryConfig{BackoffBase: "1ms"},
+		CircuitBreaker: config.CircuitBreakerConfig{Enabled: true, FailureThreshold: 2, ResetTimeout: "1m"},
+	})
+
+	send := func() {
+		resp, err := service.Transport(http.DefaultTransport).RoundTrip(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	send()
+	assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+	assert.Equal(t, circuitbreaker.StateClosed, service.breaker.GetState())
+
+	send()
+	assert.Equal(t, circuitbreaker.StateOpen, service.breaker.GetState())
+}
@@ -0,0 +1,123 @@
+package upstream
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Protocols spoken to a service's targets
+const (
+	// ProtocolHTTP1 restricts the service to HTTP/1.1
+	ProtocolHTTP1 = "http1"
+	// ProtocolH2 requires HTTP/2 over TLS
+	ProtocolH2 = "h2"
+	// ProtocolH2C requires cleartext HTTP/2 with prior knowledge
+	ProtocolH2C = "h2c"
+	// ProtocolGRPC proxies gRPC over HTTP/2, cleartext for http targets
+	ProtocolGRPC = "grpc"
+)
+
+// requiresHTTP2 reports whether a protocol can only be spoken over HTTP/2
+func requiresHTTP2(protocol string) bool {
+	switch protocol {
+	case ProtocolH2, ProtocolH2C, ProtocolGRPC:
+		return true
+	}
+	return false
+}
+
+// validateProtocol checks a service's protocol against its targets' schemes
+func validateProtocol(protocol, scheme string) error {
+	switch protocol {
+	case "", ProtocolHTTP1, ProtocolGRPC:
+	case ProtocolH2:
+		if scheme != "https" {
+			return fmt.Errorf("protocol h2 requires https targets")
+		}
+	case ProtocolH2C:
+		if scheme != "http" {
+			return fmt.Errorf("protocol h2c requires http targets")
+		}
+	default:
+		return fmt.Errorf("unknown protocol %q", protocol)
+	}
+	return nil
+}
+
+// grpcCodes names the gRPC status codes
+var grpcCodes = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED",
+	"NOT_FOUND", "ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED",
+	"INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+// GRPCCodeName returns the name of a gRPC status code
+func GRPCCodeName(code int) string {
+	if code < 0 || code >= len(grpcCodes) {
+		return "UNKNOWN"
+	}
+	return grpcCodes[code]
+}
+
+// grpcStatus returns the gRPC status of a response whose body has been read
+func grpcStatus(resp *http.Response) string {
+	value := resp.Trailer.Get("Grpc-Status")
+	if value == "" {
+		value = resp.Header.Get("Grpc-Status")
+	}
+	if value != "" {
+		code, err := strconv.Atoi(value)
+		if err != nil {
+			return "UNKNOWN"
+		}
+		return GRPCCodeName(code)
+	}
+
+	// https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		return "INTERNAL"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "UNIMPLEMENTED"
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return "UNAVAILABLE"
+	}
+	return "UNKNOWN"
+}
+
+// grpcStatusBody records the gRPC status of a response once its body, and
+// with it the trailers, has been read
+type grpcStatusBody struct {
+	io.ReadCloser
+	resp    *http.Response
+	service string
+	once    sync.Once
+}
+
+func (b *grpcStatusBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.record(grpcStatus(b.resp))
+	}
+	return n, err
+}
+
+func (b *grpcStatusBody) Close() error {
+	// Closing before the end of the stream means the call was abandoned
+	b.record("CANCELLED")
+	return b.ReadCloser.Close()
+}
+
+func (b *grpcStatusBody) record(code string) {
+	b.once.Do(func() {
+		grpcResponses.WithLabelValues(b.service, code).Inc()
+	})
+}
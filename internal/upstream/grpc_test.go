@@ -0,0 +1,64 @@
+package upstream
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+func TestGRPC_StatusMetrics(t *testing.T) {
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		if r.URL.Path == "/missing" {
+			// Trailers-only response
+			w.Header().Set("Grpc-Status", "5")
+			return
+		}
+		w.Write([]byte("reply"))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "14")
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	service := newTestService(t, config.ServiceConfig{URL: backend.URL, Protocol: ProtocolGRPC})
+	call := func(path string) {
+		resp, err := service.RoundTripper().RoundTrip(httptest.NewRequest("POST", path, nil))
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	call("/missing")
+	call("/flaky")
+	assert.Equal(t, 1.0, testutil.ToFloat64(grpcResponses.WithLabelValues("test", "NOT_FOUND")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(grpcResponses.WithLabelValues("test", "UNAVAILABLE")))
+}
+
+func TestGRPC_ProtocolValidation(t *testing.T) {
+	for _, cfg := range []config.ServiceConfig{
+		{URL: "http://users", Protocol: ProtocolH2},
+		{URL: "https://users", Protocol: ProtocolH2C},
+		{URL: "http://users", Protocol: "spdy"},
+	} {
+		_, err := newService("test", cfg, nil)
+		assert.Error(t, err, cfg.Protocol)
+	}
+
+	for _, cfg := range []config.ServiceConfig{
+		{URL: "https://users", Protocol: ProtocolH2},
+		{URL: "http://users", Protocol: ProtocolH2C},
+		{URL: "http://users", Protocol: ProtocolGRPC},
+		{URL: "http://users", Protocol: ProtocolHTTP1},
+	} {
+		service := newTestService(t, cfg)
+		assert.Equal(t, cfg.Protocol, service.Protocol())
+	}
+}
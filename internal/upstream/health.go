@@ -0,0 +1,235 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/loadbalancer"
+)
+
+// healthCheck describes how a service's targets are probed
+type healthCheck struct {
+	path               string
+	interval           time.Duration
+	timeout            time.Duration
+	healthyThreshold   int
+	unhealthyThreshold int
+	expectedStatus     map[int]bool
+}
+
+// newHealthCheck parses the health check configuration. It returns nil when
+// checks are disabled.
+func newHealthCheck(cfg config.HealthCheckConfig) (*healthCheck, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+
+	check := &healthCheck{
+		path:               cfg.Path,
+		interval:           10 * time.Second,
+		timeout:            2 * time.Second,
+		healthyThreshold:   2,
+		unhealthyThreshold: 3,
+	}
+
+	var err error
+	if cfg.Interval != "" {
+		if check.interval, err = time.ParseDuration(cfg.Interval); err != nil {
+			return nil, fmt.Errorf("invalid health check interval: %w", err)
+		}
+	}
+	if cfg.Timeout != "" {
+		if check.timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid health check timeout: %w", err)
+		}
+	}
+	if cfg.HealthyThreshold > 0 {
+		check.healthyThreshold = cfg.HealthyThreshold
+	}
+	if cfg.UnhealthyThreshold > 0 {
+		check.unhealthyThreshold = cfg.UnhealthyThreshold
+	}
+	if len(cfg.ExpectedStatus) > 0 {
+		check.expectedStatus = make(map[int]bool, len(cfg.ExpectedStatus))
+		for _, code := range cfg.ExpectedStatus {
+			check.expectedStatus[code] = true
+		}
+	}
+
+	return check, nil
+}
+
+// passes reports whether a probe response counts as healthy. Without an
+// explicit list any 2xx status does.
+func (h *healthCheck) passes(statusCode int) bool {
+	if h.expectedStatus != nil {
+		return h.expectedStatus[statusCode]
+	}
+	return statusCode >= 200 && statusCode < 300
+}
+
+// StartHealthChecks probes the targets of every service with health checks
+// configured until the context is cancelled
+func (r *Registry) StartHealthChecks(ctx context.Context) {
+	for _, service := range r.services {
+		if service.healthCheck == nil {
+			continue
+		}
+		// Probes speak the service's protocol over its own connections
+		var transport http.RoundTripper = service.pool
+		if service.http2 != nil {
+			transport = service.http2
+		}
+		client := &http.Client{
+			Transport: transport,
+			// A redirect is an answer in itself
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		for _, inst := range service.instances {
+			go service.probeLoop(ctx, client, inst)
+		}
+	}
+}
+
+// probeLoop probes one instance every interval, flipping its health once
+// enough consecutive probes agree
+func (s *Service) probeLoop(ctx context.Context, client *http.Client, inst *instance) {
+	ticker := time.NewTicker(s.healthCheck.interval)
+	defer ticker.Stop()
+
+	successes, failures := 0, 0
+	for {
+		if err := s.probe(ctx, client, inst.target); err == nil {
+			successes, failures = successes+1, 0
+			if !inst.healthy.Load() && successes >= s.healthCheck.healthyThreshold {
+				s.setInstanceHealth(inst, true, nil)
+			}
+		} else if ctx.Err() == nil {
+			successes, failures = 0, failures+1
+			if inst.healthy.Load() && failures >= s.healthCheck.unhealthyThreshold {
+				s.setInstanceHealth(inst, false, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe sends a single health check request to a target
+func (s *Service) probe(ctx context.Context, client *http.Client, target *loadbalancer.Target) error {
+	ctx, cancel := context.WithTimeout(ctx, s.healthCheck.timeout)
+	defer cancel()
+
+	probeURL := TargetURL(target, &url.URL{Path: s.healthCheck.path})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "api-gateway-health-check")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainSize))
+	resp.Body.Close()
+
+	if !s.healthCheck.passes(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *Service) setInstanceHealth(inst *instance, healthy bool, cause error) {
+	inst.healthy.Store(healthy)
+	setHealthy(s.name, inst.target, healthy)
+
+	if healthy {
+		s.logger.Info("Upstream target healthy", "service", s.name, "target", inst.target.URL.Host)
+	} else {
+		s.logger.Warn("Upstream target unhealthy", "service", s.name, "target", inst.target.URL.Host, "error", cause)
+	}
+}
+
+func setHealthy(service string, target *loadbalancer.Target, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	upstreamHealthy.WithLabelValues(service, target.URL.Host).Set(value)
+}
+
+// TargetHealth is the health of one target
+type TargetHealth struct {
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+}
+
+// ServiceHealth summarizes the health of a service's targets
+type ServiceHealth struct {
+	Status   string         `json:"status"`
+	Critical bool           `json:"critical"`
+	Healthy  int            `json:"healthy"`
+	Total    int            `json:"total"`
+	Targets  []TargetHealth `json:"targets"`
+}
+
+// Service health statuses
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Health reports the health of every service
+func (r *Registry) Health() map[string]ServiceHealth {
+	report := make(map[string]ServiceHealth, len(r.services))
+	for name, service := range r.services {
+		health := ServiceHealth{
+			Critical: service.critical,
+			Total:    len(service.targets),
+			Targets:  make([]TargetHealth, 0, len(service.targets)),
+		}
+		for _, target := range service.targets {
+			healthy := service.instances[target].healthy.Load()
+			if healthy {
+				health.Healthy++
+			}
+			health.Targets = append(health.Targets, TargetHealth{URL: target.URL.String(), Healthy: healthy})
+		}
+		sort.Slice(health.Targets, func(i, j int) bool { return health.Targets[i].URL < health.Targets[j].URL })
+
+		switch health.Healthy {
+		case health.Total:
+			health.Status = StatusUp
+		case 0:
+			health.Status = StatusDown
+		default:
+			health.Status = StatusDegraded
+		}
+		report[name] = health
+	}
+	return report
+}
+
+// Ready reports whether every critical service has a healthy target
+func (r *Registry) Ready() bool {
+	for _, health := range r.Health() {
+		if health.Critical && health.Healthy == 0 {
+			return false
+		}
+	}
+	return true
+}
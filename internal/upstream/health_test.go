@@ -0,0 +1,154 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// switchableBackend answers its health endpoint with 200 or 503
+func switchableBackend(t *testing.T) (*httptest.Server, *atomic.Bool) {
+	t.Helper()
+	var up atomic.Bool
+	up.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &up
+}
+
+func TestHealthChecks_RemoveAndRestoreTargets(t *testing.T) {
+	first, firstUp := switchableBackend(t)
+	second, _ := switchableBackend(t)
+
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{
+		"users": {
+			Targets:  []config.TargetConfig{{URL: first.URL}, {URL: second.URL}},
+			Critical: true,
+			HealthCheck: config.HealthCheckConfig{
+				Path:               "/healthz",
+				Interval:           "5ms",
+				HealthyThreshold:   1,
+				UnhealthyThreshold: 2,
+			},
+		},
+	}}
+	registry, err := NewRegistry(cfg, logger.New("error"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry.StartHealthChecks(ctx)
+
+	firstUp.Store(false)
+	require.Eventually(t, func() bool {
+		return registry.Health()["users"].Status == StatusDegraded
+	}, time.Second, 5*time.Millisecond)
+
+	service, _ := registry.Service("users")
+	for i := 0; i < 5; i++ {
+		target, err := service.Pick(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		assert.Equal(t, second.URL, target.URL.String())
+	}
+	assert.True(t, registry.Ready(), "one healthy target keeps the service ready")
+
+	firstUp.Store(true)
+	require.Eventually(t, func() bool {
+		return registry.Health()["users"].Status == StatusUp
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestHealthChecks_CriticalServiceDown(t *testing.T) {
+	backend, up := switchableBackend(t)
+	up.Store(false)
+
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{
+		"payments": {
+			URL:         backend.URL,
+			Critical:    true,
+			HealthCheck: config.HealthCheckConfig{Path: "/healthz", Interval: "5ms", UnhealthyThreshold: 1},
+		},
+		"public": {URL: backend.URL},
+	}}
+	registry, err := NewRegistry(cfg, logger.New("error"))
+	require.NoError(t, err)
+	assert.True(t, registry.Ready(), "targets start healthy")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry.StartHealthChecks(ctx)
+
+	require.Eventually(t, func() bool { return !registry.Ready() }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, StatusDown, registry.Health()["payments"].Status)
+	assert.Equal(t, StatusUp, registry.Health()["public"].Status)
+
+	service, _ := registry.Service("payments")
+	_, err = service.Pick(httptest.NewRequest("GET", "/", nil))
+	assert.ErrorIs(t, err, ErrNoHealthyTargets)
+}
+
+func TestHealthChecks_H2CTargets(t *testing.T) {
+	// The backend only answers HTTP/2 with prior knowledge
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{
+		"inventory": {
+			URL:         backend.URL,
+			Protocol:    ProtocolH2C,
+			HealthCheck: config.HealthCheckConfig{Path: "/healthz", Interval: "5ms", UnhealthyThreshold: 1},
+		},
+	}}
+	registry, err := NewRegistry(cfg, logger.New("error"))
+	require.NoError(t, err)
+	service, _ := registry.Service("inventory")
+	inst := service.instances[service.targets[0]]
+	inst.healthy.Store(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry.StartHealthChecks(ctx)
+
+	require.Eventually(t, func() bool {
+		return registry.Health()["inventory"].Status == StatusUp
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestHealthCheck_ExpectedStatus(t *testing.T) {
+	check, err := newHealthCheck(config.HealthCheckConfig{Path: "/", ExpectedStatus: []int{204}})
+	require.NoError(t, err)
+	assert.True(t, check.passes(204))
+	assert.False(t, check.passes(200))
+
+	check, err = newHealthCheck(config.HealthCheckConfig{Path: "/"})
+	require.NoError(t, err)
+	assert.True(t, check.passes(200))
+	assert.False(t, check.passes(301))
+
+	check, err = newHealthCheck(config.HealthCheckConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, check)
+}
@@ -0,0 +1,72 @@
+package upstream
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	circuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_circuit_breaker_state",
+			Help: "Circuit breaker state (0 closed, 1 open, 2 half-open)",
+		},
+		[]string{"service", "target"},
+	)
+
+	circuitBreakerTransitions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_circuit_breaker_transitions_total",
+			Help: "Total number of circuit breaker state transitions",
+		},
+		[]string{"service", "target", "state"},
+	)
+
+	upstreamRetries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_upstream_retries_total",
+			Help: "Total number of retried upstream requests",
+		},
+		[]string{"service", "reason"},
+	)
+
+	upstreamHealthy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_upstream_healthy",
+			Help: "Whether an upstream target passes its health checks (1) or not (0)",
+		},
+		[]string{"service", "target"},
+	)
+
+	upstreamEjected = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_upstream_ejected",
+			Help: "Whether an upstream target is ejected by outlier detection (1) or not (0)",
+		},
+		[]string{"service", "target"},
+	)
+
+	upstreamEjections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_upstream_ejections_total",
+			Help: "Total number of upstream target ejections by outlier detection",
+		},
+		[]string{"service", "target", "reason"},
+	)
+
+	grpcResponses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_grpc_responses_total",
+			Help: "Total number of proxied gRPC calls by gRPC status code",
+		},
+		[]string{"service", "code"},
+	)
+
+	versionWeight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_upstream_version_weight",
+			Help: "Weight of a service version in its traffic split",
+		},
+		[]string{"service", "version"},
+	)
+)
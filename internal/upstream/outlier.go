@@ -0,0 +1,277 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+// Outlier ejection reasons
+const (
+	ejectConsecutive5xx = "consecutive_5xx"
+	ejectGatewayFailure = "gateway_failure"
+	ejectLatency        = "latency"
+)
+
+// latencySmoothing is the weight of a new sample in an instance's moving
+// average latency
+const latencySmoothing = 0.2
+
+// outlierDetection describes when a service's instances are ejected based
+// on the responses they give to proxied requests
+type outlierDetection struct {
+	consecutive5xx            int
+	consecutiveGatewayFailure int
+	// latencyFactor ejects instances slower than this multiple of the
+	// median of their peers; zero disables latency ejection
+	latencyFactor      float64
+	minRequests        int
+	baseEjectionTime   time.Duration
+	maxEjectionTime    time.Duration
+	maxEjectionPercent int
+
+	now func() time.Time
+}
+
+// outlierState is the passive health of a single instance. It is guarded by
+// the service's outlier mutex.
+type outlierState struct {
+	consecutive5xx             int
+	consecutiveGatewayFailures int
+	// latency is a moving average of the time to response headers
+	latency  time.Duration
+	requests int
+
+	ejected      bool
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// newOutlierDetection parses the outlier detection configuration. It
+// returns nil when detection is disabled.
+func newOutlierDetection(cfg config.OutlierDetectionConfig) (*outlierDetection, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	detection := &outlierDetection{
+		consecutive5xx:            5,
+		consecutiveGatewayFailure: 5,
+		latencyFactor:             cfg.LatencyFactor,
+		minRequests:               20,
+		baseEjectionTime:          30 * time.Second,
+		maxEjectionTime:           5 * time.Minute,
+		maxEjectionPercent:        10,
+		now:                       time.Now,
+	}
+
+	var err error
+	if cfg.BaseEjectionTime != "" {
+		if detection.baseEjectionTime, err = time.ParseDuration(cfg.BaseEjectionTime); err != nil {
+			return nil, fmt.Errorf("invalid base ejection time: %w", err)
+		}
+	}
+	if cfg.MaxEjectionTime != "" {
+		if detection.maxEjectionTime, err = time.ParseDuration(cfg.MaxEjectionTime); err != nil {
+			return nil, fmt.Errorf("invalid max ejection time: %w", err)
+		}
+	}
+	if detection.maxEjectionTime < detection.baseEjectionTime {
+		detection.maxEjectionTime = detection.baseEjectionTime
+	}
+	if cfg.Consecutive5xx > 0 {
+		detection.consecutive5xx = cfg.Consecutive5xx
+	}
+	if cfg.ConsecutiveGatewayFailure > 0 {
+		detection.consecutiveGatewayFailure = cfg.ConsecutiveGatewayFailure
+	}
+	if cfg.MinRequests > 0 {
+		detection.minRequests = cfg.MinRequests
+	}
+	if cfg.MaxEjectionPercent < 0 || cfg.MaxEjectionPercent > 100 {
+		return nil, fmt.Errorf("invalid max ejection percent %d", cfg.MaxEjectionPercent)
+	}
+	if cfg.MaxEjectionPercent > 0 {
+		detection.maxEjectionPercent = cfg.MaxEjectionPercent
+	}
+
+	return detection, nil
+}
+
+// ejectionTime doubles with every ejection of the same instance, up to the
+// configured maximum
+func (d *outlierDetection) ejectionTime(ejections int) time.Duration {
+	duration := d.baseEjectionTime
+	for i := 1; i < ejections && duration < d.maxEjectionTime; i++ {
+		duration *= 2
+	}
+	if duration > d.maxEjectionTime {
+		duration = d.maxEjectionTime
+	}
+	return duration
+}
+
+// maxEjected is how many of total instances may be ejected at once
+func (d *outlierDetection) maxEjected(total int) int {
+	limit := total * d.maxEjectionPercent / 100
+	if limit < 1 {
+		limit = 1
+	}
+	if d.maxEjectionPercent < 100 && limit >= total {
+		limit = total - 1
+	}
+	return limit
+}
+
+// isGatewayFailure reports whether an outcome means the instance could not
+// be reached or could not produce a response
+func isGatewayFailure(statusCode int, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// observeOutlier updates the passive health of an instance and ejects it
+// when it turns out to be an outlier
+func (s *Service) observeOutlier(inst *instance, statusCode int, err error, latency time.Duration) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	s.outlierMu.Lock()
+	defer s.outlierMu.Unlock()
+
+	state := &inst.outlier
+	if state.ejected {
+		// Responses to requests sent before the ejection
+		return
+	}
+
+	if isGatewayFailure(statusCode, err) {
+		state.consecutiveGatewayFailures++
+	} else {
+		state.consecutiveGatewayFailures = 0
+	}
+	if err != nil || statusCode >= http.StatusInternalServerError {
+		state.consecutive5xx++
+	} else {
+		state.consecutive5xx = 0
+		if latency > 0 {
+			s.recordLatency(state, latency)
+		}
+	}
+
+	switch {
+	case state.consecutiveGatewayFailures >= s.outlier.consecutiveGatewayFailure:
+		s.eject(inst, ejectGatewayFailure)
+	case state.consecutive5xx >= s.outlier.consecutive5xx:
+		s.eject(inst, ejectConsecutive5xx)
+	case s.isLatencyOutlier(inst):
+		s.eject(inst, ejectLatency)
+	}
+}
+
+// recordLatency folds a response time into an instance's moving average
+func (s *Service) recordLatency(state *outlierState, latency time.Duration) {
+	state.requests++
+	if state.latency == 0 {
+		state.latency = latency
+		return
+	}
+	state.latency += time.Duration(latencySmoothing * float64(latency-state.latency))
+}
+
+// isLatencyOutlier reports whether an instance is much slower than the
+// median of its peers. Only instances with enough requests are compared.
+func (s *Service) isLatencyOutlier(inst *instance) bool {
+	if s.outlier.latencyFactor <= 0 || inst.outlier.requests < s.outlier.minRequests {
+		return false
+	}
+
+	var peers []time.Duration
+	for _, peer := range s.instances {
+		if peer == inst || peer.outlier.ejected || peer.outlier.requests < s.outlier.minRequests {
+			continue
+		}
+		peers = append(peers, peer.outlier.latency)
+	}
+	if len(peers) == 0 {
+		return false
+	}
+
+	sort.Slice(peers, func(i, j int) bool { return peers[i] < peers[j] })
+	median := peers[len(peers)/2]
+	if len(peers)%2 == 0 {
+		median = (peers[len(peers)/2-1] + median) / 2
+	}
+	return float64(inst.outlier.latency) > s.outlier.latencyFactor*float64(median)
+}
+
+// eject takes an instance out of rotation unless that would exceed the
+// service's max ejection percent
+func (s *Service) eject(inst *instance, reason string) {
+	now := s.outlier.now()
+	ejected := 0
+	for _, other := range s.instances {
+		if other.outlier.ejected && now.Before(other.outlier.ejectedUntil) {
+			ejected++
+		}
+	}
+	if ejected >= s.outlier.maxEjected(len(s.instances)) {
+		return
+	}
+
+	state := &inst.outlier
+	state.ejections++
+	duration := s.outlier.ejectionTime(state.ejections)
+	state.ejected = true
+	state.ejectedUntil = now.Add(duration)
+
+	upstreamEjected.WithLabelValues(s.name, inst.target.URL.Host).Set(1)
+	upstreamEjections.WithLabelValues(s.name, inst.target.URL.Host, reason).Inc()
+	s.logger.Warn("Upstream target ejected",
+		"service", s.name,
+		"target", inst.target.URL.Host,
+		"reason", reason,
+		"duration", duration)
+}
+
+// isEjected reports whether an instance is currently ejected, returning it
+// to rotation once its ejection time has passed
+func (s *Service) isEjected(inst *instance) bool {
+	if s.outlier == nil {
+		return false
+	}
+
+	s.outlierMu.Lock()
+	defer s.outlierMu.Unlock()
+
+	state := &inst.outlier
+	if !state.ejected {
+		// An instance that stayed in rotation for a full maximum ejection
+		// time is forgiven its earlier ejections
+		if state.ejections > 0 && s.outlier.now().Sub(state.ejectedUntil) > s.outlier.maxEjectionTime {
+			state.ejections = 0
+		}
+		return false
+	}
+	if s.outlier.now().Before(state.ejectedUntil) {
+		return true
+	}
+
+	// Start over so the instance is judged on its behaviour after returning
+	*state = outlierState{ejections: state.ejections, ejectedUntil: state.ejectedUntil}
+	upstreamEjected.WithLabelValues(s.name, inst.target.URL.Host).Set(0)
+	s.logger.Info("Upstream target returned from ejection", "service", s.name, "target", inst.target.URL.Host)
+	return false
+}
@@ -0,0 +1,153 @@
+package upstream
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/loadbalancer"
+)
+
+// newOutlierService creates a service over n fake targets with a controllable
+// clock
+func newOutlierService(t *testing.T, n int, cfg config.OutlierDetectionConfig) (*Service, *time.Time) {
+	t.Helper()
+	targets := make([]config.TargetConfig, 0, n)
+	for i := 0; i < n; i++ {
+		targets = append(targets, config.TargetConfig{URL: fmt.Sprintf("http://10.0.0.%d:8080", i+1)})
+	}
+	cfg.Enabled = true
+	service := newTestService(t, config.ServiceConfig{Targets: targets, OutlierDetection: cfg})
+
+	now := time.Unix(1700000000, 0)
+	service.outlier.now = func() time.Time { return now }
+	return service, &now
+}
+
+func pickable(t *testing.T, service *Service) []*loadbalancer.Target {
+	t.Helper()
+	targets, err := service.available("")
+	require.NoError(t, err)
+	return targets
+}
+
+func TestOutlier_EjectsAfterConsecutive5xx(t *testing.T) {
+	service, now := newOutlierService(t, 2, config.OutlierDetectionConfig{
+		Consecutive5xx:     3,
+		BaseEjectionTime:   "10s",
+		MaxEjectionTime:    "25s",
+		MaxEjectionPercent: 50,
+	})
+	bad := service.targets[0]
+
+	fail := func() {
+		for i := 0; i < 3; i++ {
+			service.Observe(bad, http.StatusInternalServerError, nil, time.Millisecond)
+		}
+	}
+
+	// A success in between resets the count
+	service.Observe(bad, http.StatusInternalServerError, nil, time.Millisecond)
+	service.Observe(bad, http.StatusInternalServerError, nil, time.Millisecond)
+	service.Observe(bad, http.StatusOK, nil, time.Millisecond)
+	assert.Len(t, pickable(t, service), 2)
+
+	// Ejection times double with every ejection up to the maximum
+	for _, duration := range []time.Duration{10 * time.Second, 20 * time.Second, 25 * time.Second} {
+		fail()
+		assert.Equal(t, []*loadbalancer.Target{service.targets[1]}, pickable(t, service))
+
+		*now = now.Add(duration - time.Second)
+		assert.Len(t, pickable(t, service), 1)
+		*now = now.Add(time.Second)
+		assert.Len(t, pickable(t, service), 2)
+	}
+}
+
+func TestOutlier_GatewayFailures(t *testing.T) {
+	service, _ := newOutlierService(t, 2, config.OutlierDetectionConfig{
+		Consecutive5xx:            10,
+		ConsecutiveGatewayFailure: 2,
+		MaxEjectionPercent:        50,
+	})
+
+	service.Observe(service.targets[0], 0, assert.AnError, 0)
+	service.Observe(service.targets[0], http.StatusBadGateway, nil, 0)
+	assert.Equal(t, []*loadbalancer.Target{service.targets[1]}, pickable(t, service))
+}
+
+func TestOutlier_MaxEjectionPercent(t *testing.T) {
+	service, _ := newOutlierService(t, 4, config.OutlierDetectionConfig{
+		Consecutive5xx:     1,
+		MaxEjectionPercent: 50,
+	})
+
+	for _, target := range service.targets {
+		service.Observe(target, http.StatusServiceUnavailable, nil, 0)
+	}
+	assert.Len(t, pickable(t, service), 2)
+
+	// A service never loses all instances below 100%
+	single, _ := newOutlierService(t, 1, config.OutlierDetectionConfig{Consecutive5xx: 1})
+	single.Observe(single.targets[0], http.StatusServiceUnavailable, nil, 0)
+	assert.Len(t, pickable(t, single), 1)
+}
+
+func TestOutlier_LatencyOutlier(t *testing.T) {
+	service, _ := newOutlierService(t, 3, config.OutlierDetectionConfig{
+		LatencyFactor:      3,
+		MinRequests:        5,
+		MaxEjectionPercent: 50,
+	})
+	slow := service.targets[2]
+
+	for i := 0; i < 5; i++ {
+		service.Observe(service.targets[0], http.StatusOK, nil, 10*time.Millisecond)
+		service.Observe(service.targets[1], http.StatusOK, nil, 12*time.Millisecond)
+		service.Observe(slow, http.StatusOK, nil, 20*time.Millisecond)
+	}
+	assert.Len(t, pickable(t, service), 3, "slower but within the factor")
+
+	for i := 0; i < 10; i++ {
+		service.Observe(slow, http.StatusOK, nil, 200*time.Millisecond)
+	}
+	assert.NotContains(t, pickable(t, service), slow)
+}
+
+func TestOutlier_ThroughTransport(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer good.Close()
+
+	service := newTestService(t, config.ServiceConfig{
+		Targets: []config.TargetConfig{{URL: bad.URL}, {URL: good.URL}},
+		OutlierDetection: config.OutlierDetectionConfig{
+			Enabled:            true,
+			Consecutive5xx:     2,
+			MaxEjectionPercent: 50,
+		},
+	})
+
+	transport := service.Transport(http.DefaultTransport)
+	failures := 0
+	for i := 0; i < 20; i++ {
+		resp, err := transport.RoundTrip(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			failures++
+		}
+	}
+	assert.Equal(t, 2, failures, "the failing target is ejected after two errors")
+}
@@ -0,0 +1,190 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+// newPool creates the transport shared by every request to a service
+func newPool(cfg config.ServiceConfig) (*http.Transport, error) {
+	poolConfig := cfg.ConnectionPool
+
+	idleConnTimeout, err := config.ParseDuration(poolConfig.IdleConnTimeout, 90*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid idle connection timeout: %w", err)
+	}
+	dialTimeout, err := config.ParseDuration(poolConfig.DialTimeout, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dial timeout: %w", err)
+	}
+	keepAlive, err := config.ParseDuration(poolConfig.KeepAlive, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keep alive: %w", err)
+	}
+	tlsHandshakeTimeout, err := config.ParseDuration(poolConfig.TLSHandshakeTimeout, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS handshake timeout: %w", err)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: keepAlive,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxConnsPerHost:       poolConfig.MaxConnsPerHost,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+		ResponseHeaderTimeout: time.Duration(cfg.Timeout) * time.Second,
+	}
+	if poolConfig.MaxIdleConns > 0 {
+		transport.MaxIdleConns = poolConfig.MaxIdleConns
+	}
+	if poolConfig.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = poolConfig.MaxIdleConnsPerHost
+	}
+
+	if poolConfig.HTTP2.Disabled || cfg.Protocol == ProtocolHTTP1 {
+		return transport, nil
+	}
+
+	h2, err := http2.ConfigureTransports(transport)
+	if err != nil {
+		return nil, err
+	}
+	if err := configureHTTP2(h2, poolConfig.HTTP2); err != nil {
+		return nil, err
+	}
+
+	return transport, nil
+}
+
+// configureHTTP2 applies the HTTP/2 settings of a connection pool
+func configureHTTP2(h2 *http2.Transport, cfg config.HTTP2Config) error {
+	var err error
+	h2.StrictMaxConcurrentStreams = cfg.StrictMaxConcurrentStreams
+	if h2.ReadIdleTimeout, err = config.ParseDuration(cfg.ReadIdleTimeout, 0); err != nil {
+		return fmt.Errorf("invalid HTTP/2 read idle timeout: %w", err)
+	}
+	if h2.PingTimeout, err = config.ParseDuration(cfg.PingTimeout, 0); err != nil {
+		return fmt.Errorf("invalid HTTP/2 ping timeout: %w", err)
+	}
+	return nil
+}
+
+// errResponseHeaderTimeout fails HTTP/2 requests whose response headers
+// take longer than the service's timeout
+var errResponseHeaderTimeout = errors.New("http2: timeout awaiting response headers")
+
+// http2Pool speaks HTTP/2 to every target, over TLS for https targets and
+// with prior knowledge (h2c) for http targets
+type http2Pool struct {
+	tls                   *http2.Transport
+	cleartext             *http2.Transport
+	responseHeaderTimeout time.Duration
+}
+
+// newHTTP2Pool creates the transport of a service that requires HTTP/2
+func newHTTP2Pool(pool *http.Transport, cfg config.ConnectionPoolConfig) (*http2Pool, error) {
+	if cfg.MaxConnsPerHost > 0 || cfg.MaxIdleConnsPerHost > 0 {
+		return nil, errors.New("maxConnsPerHost and maxIdleConnsPerHost don't apply to HTTP/2 services, set http2.strictMaxConcurrentStreams to bound the connections")
+	}
+
+	h2 := &http2Pool{
+		responseHeaderTimeout: pool.ResponseHeaderTimeout,
+		tls: &http2.Transport{
+			TLSClientConfig: pool.TLSClientConfig,
+			IdleConnTimeout: pool.IdleConnTimeout,
+			DialTLSContext: func(ctx context.Context, network, addr string, tlsConfig *tls.Config) (net.Conn, error) {
+				conn, err := pool.DialContext(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				handshakeCtx, cancel := context.WithTimeout(ctx, pool.TLSHandshakeTimeout)
+				defer cancel()
+				tlsConn := tls.Client(conn, tlsConfig)
+				if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return tlsConn, nil
+			},
+		},
+		cleartext: &http2.Transport{
+			AllowHTTP:       true,
+			IdleConnTimeout: pool.IdleConnTimeout,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return pool.DialContext(ctx, network, addr)
+			},
+		},
+	}
+	for _, transport := range []*http2.Transport{h2.tls, h2.cleartext} {
+		if err := configureHTTP2(transport, cfg.HTTP2); err != nil {
+			return nil, err
+		}
+	}
+	return h2, nil
+}
+
+// RoundTrip sends the request over HTTP/2
+func (p *http2Pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := p.cleartext
+	if req.URL.Scheme == "https" {
+		transport = p.tls
+	}
+	if p.responseHeaderTimeout <= 0 {
+		return transport.RoundTrip(req)
+	}
+
+	// The stream is canceled when the headers are late, and otherwise once
+	// the body is closed
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(p.responseHeaderTimeout, func() { cancel(errResponseHeaderTimeout) })
+	resp, err := transport.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, errResponseHeaderTimeout
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: func() { cancel(nil) }}
+	return resp, nil
+}
+
+// cancelOnClose releases the context of a request when its response body is
+// closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// CloseIdleConnections closes the HTTP/2 connections without active streams
+func (p *http2Pool) CloseIdleConnections() {
+	p.tls.CloseIdleConnections()
+	p.cleartext.CloseIdleConnections()
+}
@@ -0,0 +1,104 @@
+package upstream
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+func TestPool_Configuration(t *testing.T) {
+	pool, err := newPool(config.ServiceConfig{
+		Timeout: 3,
+		ConnectionPool: config.ConnectionPoolConfig{
+			MaxConnsPerHost:     8,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     "15s",
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 8, pool.MaxConnsPerHost)
+	assert.Equal(t, 4, pool.MaxIdleConnsPerHost)
+	assert.Equal(t, 100, pool.MaxIdleConns)
+	assert.Equal(t, 15*time.Second, pool.IdleConnTimeout)
+	assert.Equal(t, 3*time.Second, pool.ResponseHeaderTimeout)
+	assert.Contains(t, pool.TLSClientConfig.NextProtos, "h2")
+
+	pool, err = newPool(config.ServiceConfig{
+		ConnectionPool: config.ConnectionPoolConfig{HTTP2: config.HTTP2Config{Disabled: true}},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, pool.TLSClientConfig)
+
+	_, err = newPool(config.ServiceConfig{
+		ConnectionPool: config.ConnectionPoolConfig{DialTimeout: "soon"},
+	})
+	assert.Error(t, err)
+}
+
+func TestHTTP2Pool_Configuration(t *testing.T) {
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	pool, err := newPool(config.ServiceConfig{Timeout: 3, ConnectionPool: config.ConnectionPoolConfig{IdleConnTimeout: "15s"}})
+	require.NoError(t, err)
+	h2, err := newHTTP2Pool(pool, config.ConnectionPoolConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Second, h2.cleartext.IdleConnTimeout)
+	assert.Equal(t, 3*time.Second, h2.responseHeaderTimeout)
+
+	h2.responseHeaderTimeout = 50 * time.Millisecond
+	resp, err := h2.RoundTrip(httptest.NewRequest("GET", backend.URL+"/fast", nil))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "ok", string(body))
+	_, err = h2.RoundTrip(httptest.NewRequest("GET", backend.URL+"/slow", nil))
+	assert.ErrorIs(t, err, errResponseHeaderTimeout)
+
+	// Connection limits can't be applied to multiplexed connections
+	for _, poolConfig := range []config.ConnectionPoolConfig{{MaxConnsPerHost: 8}, {MaxIdleConnsPerHost: 4}} {
+		_, err := newService("test", config.ServiceConfig{URL: backend.URL, Protocol: ProtocolGRPC, ConnectionPool: poolConfig}, nil)
+		assert.Error(t, err)
+	}
+}
+
+func TestPool_ReusesConnections(t *testing.T) {
+	var conns int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	service := newTestService(t, config.ServiceConfig{URL: backend.URL})
+	for i := 0; i < 10; i++ {
+		resp, err := service.RoundTripper().RoundTrip(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+}
@@ -0,0 +1,199 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+)
+
+// RetriesHeader reports how many times the gateway retried a request
+const RetriesHeader = "X-Gateway-Retries"
+
+// Retry defaults
+const (
+	defaultBackoffBase = 50 * time.Millisecond
+	defaultBackoffMax  = time.Second
+	defaultMaxBodySize = 64 << 10
+	maxDrainSize       = 4 << 10
+)
+
+var defaultRetryStatusCodes = []int{
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// retryPolicy decides whether and when a failed request is retried
+type retryPolicy struct {
+	retries     int
+	statusCodes map[int]bool
+	backoffBase time.Duration
+	backoffMax  time.Duration
+	maxBodySize int64
+}
+
+func newRetryPolicy(retries int, cfg config.RetryConfig) (*retryPolicy, error) {
+	policy := &retryPolicy{
+		retries:     retries,
+		statusCodes: make(map[int]bool),
+		backoffBase: defaultBackoffBase,
+		backoffMax:  defaultBackoffMax,
+		maxBodySize: defaultMaxBodySize,
+	}
+
+	statusCodes := cfg.StatusCodes
+	if len(statusCodes) == 0 {
+		statusCodes = defaultRetryStatusCodes
+	}
+	for _, code := range statusCodes {
+		policy.statusCodes[code] = true
+	}
+
+	var err error
+	if cfg.BackoffBase != "" {
+		if policy.backoffBase, err = time.ParseDuration(cfg.BackoffBase); err != nil {
+			return nil, fmt.Errorf("invalid retry backoff base: %w", err)
+		}
+	}
+	if cfg.BackoffMax != "" {
+		if policy.backoffMax, err = time.ParseDuration(cfg.BackoffMax); err != nil {
+			return nil, fmt.Errorf("invalid retry backoff max: %w", err)
+		}
+	}
+	if cfg.MaxBodySize > 0 {
+		policy.maxBodySize = cfg.MaxBodySize
+	}
+
+	return policy, nil
+}
+
+// allows reports whether the request may be sent more than once. Only
+// idempotent methods are retried unless the client sent an Idempotency-Key.
+func (p *retryPolicy) allows(req *http.Request) bool {
+	if p.retries < 1 {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// retryable reports whether an attempt's outcome is worth retrying and why
+func (p *retryPolicy) retryable(req *http.Request, resp *http.Response, err error) (string, bool) {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return "", false
+		}
+		var openErr *CircuitOpenError
+		if errors.As(err, &openErr) {
+			return "", false
+		}
+		return "error", true
+	}
+	if p.statusCodes[resp.StatusCode] {
+		return "status", true
+	}
+	return "", false
+}
+
+// backoff returns the wait before the given retry using exponential backoff
+// with full jitter
+func (p *retryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.backoffBase << retry
+	if ceiling <= 0 || ceiling > p.backoffMax {
+		ceiling = p.backoffMax
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) + 1
+}
+
+// replayableBody makes the request body readable once per attempt
+func (p *retryPolicy) replayableBody(req *http.Request) (func() io.ReadCloser, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return func() io.ReadCloser { return req.Body }, true
+	}
+	if req.GetBody != nil {
+		return func() io.ReadCloser {
+			body, err := req.GetBody()
+			if err != nil {
+				return io.NopCloser(errReader{err})
+			}
+			return body
+		}, true
+	}
+
+	// Streaming bodies of unknown length are never buffered
+	if req.ContentLength < 0 || req.ContentLength > p.maxBodySize {
+		return nil, false
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(req.Body, p.maxBodySize+1))
+	if err != nil || int64(len(buf)) > p.maxBodySize {
+		req.Body = readCloser{io.MultiReader(bytes.NewReader(buf), errReader{err}, req.Body), req.Body}
+		return nil, false
+	}
+	req.Body.Close()
+
+	return func() io.ReadCloser { return io.NopCloser(bytes.NewReader(buf)) }, true
+}
+
+// wait sleeps for the backoff unless the request is cancelled first
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// discard drains a little of a response that is about to be retried so its
+// connection can be reused, then closes it
+func discard(resp *http.Response) {
+	io.CopyN(io.Discard, resp.Body, maxDrainSize)
+	resp.Body.Close()
+}
+
+// RetriedError wraps the final error of a request that was retried
+type RetriedError struct {
+	Retries int
+	Err     error
+}
+
+func (e *RetriedError) Error() string {
+	return fmt.Sprintf("%v (after %d retries)", e.Err, e.Retries)
+}
+
+func (e *RetriedError) Unwrap() error {
+	return e.Err
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err == nil {
+		return 0, io.EOF
+	}
+	return 0, r.err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
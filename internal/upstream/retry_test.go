@@ -0,0 +1,154 @@
+package upstream
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// flakyBackend fails the first n requests with the given status and echoes
+// the request body afterwards
+func flakyBackend(t *testing.T, failures int32, status int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newTestService(t *testing.T, cfg config.ServiceConfig) *Service {
+	t.Helper()
+	service, err := newService("test", cfg, logger.New("error"))
+	require.NoError(t, err)
+	return service
+}
+
+func TestRetry_IdempotentRequest(t *testing.T) {
+	backend, calls := flakyBackend(t, 2, http.StatusServiceUnavailable)
+	service := newTestService(t, config.ServiceConfig{
+		URL:        backend.URL,
+		RetryCount: 3,
+		Retry:      config.RetryConfig{BackoffBase: "1ms"},
+	})
+
+	req := httptest.NewRequest("PUT", "/items/1", strings.NewReader("payload"))
+	resp, err := service.Transport(http.DefaultTransport).RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "payload", string(body))
+	assert.Equal(t, "2", resp.Header.Get(RetriesHeader))
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestRetry_NonIdempotentRequest(t *testing.T) {
+	backend, calls := flakyBackend(t, 1, http.StatusBadGateway)
+	service := newTestService(t, config.ServiceConfig{
+		URL:        backend.URL,
+		RetryCount: 3,
+		Retry:      config.RetryConfig{BackoffBase: "1ms"},
+	})
+
+	req := httptest.NewRequest("POST", "/payments", strings.NewReader("payload"))
+	resp, err := service.Transport(http.DefaultTransport).RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	// An idempotency key makes the POST safe to replay
+	req = httptest.NewRequest("POST", "/payments", strings.NewReader("payload"))
+	req.Header.Set("Idempotency-Key", "abc")
+	resp, err = service.Transport(http.DefaultTransport).RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "payload", string(body))
+	assert.Equal(t, "", resp.Header.Get(RetriesHeader))
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestRetry_StatusNotRetried(t *testing.T) {
+	backend, calls := flakyBackend(t, 1, http.StatusInternalServerError)
+	service := newTestService(t, config.ServiceConfig{
+		URL:        backend.URL,
+		RetryCount: 3,
+		Retry:      config.RetryConfig{BackoffBase: "1ms"},
+	})
+
+	resp, err := service.Transport(http.DefaultTransport).RoundTrip(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestRetry_BodyTooLargeToReplay(t *testing.T) {
+	backend, calls := flakyBackend(t, 1, http.StatusServiceUnavailable)
+	service := newTestService(t, config.ServiceConfig{
+		URL:        backend.URL,
+		RetryCount: 3,
+		Retry:      config.RetryConfig{BackoffBase: "1ms", MaxBodySize: 4},
+	})
+
+	req := httptest.NewRequest("PUT", "/items/1", strings.NewReader("payload"))
+	resp, err := service.Transport(http.DefaultTransport).RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestRetry_ConnectionErrorMovesToAnotherTarget(t *testing.T) {
+	backend, calls := flakyBackend(t, 0, 0)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	service := newTestService(t, config.ServiceConfig{
+		Targets: []config.TargetConfig{
+			{URL: down.URL},
+			{URL: backend.URL},
+		},
+		RetryCount: 1,
+		Retry:      config.RetryConfig{BackoffBase: "1ms"},
+	})
+
+	for i := 0; i < 2; i++ {
+		resp, err := service.Transport(http.DefaultTransport).RoundTrip(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy, err := newRetryPolicy(5, config.RetryConfig{BackoffBase: "10ms", BackoffMax: "50ms"})
+	require.NoError(t, err)
+
+	for retry := 0; retry < 10; retry++ {
+		d := policy.backoff(retry)
+		assert.Greater(t, int64(d), int64(0))
+		assert.LessOrEqual(t, d, policy.backoffMax)
+	}
+}
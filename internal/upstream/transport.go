@@ -0,0 +1,171 @@
+package upstream
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zahidhasann88/api-gateway/pkg/loadbalancer"
+)
+
+// balancingTransport routes each request to an instance of a service
+type balancingTransport struct {
+	service *Service
+	base    http.RoundTripper
+}
+
+// RoundTrip sends the request to an instance, retrying failed attempts on
+// other instances when the service's retry policy allows it
+func (t *balancingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := t.service.retry
+	var body func() io.ReadCloser
+	retryAllowed := policy.allows(req)
+	if retryAllowed {
+		body, retryAllowed = policy.replayableBody(req)
+	}
+
+	var tried []*loadbalancer.Target
+	// The service's breaker counts the request once, by its last attempt
+	var statusCode int
+	var attemptErr error
+	defer func() {
+		if len(tried) > 0 {
+			t.service.observeRequest(statusCode, attemptErr)
+		}
+	}()
+	for retry := 0; ; retry++ {
+		target, err := t.service.pick(req, tried)
+		if err != nil {
+			return nil, withRetries(err, retry)
+		}
+		tried = append(tried, target)
+
+		outreq := new(http.Request)
+		*outreq = *req
+		outreq.URL = TargetURL(target, req.URL)
+		if retryAllowed {
+			outreq.Body = body()
+		}
+
+		resp, err := t.send(target, outreq)
+		statusCode, attemptErr = 0, err
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+
+		reason, retryable := policy.retryable(req, resp, err)
+		if !retryAllowed || !retryable || retry >= policy.retries {
+			if err != nil {
+				return nil, withRetries(err, retry)
+			}
+			if retry > 0 {
+				resp.Header.Set(RetriesHeader, strconv.Itoa(retry))
+			}
+			if t.service.protocol == ProtocolGRPC {
+				resp.Body = &grpcStatusBody{ReadCloser: resp.Body, resp: resp, service: t.service.name}
+			}
+			return resp, nil
+		}
+
+		upstreamRetries.WithLabelValues(t.service.name, reason).Inc()
+		t.service.logger.Debug("Retrying upstream request",
+			"service", t.service.name,
+			"target", target.URL.Host,
+			"retry", retry+1,
+			"reason", reason)
+
+		if resp != nil {
+			discard(resp)
+		}
+		if err := wait(req.Context(), policy.backoff(retry)); err != nil {
+			return nil, withRetries(err, retry)
+		}
+	}
+}
+
+// send makes a single attempt against an instance
+func (t *balancingTransport) send(target *loadbalancer.Target, req *http.Request) (*http.Response, error) {
+	target.Acquire()
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		target.Release()
+		t.service.observeAttempt(target, 0, err, latency)
+		return nil, err
+	}
+	t.service.observeAttempt(target, resp.StatusCode, nil, latency)
+
+	// The request stays in flight until the body has been consumed
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: target.Release}
+	return resp, nil
+}
+
+// withRetries records the retry count on the final error
+func withRetries(err error, retries int) error {
+	if retries == 0 {
+		return err
+	}
+	return &RetriedError{Retries: retries, Err: err}
+}
+
+// TargetURL resolves a request URL against an instance, prefixing the
+// instance's base path
+func TargetURL(target *loadbalancer.Target, reqURL *url.URL) *url.URL {
+	u := *reqURL
+	u.Scheme = target.URL.Scheme
+	u.Host = target.URL.Host
+	if target.URL.Path != "" {
+		u.Path = joinPath(target.URL.Path, reqURL.Path)
+		if reqURL.RawPath != "" {
+			u.RawPath = joinPath(target.URL.EscapedPath(), reqURL.EscapedPath())
+		}
+	}
+	if target.URL.RawQuery != "" {
+		if u.RawQuery == "" {
+			u.RawQuery = target.URL.RawQuery
+		} else {
+			u.RawQuery = target.URL.RawQuery + "&" + u.RawQuery
+		}
+	}
+	return &u
+}
+
+func joinPath(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// releaseOnClose runs release once when the body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// Write forwards to the body of a 101 Switching Protocols response, which
+// the reverse proxy needs to be writable
+func (b *releaseOnClose) Write(p []byte) (int, error) {
+	if w, ok := b.ReadCloser.(io.Writer); ok {
+		return w.Write(p)
+	}
+	return 0, errors.New("response body is not writable")
+}
@@ -0,0 +1,342 @@
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/circuitbreaker"
+	"github.com/zahidhasann88/api-gateway/pkg/loadbalancer"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+var ErrNoHealthyTargets = errors.New("no healthy upstream targets")
+
+// Registry holds the upstream pool of every configured service
+type Registry struct {
+	services map[string]*Service
+}
+
+// NewRegistry creates the upstream pools for the configured services
+func NewRegistry(cfg *config.Config, log logger.Logger) (*Registry, error) {
+	registry := &Registry{services: make(map[string]*Service, len(cfg.Services))}
+
+	for name, serviceConfig := range cfg.Services {
+		service, err := newService(name, serviceConfig, log)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		registry.services[name] = service
+	}
+
+	return registry, nil
+}
+
+// Service returns the upstream pool of the named service
+func (r *Registry) Service(name string) (*Service, bool) {
+	service, exists := r.services[name]
+	return service, exists
+}
+
+// Service is the set of upstream instances behind a configured service
+type Service struct {
+	name     string
+	protocol string
+	targets  []*loadbalancer.Target
+	balancer loadbalancer.Balancer
+	retry    *retryPolicy
+	logger   logger.Logger
+
+	critical bool
+
+	// breaker guards the whole service and is nil when breaking is disabled
+	breaker     *circuitbreaker.CircuitBreaker
+	instances   map[*loadbalancer.Target]*instance
+	healthCheck *healthCheck
+
+	// outlier is nil when outlier detection is disabled
+	outlier   *outlierDetection
+	outlierMu sync.Mutex
+
+	// split is nil unless traffic is split between versions, versionOf
+	// then names the version of every target
+	split     *trafficSplit
+	versionOf map[*loadbalancer.Target]string
+
+	// http2 replaces pool when the service requires HTTP/2
+	pool      *http.Transport
+	http2     *http2Pool
+	transport http.RoundTripper
+}
+
+// instance holds the gateway's view of a single target
+type instance struct {
+	target *loadbalancer.Target
+	// breaker guards the instance when the service has more than one
+	breaker *circuitbreaker.CircuitBreaker
+	// healthy is cleared while active health checks fail
+	healthy atomic.Bool
+	// outlier tracks passive health from proxied requests
+	outlier outlierState
+}
+
+func newService(name string, cfg config.ServiceConfig, log logger.Logger) (*Service, error) {
+	var targets []*loadbalancer.Target
+	var split *trafficSplit
+	var versionOf map[*loadbalancer.Target]string
+	var err error
+	if len(cfg.TrafficSplit.Versions) > 0 {
+		// Split services take their targets from their versions
+		if cfg.URL != "" || len(cfg.Targets) > 0 {
+			return nil, fmt.Errorf("url and targets can't be combined with traffic split versions")
+		}
+		split, versionOf, targets, err = newTrafficSplit(name, cfg.TrafficSplit, cfg.Protocol)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		targetConfigs := cfg.Targets
+		if len(targetConfigs) == 0 {
+			if cfg.URL == "" {
+				return nil, fmt.Errorf("no url or targets configured")
+			}
+			targetConfigs = []config.TargetConfig{{URL: cfg.URL, Weight: 1}}
+		}
+		if targets, err = newTargets(targetConfigs, cfg.Protocol); err != nil {
+			return nil, err
+		}
+	}
+
+	balancer, err := loadbalancer.New(cfg.LoadBalancer.Strategy, loadbalancer.Options{
+		HashOn:  cfg.LoadBalancer.HashOn,
+		HashKey: cfg.LoadBalancer.HashKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	retry, err := newRetryPolicy(cfg.RetryCount, cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+
+	healthCheck, err := newHealthCheck(cfg.HealthCheck)
+	if err != nil {
+		return nil, err
+	}
+
+	outlier, err := newOutlierDetection(cfg.OutlierDetection)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := newPool(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &Service{
+		name:        name,
+		protocol:    cfg.Protocol,
+		targets:     targets,
+		balancer:    balancer,
+		retry:       retry,
+		logger:      log,
+		critical:    cfg.Critical,
+		instances:   make(map[*loadbalancer.Target]*instance, len(targets)),
+		healthCheck: healthCheck,
+		outlier:     outlier,
+		split:       split,
+		versionOf:   versionOf,
+		pool:        pool,
+	}
+	service.transport = service.Transport(pool)
+	if requiresHTTP2(cfg.Protocol) {
+		if service.http2, err = newHTTP2Pool(pool, cfg.ConnectionPool); err != nil {
+			return nil, err
+		}
+		service.transport = service.Transport(service.http2)
+	}
+
+	for _, target := range targets {
+		inst := &instance{target: target}
+		inst.healthy.Store(true)
+		setHealthy(name, target, true)
+		if outlier != nil {
+			upstreamEjected.WithLabelValues(name, target.URL.Host).Set(0)
+		}
+		service.instances[target] = inst
+	}
+
+	if cfg.CircuitBreaker.Enabled {
+		service.breaker, err = newBreaker(name, serviceTarget, cfg.CircuitBreaker, log)
+		if err != nil {
+			return nil, err
+		}
+		if len(targets) > 1 {
+			for _, inst := range service.instances {
+				inst.breaker, err = newBreaker(name, inst.target.URL.Host, cfg.CircuitBreaker, log)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return service, nil
+}
+
+// newTargets creates the targets of a service
+func newTargets(targetConfigs []config.TargetConfig, protocol string) ([]*loadbalancer.Target, error) {
+	targets := make([]*loadbalancer.Target, 0, len(targetConfigs))
+	for _, targetConfig := range targetConfigs {
+		target, err := loadbalancer.NewTarget(targetConfig.URL, targetConfig.Weight)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateProtocol(protocol, target.URL.Scheme); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// Name returns the service name
+func (s *Service) Name() string {
+	return s.name
+}
+
+// Protocol returns the protocol spoken to the service's targets
+func (s *Service) Protocol() string {
+	return s.protocol
+}
+
+// Targets returns every configured instance of the service
+func (s *Service) Targets() []*loadbalancer.Target {
+	return s.targets
+}
+
+// Pick selects an available instance to serve the request. Callers other
+// than Transport report the outcome with Observe
+func (s *Service) Pick(r *http.Request) (*loadbalancer.Target, error) {
+	return s.pick(r, nil)
+}
+
+// pick selects an instance, avoiding the ones already tried for this
+// request while others are available
+func (s *Service) pick(r *http.Request, tried []*loadbalancer.Target) (*loadbalancer.Target, error) {
+	targets, err := s.available(versionFrom(r.Context()))
+	if err != nil {
+		return nil, err
+	}
+	if len(tried) > 0 && len(targets) > len(tried) {
+		untried := make([]*loadbalancer.Target, 0, len(targets))
+		for _, target := range targets {
+			if !containsTarget(tried, target) {
+				untried = append(untried, target)
+			}
+		}
+		if len(untried) > 0 {
+			targets = untried
+		}
+	}
+	target, err := s.balancer.Pick(r, targets)
+	if err != nil {
+		return nil, err
+	}
+	if inst := s.instances[target]; inst != nil && inst.breaker != nil && !inst.breaker.AllowRequest() {
+		return nil, &CircuitOpenError{Service: s.name, RetryAfter: inst.breaker.RetryAfter()}
+	}
+	return target, nil
+}
+
+// available returns the targets that can currently take requests, only
+// considering the targets of version when one is given
+func (s *Service) available(version string) ([]*loadbalancer.Target, error) {
+	if s.breaker != nil && !s.breaker.AllowRequest() {
+		return nil, &CircuitOpenError{Service: s.name, RetryAfter: s.breaker.RetryAfter()}
+	}
+
+	targets := make([]*loadbalancer.Target, 0, len(s.targets))
+	var ejected []*loadbalancer.Target
+	healthy := 0
+	var retryAfter time.Duration
+	for _, target := range s.targets {
+		if s.split != nil && version != "" && s.versionOf[target] != version {
+			continue
+		}
+		inst := s.instances[target]
+		if !inst.healthy.Load() {
+			continue
+		}
+		healthy++
+		if s.isEjected(inst) {
+			ejected = append(ejected, target)
+			continue
+		}
+		// Only the picked instance's breaker lets a trial request through
+		// once its reset timeout has passed
+		if inst.breaker != nil {
+			if wait := inst.breaker.RetryAfter(); wait > 0 {
+				if retryAfter == 0 || wait < retryAfter {
+					retryAfter = wait
+				}
+				continue
+			}
+		}
+		targets = append(targets, target)
+	}
+
+	switch {
+	case healthy == 0:
+		return nil, fmt.Errorf("service %s: %w", s.name, ErrNoHealthyTargets)
+	case len(targets) == 0 && len(ejected) > 0 && retryAfter == 0:
+		// Ejected instances are better than none when health checks took
+		// out the rest
+		return ejected, nil
+	case len(targets) == 0:
+		return nil, &CircuitOpenError{Service: s.name, RetryAfter: retryAfter}
+	}
+	return targets, nil
+}
+
+func containsTarget(targets []*loadbalancer.Target, target *loadbalancer.Target) bool {
+	for _, t := range targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Transport returns a RoundTripper sending requests to picked instances
+func (s *Service) Transport(base http.RoundTripper) http.RoundTripper {
+	return &balancingTransport{service: s, base: base}
+}
+
+// RoundTripper returns the service's balancing transport over its shared
+// connection pool
+func (s *Service) RoundTripper() http.RoundTripper {
+	return s.transport
+}
+
+// Pool returns the transport holding the connections to the service's
+// targets, for callers that need to dial them directly
+func (s *Service) Pool() *http.Transport {
+	return s.pool
+}
+
+// Close releases the idle connections of every service
+func (r *Registry) Close() {
+	for _, service := range r.services {
+		service.pool.CloseIdleConnections()
+		if service.http2 != nil {
+			service.http2.CloseIdleConnections()
+		}
+	}
+}
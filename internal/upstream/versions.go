@@ -0,0 +1,294 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/loadbalancer"
+)
+
+var ErrUnknownVersion = errors.New("unknown version")
+
+// versionKey is the context key holding the version selected for a request
+type versionKey struct{}
+
+// WithVersion restricts the instances picked for requests using ctx to the
+// targets of a version
+func WithVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, versionKey{}, version)
+}
+
+// versionFrom returns the version selected for a request, if any
+func versionFrom(ctx context.Context) string {
+	version, _ := ctx.Value(versionKey{}).(string)
+	return version
+}
+
+// VersionWeight is the share of traffic sent to a version
+type VersionWeight struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// trafficSplit divides a service's traffic between versions. Weights can
+// change at runtime, everything else is fixed.
+type trafficSplit struct {
+	service  string
+	versions []*version
+	hashOn   string
+	hashKey  string
+	header   string
+
+	mu sync.RWMutex
+}
+
+// version is a named group of a service's targets
+type version struct {
+	name         string
+	weight       int
+	headerValues []string
+}
+
+// newTrafficSplit creates the split of a service and the targets of every
+// version, keyed by target
+func newTrafficSplit(service string, cfg config.TrafficSplitConfig, protocol string) (*trafficSplit, map[*loadbalancer.Target]string, []*loadbalancer.Target, error) {
+	split := &trafficSplit{
+		service: service,
+		hashOn:  cfg.HashOn,
+		hashKey: cfg.HashKey,
+		header:  cfg.Header,
+	}
+	switch split.hashOn {
+	case "":
+		split.hashOn = "user"
+	case "user", "ip":
+	case "header", "cookie":
+		if split.hashKey == "" {
+			return nil, nil, nil, fmt.Errorf("traffic split hashing on a %s requires a hash key", split.hashOn)
+		}
+	default:
+		return nil, nil, nil, fmt.Errorf("traffic split cannot hash on %s", split.hashOn)
+	}
+
+	versionOf := make(map[*loadbalancer.Target]string)
+	var targets []*loadbalancer.Target
+	total := 0
+	for _, versionConfig := range cfg.Versions {
+		if versionConfig.Name == "" {
+			return nil, nil, nil, errors.New("traffic split version without a name")
+		}
+		for _, v := range split.versions {
+			if v.name == versionConfig.Name {
+				return nil, nil, nil, fmt.Errorf("duplicate version %s", v.name)
+			}
+		}
+		if versionConfig.Weight < 0 {
+			return nil, nil, nil, fmt.Errorf("version %s: negative weight", versionConfig.Name)
+		}
+
+		targetConfigs := versionConfig.Targets
+		if len(targetConfigs) == 0 {
+			if versionConfig.URL == "" {
+				return nil, nil, nil, fmt.Errorf("version %s: no url or targets configured", versionConfig.Name)
+			}
+			targetConfigs = []config.TargetConfig{{URL: versionConfig.URL, Weight: 1}}
+		}
+		versionTargets, err := newTargets(targetConfigs, protocol)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("version %s: %w", versionConfig.Name, err)
+		}
+		for _, target := range versionTargets {
+			versionOf[target] = versionConfig.Name
+		}
+		targets = append(targets, versionTargets...)
+
+		split.versions = append(split.versions, &version{
+			name:         versionConfig.Name,
+			weight:       versionConfig.Weight,
+			headerValues: versionConfig.HeaderValues,
+		})
+		versionWeight.WithLabelValues(service, versionConfig.Name).Set(float64(versionConfig.Weight))
+		total += versionConfig.Weight
+	}
+	if total == 0 {
+		return nil, nil, nil, errors.New("traffic split weights add up to 0")
+	}
+
+	return split, versionOf, targets, nil
+}
+
+// selectVersion picks the version serving a request. The header forces a
+// version, otherwise the sticky key places the request on the weights.
+func (t *trafficSplit) selectVersion(r *http.Request, user string) string {
+	if t.header != "" {
+		if value := r.Header.Get(t.header); value != "" {
+			for _, v := range t.versions {
+				if value == v.name || containsString(v.headerValues, value) {
+					return v.name
+				}
+			}
+		}
+	}
+
+	// Versions own consecutive ranges of [0, 1) in configuration order
+	h := fnv.New64a()
+	h.Write([]byte(t.key(r, user)))
+	point := float64(mix(h.Sum64())>>11) / (1 << 53)
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	total := 0
+	for _, v := range t.versions {
+		total += v.weight
+	}
+	bound := 0.0
+	for _, v := range t.versions {
+		bound += float64(v.weight) / float64(total)
+		if point < bound {
+			return v.name
+		}
+	}
+	// Rounding can leave the very top of the range to the last version
+	// with a weight
+	for i := len(t.versions) - 1; i >= 0; i-- {
+		if t.versions[i].weight > 0 {
+			return t.versions[i].name
+		}
+	}
+	return t.versions[0].name
+}
+
+// key extracts the sticky key from the request. Requests without a user,
+// header or cookie fall back to the client address.
+func (t *trafficSplit) key(r *http.Request, user string) string {
+	switch t.hashOn {
+	case "user":
+		if user != "" {
+			return user
+		}
+	case "header":
+		if v := r.Header.Get(t.hashKey); v != "" {
+			return v
+		}
+	case "cookie":
+		if cookie, err := r.Cookie(t.hashKey); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// weights returns the current weight of every version
+func (t *trafficSplit) weights() []VersionWeight {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	weights := make([]VersionWeight, 0, len(t.versions))
+	for _, v := range t.versions {
+		weights = append(weights, VersionWeight{Name: v.name, Weight: v.weight})
+	}
+	return weights
+}
+
+// setWeights changes the weights of the named versions, leaving the others
+// as they are
+func (t *trafficSplit) setWeights(weights map[string]int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	total := 0
+	for _, v := range t.versions {
+		weight, exists := weights[v.name]
+		if !exists {
+			weight = v.weight
+		}
+		if weight < 0 {
+			return fmt.Errorf("version %s: negative weight", v.name)
+		}
+		total += weight
+	}
+	for name := range weights {
+		if t.version(name) == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownVersion, name)
+		}
+	}
+	if total == 0 {
+		return errors.New("weights add up to 0")
+	}
+
+	for _, v := range t.versions {
+		if weight, exists := weights[v.name]; exists {
+			v.weight = weight
+			versionWeight.WithLabelValues(t.service, v.name).Set(float64(weight))
+		}
+	}
+	return nil
+}
+
+func (t *trafficSplit) version(name string) *version {
+	for _, v := range t.versions {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// mix spreads similar keys, which FNV leaves close together, over the whole
+// range (the murmur3 finalizer)
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectVersion picks the version that serves a request, or "" when the
+// service has no traffic split. user is the authenticated user, if any.
+func (s *Service) SelectVersion(r *http.Request, user string) string {
+	if s.split == nil {
+		return ""
+	}
+	return s.split.selectVersion(r, user)
+}
+
+// Versions returns the versions of a split service and their weights
+func (s *Service) Versions() []VersionWeight {
+	if s.split == nil {
+		return nil
+	}
+	return s.split.weights()
+}
+
+// SetVersionWeights changes the share of traffic of the named versions
+func (s *Service) SetVersionWeights(weights map[string]int) error {
+	if s.split == nil {
+		return fmt.Errorf("service %s has no traffic split", s.name)
+	}
+	if err := s.split.setWeights(weights); err != nil {
+		return err
+	}
+	s.logger.Info("Changed version weights", "service", s.name, "weights", weights)
+	return nil
+}
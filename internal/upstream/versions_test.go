@@ -0,0 +1,144 @@
+package upstream
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/internal/config"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+func newSplitService(t *testing.T, stable, canary int) *Service {
+	t.Helper()
+	return newTestService(t, config.ServiceConfig{
+		TrafficSplit: config.TrafficSplitConfig{
+			Header: "X-Canary",
+			Versions: []config.VersionConfig{
+				{Name: "stable", Weight: stable, Targets: []config.TargetConfig{{URL: "http://10.0.0.1"}, {URL: "http://10.0.0.2"}}},
+				{Name: "canary", Weight: canary, URL: "http://10.0.1.1", HeaderValues: []string{"always"}},
+			},
+		},
+	})
+}
+
+// shares counts the versions chosen for n distinct users
+func shares(service *Service, n int) map[string]int {
+	counts := make(map[string]int)
+	req := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < n; i++ {
+		counts[service.SelectVersion(req, fmt.Sprintf("user-%d", i))]++
+	}
+	return counts
+}
+
+func TestVersions_WeightedAndSticky(t *testing.T) {
+	service := newSplitService(t, 90, 10)
+
+	counts := shares(service, 10000)
+	assert.InDelta(t, 1000, counts["canary"], 150)
+	assert.Equal(t, 10000, counts["stable"]+counts["canary"])
+
+	req := httptest.NewRequest("GET", "/", nil)
+	first := service.SelectVersion(req, "alice")
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, service.SelectVersion(req, "alice"))
+	}
+
+	// Growing the canary only moves users onto it
+	var canaryUsers []string
+	for i := 0; i < 1000; i++ {
+		if user := fmt.Sprintf("user-%d", i); service.SelectVersion(req, user) == "canary" {
+			canaryUsers = append(canaryUsers, user)
+		}
+	}
+	require.NoError(t, service.SetVersionWeights(map[string]int{"stable": 50, "canary": 50}))
+	for _, user := range canaryUsers {
+		assert.Equal(t, "canary", service.SelectVersion(req, user))
+	}
+	assert.InDelta(t, 5000, shares(service, 10000)["canary"], 300)
+}
+
+func TestVersions_HeaderForcesVersion(t *testing.T) {
+	service := newSplitService(t, 100, 0)
+	assert.Equal(t, map[string]int{"stable": 1000}, shares(service, 1000))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Canary", "always")
+	assert.Equal(t, "canary", service.SelectVersion(req, "alice"))
+	req.Header.Set("X-Canary", "stable")
+	assert.Equal(t, "stable", service.SelectVersion(req, "alice"))
+	req.Header.Set("X-Canary", "unknown")
+	assert.Equal(t, "stable", service.SelectVersion(req, "alice"))
+}
+
+func TestVersions_PickStaysInVersion(t *testing.T) {
+	service := newSplitService(t, 50, 50)
+	assert.Len(t, service.Targets(), 3)
+
+	for _, version := range []string{"stable", "canary"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req = req.WithContext(WithVersion(req.Context(), version))
+		for i := 0; i < 10; i++ {
+			target, err := service.Pick(req)
+			require.NoError(t, err)
+			assert.Equal(t, version, service.versionOf[target])
+		}
+	}
+}
+
+func TestVersions_SetWeights(t *testing.T) {
+	service := newSplitService(t, 90, 10)
+
+	assert.ErrorIs(t, service.SetVersionWeights(map[string]int{"beta": 5}), ErrUnknownVersion)
+	assert.Error(t, service.SetVersionWeights(map[string]int{"canary": -1}))
+	assert.Error(t, service.SetVersionWeights(map[string]int{"stable": 0, "canary": 0}))
+	assert.Equal(t, []VersionWeight{{"stable", 90}, {"canary", 10}}, service.Versions())
+
+	require.NoError(t, service.SetVersionWeights(map[string]int{"canary": 30}))
+	assert.Equal(t, []VersionWeight{{"stable", 90}, {"canary", 30}}, service.Versions())
+
+	plain := newTestService(t, config.ServiceConfig{URL: "http://10.0.0.1"})
+	assert.Nil(t, plain.Versions())
+	assert.Error(t, plain.SetVersionWeights(map[string]int{"canary": 1}))
+	assert.Empty(t, plain.SelectVersion(httptest.NewRequest("GET", "/", nil), "alice"))
+}
+
+func TestVersions_InvalidConfig(t *testing.T) {
+	version := config.VersionConfig{Name: "stable", Weight: 1, URL: "http://10.0.0.1"}
+	for name, cfg := range map[string]config.ServiceConfig{
+		"url and versions":   {URL: "http://10.0.0.1", TrafficSplit: config.TrafficSplitConfig{Versions: []config.VersionConfig{version}}},
+		"unnamed version":    {TrafficSplit: config.TrafficSplitConfig{Versions: []config.VersionConfig{{Weight: 1, URL: "http://10.0.0.1"}}}},
+		"duplicate version":  {TrafficSplit: config.TrafficSplitConfig{Versions: []config.VersionConfig{version, version}}},
+		"no targets":         {TrafficSplit: config.TrafficSplitConfig{Versions: []config.VersionConfig{{Name: "stable", Weight: 1}}}},
+		"zero weights":       {TrafficSplit: config.TrafficSplitConfig{Versions: []config.VersionConfig{{Name: "stable", URL: "http://10.0.0.1"}}}},
+		"header without key": {TrafficSplit: config.TrafficSplitConfig{HashOn: "header", Versions: []config.VersionConfig{version}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := newService("test", cfg, logger.New("error"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestVersions_StickyKeyFallsBackToClientAddress(t *testing.T) {
+	service := newTestService(t, config.ServiceConfig{
+		TrafficSplit: config.TrafficSplitConfig{
+			HashOn:  "cookie",
+			HashKey: "session",
+			Versions: []config.VersionConfig{
+				{Name: "stable", Weight: 1, URL: "http://10.0.0.1"},
+				{Name: "canary", Weight: 1, URL: "http://10.0.1.1"},
+			},
+		},
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	assert.Equal(t, "abc", service.split.key(req, "alice"))
+	assert.Equal(t, "192.0.2.1", service.split.key(httptest.NewRequest("GET", "/", nil), "alice"))
+}
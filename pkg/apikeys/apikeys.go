@@ -0,0 +1,177 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// keyPrefix starts every key so that leaked keys are easy to spot
+const keyPrefix = "gwk_"
+
+var (
+	// ErrInvalidKey is returned for keys that are malformed, unknown,
+	// revoked or expired alike
+	ErrInvalidKey = errors.New("invalid api key")
+	// ErrNotFound is returned for key IDs the store doesn't hold
+	ErrNotFound = errors.New("api key not found")
+)
+
+// Key is an API key of a consumer. Only the hash of its secret is kept.
+type Key struct {
+	ID       string   `json:"id"`
+	Consumer string   `json:"consumer"`
+	Services []string `json:"services"`
+	// Hash is the SHA-256 hash of the key's secret
+	Hash      []byte     `json:"hash"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Expired reports whether the key expired at now
+func (k *Key) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Allows reports whether the key may be used for the service
+func (k *Key) Allows(service string) bool {
+	for _, s := range k.Services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// Store keeps API keys by ID. Stores may drop expired keys.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Put adds or replaces a key
+	Put(ctx context.Context, key *Key) error
+	// Get returns the key with the ID, or ErrNotFound
+	Get(ctx context.Context, id string) (*Key, error)
+	// List returns every key
+	List(ctx context.Context) ([]*Key, error)
+	// Delete removes the key with the ID, or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+}
+
+// Manager issues API keys and checks the keys sent with requests
+type Manager struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewManager creates a manager keeping its keys in store
+func NewManager(store Store) *Manager {
+	return &Manager{store: store, now: time.Now}
+}
+
+// Create issues a key of a consumer for services, expiring at expiresAt
+// unless it is nil. The returned key is the only copy of its secret.
+func (m *Manager) Create(ctx context.Context, consumer string, services []string, expiresAt *time.Time) (string, *Key, error) {
+	id, err := random(8, hex.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := random(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+	hash := sha256.Sum256([]byte(secret))
+	key := &Key{
+		ID:        id,
+		Consumer:  consumer,
+		Services:  services,
+		Hash:      hash[:],
+		CreatedAt: m.now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+	if err := m.store.Put(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return keyPrefix + id + "." + secret, key, nil
+}
+
+// Authenticate returns the key of a secret sent with a request, or
+// ErrInvalidKey
+func (m *Manager) Authenticate(ctx context.Context, apiKey string) (*Key, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(apiKey, keyPrefix), ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidKey
+	}
+	key, err := m.store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(hash[:], key.Hash) != 1 || key.Expired(m.now()) {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// List returns the unexpired keys, of one consumer unless it is empty
+func (m *Manager) List(ctx context.Context, consumer string) ([]*Key, error) {
+	keys, err := m.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := m.now()
+	listed := make([]*Key, 0, len(keys))
+	for _, key := range keys {
+		if !key.Expired(now) && (consumer == "" || key.Consumer == consumer) {
+			listed = append(listed, key)
+		}
+	}
+	return listed, nil
+}
+
+// Rotate replaces a key with a new one of the same consumer, services and
+// expiry. The old key stays valid for grace, so that clients can switch.
+func (m *Manager) Rotate(ctx context.Context, id string, grace time.Duration) (string, *Key, error) {
+	old, err := m.store.Get(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if old.Expired(m.now()) {
+		return "", nil, ErrNotFound
+	}
+	apiKey, key, err := m.Create(ctx, old.Consumer, old.Services, old.ExpiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if grace <= 0 {
+		err = m.store.Delete(ctx, id)
+	} else if expires := m.now().Add(grace).UTC(); !old.Expired(expires) {
+		old.ExpiresAt = &expires
+		err = m.store.Put(ctx, old)
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", nil, err
+	}
+	return apiKey, key, nil
+}
+
+// Revoke deletes a key, which is rejected from then on
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	return m.store.Delete(ctx, id)
+}
+
+func random(size int, encode func([]byte) string) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
@@ -0,0 +1,139 @@
+package apikeys
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testManager checks a manager whose clock advance moves forward
+func testManager(t *testing.T, m *Manager, advance func(time.Duration)) {
+	t.Helper()
+	ctx := context.Background()
+
+	apiKey, key, err := m.Create(ctx, "partner", []string{"orders"}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(apiKey, "gwk_"+key.ID+"."))
+
+	authenticated, err := m.Authenticate(ctx, apiKey)
+	require.NoError(t, err)
+	assert.Equal(t, "partner", authenticated.Consumer)
+	assert.True(t, authenticated.Allows("orders"))
+	assert.False(t, authenticated.Allows("users"))
+
+	for _, invalid := range []string{"", "gwk_", apiKey + "x", "gwk_" + key.ID + ".secret", "gwk_unknown." + strings.Split(apiKey, ".")[1]} {
+		_, err := m.Authenticate(ctx, invalid)
+		assert.ErrorIs(t, err, ErrInvalidKey, invalid)
+	}
+
+	// Keys expire
+	expires := m.now().Add(time.Hour)
+	expiring, _, err := m.Create(ctx, "other", []string{"users"}, &expires)
+	require.NoError(t, err)
+	_, err = m.Authenticate(ctx, expiring)
+	require.NoError(t, err)
+
+	keys, err := m.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+	keys, err = m.List(ctx, "partner")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, key.ID, keys[0].ID)
+
+	advance(time.Hour)
+	_, err = m.Authenticate(ctx, expiring)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	keys, err = m.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	// Rotated keys stay valid for the grace period
+	rotated, rotatedKey, err := m.Rotate(ctx, key.ID, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, rotatedKey.Services)
+	_, err = m.Authenticate(ctx, apiKey)
+	assert.NoError(t, err)
+	advance(time.Minute)
+	_, err = m.Authenticate(ctx, apiKey)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = m.Authenticate(ctx, rotated)
+	assert.NoError(t, err)
+
+	// Without a grace period the old key is revoked at once
+	again, againKey, err := m.Rotate(ctx, rotatedKey.ID, 0)
+	require.NoError(t, err)
+	_, err = m.Authenticate(ctx, rotated)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	require.NoError(t, m.Revoke(ctx, againKey.ID))
+	_, err = m.Authenticate(ctx, again)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	assert.ErrorIs(t, m.Revoke(ctx, againKey.ID), ErrNotFound)
+	_, _, err = m.Rotate(ctx, againKey.ID, 0)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManager_MemoryStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	m := NewManager(store)
+	m.now = store.now
+	testManager(t, m, func(duration time.Duration) { now = now.Add(duration) })
+}
+
+func newRedisStore(t *testing.T) (*miniredis.Miniredis, *RedisStore) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return server, NewRedisStore(client, "apikeys:")
+}
+
+func TestManager_RedisStore(t *testing.T) {
+	server, store := newRedisStore(t)
+	now := time.Now()
+	server.SetTime(now)
+	m := NewManager(store)
+	m.now = func() time.Time { return now }
+	testManager(t, m, func(duration time.Duration) {
+		now = now.Add(duration)
+		server.SetTime(now)
+		server.FastForward(duration)
+	})
+}
+
+func TestRedisStore_SharedAcrossReplicas(t *testing.T) {
+	server, store := newRedisStore(t)
+	replicaA, replicaB := NewManager(store), NewManager(NewRedisStore(store.client, "apikeys:"))
+	ctx := context.Background()
+
+	apiKey, key, err := replicaA.Create(ctx, "partner", []string{"orders"}, nil)
+	require.NoError(t, err)
+	assert.True(t, server.Exists("apikeys:key:"+key.ID))
+	_, err = replicaB.Authenticate(ctx, apiKey)
+	assert.NoError(t, err)
+
+	require.NoError(t, replicaB.Revoke(ctx, key.ID))
+	_, err = replicaA.Authenticate(ctx, apiKey)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestRedisStore_Unavailable(t *testing.T) {
+	server, store := newRedisStore(t)
+	m := NewManager(store)
+	apiKey, _, err := m.Create(context.Background(), "partner", []string{"orders"}, nil)
+	require.NoError(t, err)
+	server.Close()
+
+	_, err = m.Authenticate(context.Background(), apiKey)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,77 @@
+package apikeys
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps keys in process memory, so they are lost on restart
+type MemoryStore struct {
+	mu   sync.Mutex
+	keys map[string]*Key
+	now  func() time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]*Key), now: time.Now}
+}
+
+// Put adds or replaces a key, dropping expired keys
+func (s *MemoryStore) Put(_ context.Context, key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for id, stored := range s.keys {
+		if stored.Expired(now) {
+			delete(s.keys, id)
+		}
+	}
+	copied := *key
+	s.keys[key.ID] = &copied
+	return nil
+}
+
+// Get returns a copy of the key with the ID
+func (s *MemoryStore) Get(_ context.Context, id string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.keys[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+// List returns copies of every key, oldest first
+func (s *MemoryStore) List(_ context.Context) ([]*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Delete removes the key with the ID
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.keys[id]; !exists {
+		return ErrNotFound
+	}
+	delete(s.keys, id)
+	return nil
+}
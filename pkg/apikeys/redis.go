@@ -0,0 +1,112 @@
+package apikeys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scanBatch is the number of keys scanned per command when listing
+const scanBatch = 100
+
+// RedisStore keeps keys in Redis so that gateway replicas share them.
+// Expired keys are dropped by Redis.
+type RedisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore creates a store keeping its keys under prefix
+func NewRedisStore(client redis.Cmdable, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) keyKey(id string) string {
+	return s.prefix + "key:" + id
+}
+
+// Put adds or replaces a key, which Redis drops once it expires
+func (s *RedisStore) Put(ctx context.Context, key *Key) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.keyKey(key.ID), data, 0)
+		if key.ExpiresAt != nil {
+			pipe.ExpireAt(ctx, s.keyKey(key.ID), *key.ExpiresAt)
+		}
+		return nil
+	})
+	return err
+}
+
+// Get returns the key with the ID
+func (s *RedisStore) Get(ctx context.Context, id string) (*Key, error) {
+	data, err := s.client.Get(ctx, s.keyKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var key Key
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// List scans the store's keys, oldest first
+func (s *RedisStore) List(ctx context.Context) ([]*Key, error) {
+	var keys []*Key
+	prefix := s.keyKey("")
+	iter := s.client.Scan(ctx, 0, escapePattern(prefix)+"*", scanBatch).Iterator()
+	for iter.Next(ctx) {
+		key, err := s.Get(ctx, strings.TrimPrefix(iter.Val(), prefix))
+		if errors.Is(err, ErrNotFound) {
+			// Expired while scanning
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Delete removes the key with the ID
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	n, err := s.client.Del(ctx, s.keyKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// escapePattern escapes the glob characters of a SCAN pattern
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
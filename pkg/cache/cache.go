@@ -0,0 +1,20 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps cached values by key until their ttl expires
+type Store interface {
+	// Get returns the value of key and whether it was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores a value, tagged so that DeleteTagged can find it
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error
+	// Delete removes keys and returns how many were stored
+	Delete(ctx context.Context, keys ...string) (int, error)
+	// DeleteMatching removes the keys match accepts
+	DeleteMatching(ctx context.Context, match func(key string) bool) (int, error)
+	// DeleteTagged removes the keys set with any of tags, past or present
+	DeleteTagged(ctx context.Context, tags ...string) (int, error)
+}
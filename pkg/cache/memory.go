@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a least recently used cache in process memory bounded by
+// the total size of its keys and values
+type MemoryStore struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	tagged   map[string]map[string]struct{}
+	lru      *list.List
+	size     int64
+	maxBytes int64
+	now      func() time.Time
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	tags    []string
+	expires time.Time
+}
+
+// NewMemoryStore creates an in-memory store holding at most maxBytes
+func NewMemoryStore(maxBytes int64) *MemoryStore {
+	return &MemoryStore{
+		entries:  make(map[string]*list.Element),
+		tagged:   make(map[string]map[string]struct{}),
+		lru:      list.New(),
+		maxBytes: maxBytes,
+		now:      time.Now,
+	}
+}
+
+// Get returns the value of key unless it is missing or expired
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, exists := s.entries[key]
+	if !exists {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if !s.now().Before(entry.expires) {
+		s.remove(element)
+		return nil, false, nil
+	}
+	s.lru.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+// Set stores a value, evicting the least recently used entries to make
+// room. Values larger than the whole store aren't kept.
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, exists := s.entries[key]; exists {
+		s.remove(element)
+	}
+	size := entrySize(key, value)
+	if size > s.maxBytes || ttl <= 0 {
+		return nil
+	}
+	for s.size+size > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+
+	s.entries[key] = s.lru.PushFront(&memoryEntry{key: key, value: value, tags: tags, expires: s.now().Add(ttl)})
+	s.size += size
+	for _, tag := range tags {
+		if s.tagged[tag] == nil {
+			s.tagged[tag] = make(map[string]struct{})
+		}
+		s.tagged[tag][key] = struct{}{}
+	}
+	return nil
+}
+
+// Delete removes keys from the store
+func (s *MemoryStore) Delete(_ context.Context, keys ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delete(keys), nil
+}
+
+// DeleteMatching removes the keys match accepts
+func (s *MemoryStore) DeleteMatching(_ context.Context, match func(key string) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for key := range s.entries {
+		if match(key) {
+			keys = append(keys, key)
+		}
+	}
+	return s.delete(keys), nil
+}
+
+// DeleteTagged removes the keys set with any of tags
+func (s *MemoryStore) DeleteTagged(_ context.Context, tags ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for _, tag := range tags {
+		for key := range s.tagged[tag] {
+			keys = append(keys, key)
+		}
+	}
+	return s.delete(keys), nil
+}
+
+// Len returns the number of entries in the store
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// Size returns the number of bytes held by the store
+func (s *MemoryStore) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func (s *MemoryStore) delete(keys []string) int {
+	deleted := 0
+	for _, key := range keys {
+		if element, exists := s.entries[key]; exists {
+			s.remove(element)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+	entry := s.lru.Remove(element).(*memoryEntry)
+	delete(s.entries, entry.key)
+	s.size -= entrySize(entry.key, entry.value)
+	for _, tag := range entry.tags {
+		delete(s.tagged[tag], entry.key)
+		if len(s.tagged[tag]) == 0 {
+			delete(s.tagged, tag)
+		}
+	}
+}
+
+func entrySize(key string, value []byte) int64 {
+	return int64(len(key) + len(value))
+}
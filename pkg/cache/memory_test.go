@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, s Store, key string) (string, bool) {
+	t.Helper()
+	value, found, err := s.Get(context.Background(), key)
+	require.NoError(t, err)
+	return string(value), found
+}
+
+func TestMemoryStore_GetSet(t *testing.T) {
+	s := NewMemoryStore(1024)
+	ctx := context.Background()
+
+	_, found := get(t, s, "a")
+	assert.False(t, found)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("one"), time.Minute))
+	value, found := get(t, s, "a")
+	assert.True(t, found)
+	assert.Equal(t, "one", value)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("three"), time.Minute))
+	value, _ = get(t, s, "a")
+	assert.Equal(t, "three", value)
+	assert.Equal(t, int64(6), s.Size())
+
+	deleted, err := s.Delete(ctx, "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, found = get(t, s, "a")
+	assert.False(t, found)
+	assert.Equal(t, int64(0), s.Size())
+}
+
+func TestMemoryStore_Expires(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewMemoryStore(1024)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.Set(context.Background(), "a", []byte("one"), time.Minute))
+	now = now.Add(59 * time.Second)
+	_, found := get(t, s, "a")
+	assert.True(t, found)
+
+	now = now.Add(time.Second)
+	_, found = get(t, s, "a")
+	assert.False(t, found)
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestMemoryStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	// Every entry takes 10 bytes
+	s := NewMemoryStore(30)
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Set(ctx, key, []byte("123456789"), time.Minute))
+	}
+	get(t, s, "a")
+
+	require.NoError(t, s.Set(ctx, "d", []byte("123456789"), time.Minute))
+	assert.Equal(t, 3, s.Len())
+	_, found := get(t, s, "b")
+	assert.False(t, found)
+	for _, key := range []string{"a", "c", "d"} {
+		_, found := get(t, s, key)
+		assert.True(t, found, key)
+	}
+
+	// A value larger than the store is dropped without evicting anything
+	require.NoError(t, s.Set(ctx, "e", make([]byte, 64), time.Minute))
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, int64(30), s.Size())
+}
+
+func TestMemoryStore_Purge(t *testing.T) {
+	testPurge(t, NewMemoryStore(1024))
+}
+
+func TestMemoryStore_EvictionUntags(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(20)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("123456789"), time.Minute, "news"))
+	require.NoError(t, s.Set(ctx, "b", []byte("123456789"), time.Minute))
+	require.NoError(t, s.Set(ctx, "c", []byte("123456789"), time.Minute, "news"))
+	assert.Len(t, s.tagged["news"], 1)
+}
+
+// testPurge checks the deletion of a store's keys by key, match and tag
+func testPurge(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	set := func(key string, tags ...string) {
+		require.NoError(t, s.Set(ctx, key, []byte("value"), time.Minute, tags...))
+	}
+	set("public|/news/1", "news", "article-1")
+	set("public|/news/2", "news", "article-2")
+	set("public|/sports/1", "sports", "article-3")
+	set("public|/weather")
+
+	deleted, err := s.DeleteTagged(ctx, "article-2", "article-3", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	for key, want := range map[string]bool{"public|/news/1": true, "public|/news/2": false, "public|/sports/1": false} {
+		_, found := get(t, s, key)
+		assert.Equal(t, want, found, key)
+	}
+
+	set("public|/news/3", "news")
+	deleted, err = s.DeleteMatching(ctx, func(key string) bool { return strings.HasPrefix(key, "public|/news/") })
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	_, found := get(t, s, "public|/weather")
+	assert.True(t, found)
+
+	// Tags no longer find deleted keys
+	deleted, err = s.DeleteTagged(ctx, "news")
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// setScript stores a value and adds its key to the sets of its tags. Tag
+// sets live as long as their longest lived key.
+//
+// KEYS[1]: value key
+// KEYS[2...]: tag sets
+// ARGV[1]: value
+// ARGV[2]: ttl in milliseconds
+// ARGV[3]: key as given to Set
+var setScript = redis.NewScript(`
+local ttl = tonumber(ARGV[2])
+redis.call("SET", KEYS[1], ARGV[1], "PX", ttl)
+for i = 2, #KEYS do
+	redis.call("SADD", KEYS[i], ARGV[3])
+	if redis.call("PTTL", KEYS[i]) < ttl then
+		redis.call("PEXPIRE", KEYS[i], ttl)
+	end
+end
+return 1
+`)
+
+// deleteBatch is the number of keys deleted per command when purging
+const deleteBatch = 100
+
+// RedisStore keeps values in Redis so that gateway replicas share them
+type RedisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore creates a store keeping its values under prefix
+func NewRedisStore(client redis.Cmdable, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) valueKey(key string) string {
+	return s.prefix + "key:" + key
+}
+
+func (s *RedisStore) tagKey(tag string) string {
+	return s.prefix + "tag:" + tag
+}
+
+// Get returns the value of key
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, s.valueKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores a value for ttl, rounded down to milliseconds
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	if ttl.Milliseconds() <= 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(tags)+1)
+	keys = append(keys, s.valueKey(key))
+	for _, tag := range tags {
+		keys = append(keys, s.tagKey(tag))
+	}
+	return setScript.Run(ctx, s.client, keys, value, ttl.Milliseconds(), key).Err()
+}
+
+// Delete removes keys from the store
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) (int, error) {
+	deleted := 0
+	for start := 0; start < len(keys); start += deleteBatch {
+		batch := keys[start:min(start+deleteBatch, len(keys))]
+		valueKeys := make([]string, len(batch))
+		for i, key := range batch {
+			valueKeys[i] = s.valueKey(key)
+		}
+		n, err := s.client.Del(ctx, valueKeys...).Result()
+		deleted += int(n)
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteMatching scans the store's keys and removes those match accepts
+func (s *RedisStore) DeleteMatching(ctx context.Context, match func(key string) bool) (int, error) {
+	var keys []string
+	prefix := s.valueKey("")
+	iter := s.client.Scan(ctx, 0, escapePattern(prefix)+"*", deleteBatch).Iterator()
+	for iter.Next(ctx) {
+		if key := strings.TrimPrefix(iter.Val(), prefix); match(key) {
+			keys = append(keys, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+	return s.Delete(ctx, keys...)
+}
+
+// DeleteTagged removes the keys set with any of tags, and the tags
+func (s *RedisStore) DeleteTagged(ctx context.Context, tags ...string) (int, error) {
+	deleted := 0
+	for _, tag := range tags {
+		keys, err := s.client.SMembers(ctx, s.tagKey(tag)).Result()
+		if err != nil {
+			return deleted, err
+		}
+		n, err := s.Delete(ctx, keys...)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		if err := s.client.Del(ctx, s.tagKey(tag)).Err(); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// escapePattern escapes the glob characters of a SCAN pattern
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
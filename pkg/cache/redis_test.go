@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedisStore(t *testing.T) (*miniredis.Miniredis, *RedisStore) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return server, NewRedisStore(client, "cache:")
+}
+
+func TestRedisStore_SharedAcrossReplicas(t *testing.T) {
+	server, replicaA := newRedisStore(t)
+	replicaB := NewRedisStore(replicaA.client, "cache:")
+	ctx := context.Background()
+
+	require.NoError(t, replicaA.Set(ctx, "public|/news", []byte("headlines"), time.Minute, "news"))
+	value, found := get(t, replicaB, "public|/news")
+	assert.True(t, found)
+	assert.Equal(t, "headlines", value)
+	assert.True(t, server.Exists("cache:key:public|/news"))
+	assert.Equal(t, time.Minute, server.TTL("cache:tag:news"))
+
+	// Tag sets outlive their longest lived key
+	require.NoError(t, replicaA.Set(ctx, "public|/news/1", []byte("story"), time.Second, "news"))
+	assert.Equal(t, time.Minute, server.TTL("cache:tag:news"))
+
+	server.FastForward(time.Minute)
+	_, found = get(t, replicaB, "public|/news")
+	assert.False(t, found)
+}
+
+func TestRedisStore_Purge(t *testing.T) {
+	_, s := newRedisStore(t)
+	testPurge(t, s)
+}
+
+func TestRedisStore_Unavailable(t *testing.T) {
+	server, s := newRedisStore(t)
+	server.Close()
+
+	_, _, err := s.Get(context.Background(), "public|/news")
+	assert.Error(t, err)
+	assert.Error(t, s.Set(context.Background(), "public|/news", []byte("headlines"), time.Minute))
+}
+
+func TestEscapePattern(t *testing.T) {
+	assert.Equal(t, `gw\[1\]:\*\?`, escapePattern("gw[1]:*?"))
+}
@@ -17,9 +17,23 @@ var (
 	ErrCircuitOpen = errors.New("circuit breaker is open")
 )
 
+// StateName returns a human readable name for a state
+func StateName(state int) string {
+	switch state {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
 // CircuitBreaker implements the circuit breaker pattern
 type CircuitBreaker struct {
-	mutex                    sync.RWMutex
+	mutex                    sync.Mutex
 	state                    int
 	failureCount             int
 	failureThreshold         int
@@ -27,6 +41,7 @@ type CircuitBreaker struct {
 	lastFailureTime          time.Time
 	halfOpenSuccess          int
 	halfOpenSuccessThreshold int
+	onStateChange            func(from, to int)
 }
 
 // NewCircuitBreaker creates a new circuit breaker
@@ -39,6 +54,14 @@ func NewCircuitBreaker(failureThreshold int, resetTimeout time.Duration, halfOpe
 	}
 }
 
+// OnStateChange registers a function called after every state transition.
+// It runs outside the breaker's lock, so it may query the breaker.
+func (cb *CircuitBreaker) OnStateChange(fn func(from, to int)) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.onStateChange = fn
+}
+
 // Execute runs the given function with circuit breaker protection
 func (cb *CircuitBreaker) Execute(fn func() error) error {
 	// Check if circuit is open
@@ -49,43 +72,78 @@ func (cb *CircuitBreaker) Execute(fn func() error) error {
 	err := fn()
 
 	// Handle result
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
-
 	if err != nil {
-		cb.recordFailure()
+		cb.RecordFailure()
 		return err
 	}
 
-	cb.recordSuccess()
+	cb.RecordSuccess()
 	return nil
 }
 
 // AllowRequest checks if a request can be made
 func (cb *CircuitBreaker) AllowRequest() bool {
-	cb.mutex.RLock()
-	defer cb.mutex.RUnlock()
+	cb.mutex.Lock()
+	from := cb.state
 
+	allowed := false
 	switch cb.state {
-	case StateClosed:
-		return true
+	case StateClosed, StateHalfOpen:
+		allowed = true
 	case StateOpen:
 		// Check if reset timeout has expired
 		if time.Since(cb.lastFailureTime) > cb.resetTimeout {
 			// Transition to half-open
-			cb.mutex.RUnlock()
-			cb.mutex.Lock()
 			cb.state = StateHalfOpen
 			cb.halfOpenSuccess = 0
-			cb.mutex.Unlock()
-			cb.mutex.RLock()
-			return true
+			allowed = true
 		}
-		return false
-	case StateHalfOpen:
-		return true
-	default:
-		return false
+	}
+
+	cb.unlockAndNotify(from)
+	return allowed
+}
+
+// RecordFailure records a failed request
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mutex.Lock()
+	from := cb.state
+	cb.recordFailure()
+	cb.unlockAndNotify(from)
+}
+
+// RecordSuccess records a successful request
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mutex.Lock()
+	from := cb.state
+	cb.recordSuccess()
+	cb.unlockAndNotify(from)
+}
+
+// RetryAfter returns how long an open breaker keeps rejecting requests
+func (cb *CircuitBreaker) RetryAfter() time.Duration {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state != StateOpen {
+		return 0
+	}
+	remaining := cb.resetTimeout - time.Since(cb.lastFailureTime)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// unlockAndNotify releases the lock and reports a transition away from the
+// given state
+func (cb *CircuitBreaker) unlockAndNotify(from int) {
+	to := cb.state
+	notify := cb.onStateChange
+	cb.mutex.Unlock()
+
+	if notify != nil && from != to {
+		notify(from, to)
 	}
 }
 
@@ -120,7 +178,7 @@ func (cb *CircuitBreaker) recordSuccess() {
 
 // GetState returns the current state of the circuit breaker
 func (cb *CircuitBreaker) GetState() int {
-	cb.mutex.RLock()
-	defer cb.mutex.RUnlock()
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
 	return cb.state
 }
@@ -0,0 +1,56 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	cb := NewCircuitBreaker(2, time.Minute, 1)
+	failing := errors.New("boom")
+
+	assert.Equal(t, failing, cb.Execute(func() error { return failing }))
+	assert.Equal(t, StateClosed, cb.GetState())
+	assert.Equal(t, failing, cb.Execute(func() error { return failing }))
+	assert.Equal(t, StateOpen, cb.GetState())
+
+	assert.Equal(t, ErrCircuitOpen, cb.Execute(func() error { return nil }))
+	assert.InDelta(t, time.Minute.Seconds(), cb.RetryAfter().Seconds(), 1)
+}
+
+func TestCircuitBreaker_HalfOpenRecovery(t *testing.T) {
+	cb := NewCircuitBreaker(1, 10*time.Millisecond, 2)
+
+	var transitions []string
+	cb.OnStateChange(func(from, to int) {
+		// The callback runs outside the lock
+		assert.Equal(t, to, cb.GetState())
+		transitions = append(transitions, StateName(from)+">"+StateName(to))
+	})
+
+	cb.RecordFailure()
+	time.Sleep(20 * time.Millisecond)
+
+	assert.True(t, cb.AllowRequest())
+	cb.RecordSuccess()
+	assert.Equal(t, StateHalfOpen, cb.GetState())
+	cb.RecordSuccess()
+	assert.Equal(t, StateClosed, cb.GetState())
+
+	assert.Equal(t, []string{"closed>open", "open>half-open", "half-open>closed"}, transitions)
+}
+
+func TestCircuitBreaker_HalfOpenFailureReopens(t *testing.T) {
+	cb := NewCircuitBreaker(1, 10*time.Millisecond, 1)
+
+	cb.RecordFailure()
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, cb.AllowRequest())
+
+	cb.RecordFailure()
+	assert.Equal(t, StateOpen, cb.GetState())
+	assert.False(t, cb.AllowRequest())
+}
@@ -0,0 +1,43 @@
+package jwks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Discovery is the part of an OpenID Connect discovery document
+// describing how the issuer signs its tokens
+type Discovery struct {
+	Issuer     string   `json:"issuer"`
+	JWKSURI    string   `json:"jwks_uri"`
+	Algorithms []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// DiscoveryURL returns where an issuer serves its discovery document
+func DiscoveryURL(issuer string) string {
+	return strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+}
+
+// Discover fetches the discovery document of an issuer, which must name
+// the issuer as it is given
+func Discover(ctx context.Context, client *http.Client, issuer string) (*Discovery, error) {
+	data, err := get(ctx, client, DiscoveryURL(issuer))
+	if err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+	var discovery Discovery
+	if err := json.Unmarshal(data, &discovery); err != nil {
+		return nil, fmt.Errorf("invalid discovery document: %w", err)
+	}
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q", discovery.Issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document has no jwks_uri")
+	}
+	return &discovery, nil
+}
@@ -0,0 +1,169 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Key is a public key of a JSON Web Key Set
+type Key struct {
+	// ID is the key's kid, which tokens name to pick it
+	ID string
+	// Algorithm restricts the key to one signing algorithm when set
+	Algorithm string
+	// Public is an *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+	Public crypto.PublicKey
+}
+
+// Set is a JSON Web Key Set
+type Set struct {
+	Keys []Key
+}
+
+// jsonWebKey is a key as encoded in a key set (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Parse decodes the signature verification keys of a key set. Encryption
+// keys and key types other than RSA, EC and Ed25519 are skipped.
+func Parse(data []byte) (*Set, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	set := &Set{}
+	for i, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		public, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%q): %w", i, jwk.Kid, err)
+		}
+		if public == nil {
+			continue
+		}
+		set.Keys = append(set.Keys, Key{ID: jwk.Kid, Algorithm: jwk.Alg, Public: public})
+	}
+	return set, nil
+}
+
+// Find returns the keys with the given ID, or every key when id is empty
+func (s *Set) Find(id string) []Key {
+	if s == nil {
+		return nil
+	}
+	if id == "" {
+		return s.Keys
+	}
+	var keys []Key
+	for _, key := range s.Keys {
+		if key.ID == id {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// publicKey returns the key, or nil for unsupported key types
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var check ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, check = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, check = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, check = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		// The uncompressed encoding of the point is checked to be on the
+		// curve
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x.Bytes()) > size || len(y.Bytes()) > size {
+			return nil, errors.New("invalid coordinates")
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		x.FillBytes(point[1 : 1+size])
+		y.FillBytes(point[1+size:])
+		if _, err := check.NewPublicKey(point); err != nil {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+// decodeInt decodes an unsigned big-endian integer in base64url
+func decodeInt(value string) (*big.Int, error) {
+	if value == "" {
+		return nil, errors.New("missing value")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
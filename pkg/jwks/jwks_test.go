@@ -0,0 +1,234 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// marshal encodes public keys as a key set
+func marshal(t *testing.T, keys map[string]interface{}) []byte {
+	t.Helper()
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		jwk := map[string]string{"kid": kid}
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"], jwk["n"], jwk["e"] = "RSA", encode(key.N.Bytes()), encode(big.NewInt(int64(key.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (key.Curve.Params().BitSize + 7) / 8
+			jwk["kty"], jwk["crv"] = "EC", key.Curve.Params().Name
+			jwk["x"], jwk["y"] = encode(key.X.FillBytes(make([]byte, size))), encode(key.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk["kty"], jwk["crv"], jwk["x"] = "OKP", "Ed25519", encode(key)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	return data
+}
+
+func TestParse(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	set, err := Parse(marshal(t, map[string]interface{}{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey, "ed": edKey}))
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 3)
+
+	assert.True(t, rsaKey.PublicKey.Equal(set.Find("rsa")[0].Public))
+	assert.True(t, ecKey.PublicKey.Equal(set.Find("ec")[0].Public))
+	assert.True(t, edKey.Equal(set.Find("ed")[0].Public))
+	assert.Empty(t, set.Find("missing"))
+	assert.Len(t, set.Find(""), 3)
+}
+
+func TestParse_SkipsUnusableKeys(t *testing.T) {
+	set, err := Parse([]byte(`{"keys": [
+		{"kty": "oct", "kid": "shared", "k": "c2VjcmV0"},
+		{"kty": "OKP", "kid": "x", "crv": "X25519", "x": "AAAA"},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kty": "RSA", "kid": "sig", "use": "sig", "alg": "RS256", "n": "0vx7", "e": "AQAB"}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, "sig", set.Keys[0].ID)
+	assert.Equal(t, "RS256", set.Keys[0].Algorithm)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"json":         `{"keys": `,
+		"rsa exponent": `{"keys": [{"kty": "RSA", "n": "0vx7"}]}`,
+		"ec curve":     `{"keys": [{"kty": "EC", "crv": "P-192", "x": "AA", "y": "AA"}]}`,
+		"ec point":     `{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+		"ed25519 size": `{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "AQID"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRemote_FetchesUnknownKeys(t *testing.T) {
+	first, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	second, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keys := map[string]interface{}{"first": first}
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(marshal(t, keys))
+	}))
+	defer server.Close()
+
+	now := time.Unix(1700000000, 0)
+	remote := NewRemote(server.URL, server.Client())
+	remote.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	found, err := remote.Find(ctx, "first")
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+	_, err = remote.Find(ctx, "first")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// A rotated key is fetched, though not more often than MinInterval
+	keys["second"] = second
+	now = now.Add(time.Second)
+	found, err = remote.Find(ctx, "second")
+	require.NoError(t, err)
+	assert.Empty(t, found)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	now = now.Add(remote.MinInterval)
+	found, err = remote.Find(ctx, "second")
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestRemote_KeepsKeysWhenRefreshFails(t *testing.T) {
+	key, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(marshal(t, map[string]interface{}{"key": key}))
+	}))
+	defer server.Close()
+
+	remote := NewRemote(server.URL, server.Client())
+	require.NoError(t, remote.Refresh(context.Background()))
+	failing.Store(true)
+	assert.Error(t, remote.Refresh(context.Background()))
+
+	found, err := remote.Find(context.Background(), "key")
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+}
+
+func TestRemote_FetchOutlivesCanceledRequests(t *testing.T) {
+	key, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(marshal(t, map[string]interface{}{"key": key}))
+	}))
+	defer server.Close()
+
+	remote := NewRemote(server.URL, server.Client())
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A canceled refresh isn't remembered as the outcome of the last fetch
+	assert.ErrorIs(t, remote.Refresh(canceled), context.Canceled)
+	found, err := remote.Find(canceled, "key")
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, int32(1), fetches.Load())
+}
+
+func TestRemote_FetchTimeout(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	remote := NewRemote(server.URL, server.Client())
+	remote.FetchTimeout = 20 * time.Millisecond
+	_, err := remote.Find(context.Background(), "key")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A URL that timed out isn't fetched again before MinInterval
+	_, err = remote.Find(context.Background(), "key")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), fetches.Load())
+}
+
+func TestDiscovered(t *testing.T) {
+	key, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	issuer := ""
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tenant/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{Issuer: issuer, JWKSURI: "http://" + r.Host + "/tenant/keys"})
+	})
+	mux.HandleFunc("/tenant/keys", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(marshal(t, map[string]interface{}{"key": key}))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The document must be the issuer's own
+	issuer = "https://impostor.example.com"
+	remote := NewDiscovered(server.URL+"/tenant", server.Client())
+	_, err = remote.Find(context.Background(), "key")
+	assert.Error(t, err)
+	assert.Equal(t, server.URL+"/tenant/.well-known/openid-configuration", remote.URL())
+
+	issuer = server.URL + "/tenant"
+	require.NoError(t, remote.Refresh(context.Background()))
+	found, err := remote.Find(context.Background(), "key")
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, server.URL+"/tenant/keys", remote.URL())
+}
@@ -0,0 +1,154 @@
+package jwks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxDocumentSize bounds the key sets and discovery documents read
+const maxDocumentSize = 1 << 20
+
+// Remote is a key set served at a URL
+type Remote struct {
+	// issuer locates the key set by discovery, if set
+	issuer string
+	client *http.Client
+	// MinInterval is the least time between fetches for unknown keys
+	MinInterval time.Duration
+	// FetchTimeout bounds each fetch
+	FetchTimeout time.Duration
+	now          func() time.Time
+
+	// fetching serializes fetches and guards the outcome of the last one
+	fetching  sync.Mutex
+	attempted time.Time
+	err       error
+
+	mu  sync.RWMutex
+	url string
+	set *Set
+}
+
+// NewRemote returns the key set at url, which is fetched on first use
+func NewRemote(url string, client *http.Client) *Remote {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Remote{url: url, client: client, MinInterval: 30 * time.Second, FetchTimeout: 10 * time.Second, now: time.Now}
+}
+
+// NewDiscovered returns the key set of an OpenID Connect issuer
+func NewDiscovered(issuer string, client *http.Client) *Remote {
+	r := NewRemote("", client)
+	r.issuer = issuer
+	return r
+}
+
+// URL returns where the key set is fetched from, which is unknown until a
+// discovered set is first fetched
+func (r *Remote) URL() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.url == "" {
+		return DiscoveryURL(r.issuer)
+	}
+	return r.url
+}
+
+// Find returns the keys with the given ID, or every key when id is empty.
+// The set is fetched when it hasn't been yet or doesn't have the key.
+func (r *Remote) Find(ctx context.Context, id string) ([]Key, error) {
+	if keys := r.current().Find(id); len(keys) > 0 {
+		return keys, nil
+	}
+
+	r.fetching.Lock()
+	defer r.fetching.Unlock()
+	// Another request may have fetched the key while this one waited
+	if keys := r.current().Find(id); len(keys) > 0 {
+		return keys, nil
+	}
+	if !r.attempted.IsZero() && r.now().Sub(r.attempted) < r.MinInterval {
+		return nil, r.err
+	}
+	// The fetch serves every request waiting for it, so it doesn't end with
+	// the one that started it
+	if err := r.fetch(context.WithoutCancel(ctx)); err != nil {
+		return nil, err
+	}
+	return r.current().Find(id), nil
+}
+
+// current returns the last set fetched
+func (r *Remote) current() *Set {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.set
+}
+
+// Refresh fetches the key set again, keeping the current keys when that
+// fails
+func (r *Remote) Refresh(ctx context.Context) error {
+	r.fetching.Lock()
+	defer r.fetching.Unlock()
+	return r.fetch(ctx)
+}
+
+func (r *Remote) fetch(ctx context.Context) error {
+	attempted := r.now()
+	loadCtx, cancel := context.WithTimeout(ctx, r.FetchTimeout)
+	defer cancel()
+	err := r.load(loadCtx)
+	// A fetch its caller gave up on says nothing about the URL
+	if ctx.Err() == nil {
+		r.attempted, r.err = attempted, err
+	}
+	return err
+}
+
+func (r *Remote) load(ctx context.Context) error {
+	url := r.URL()
+	if r.issuer != "" {
+		discovery, err := Discover(ctx, r.client, r.issuer)
+		if err != nil {
+			return err
+		}
+		url = discovery.JWKSURI
+	}
+
+	data, err := get(ctx, r.client, url)
+	if err != nil {
+		return fmt.Errorf("fetching key set: %w", err)
+	}
+	set, err := Parse(data)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.url, r.set = url, set
+	r.mu.Unlock()
+	return nil
+}
+
+// get returns the JSON document at url
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+}
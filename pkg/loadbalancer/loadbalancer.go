@@ -0,0 +1,111 @@
+package loadbalancer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrNoTargets       = errors.New("no upstream targets available")
+	ErrUnknownStrategy = errors.New("unknown load balancing strategy")
+)
+
+// Target is a single upstream instance a balancer can pick
+type Target struct {
+	URL    *url.URL
+	Weight int
+	active int64
+}
+
+// NewTarget creates a target for the given URL. Weights below 1 count as 1.
+func NewTarget(rawURL string, weight int) (*Target, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid target URL %q", rawURL)
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	return &Target{URL: u, Weight: weight}, nil
+}
+
+// Acquire marks a request to the target as in flight
+func (t *Target) Acquire() {
+	atomic.AddInt64(&t.active, 1)
+}
+
+// Release marks an in-flight request to the target as finished
+func (t *Target) Release() {
+	atomic.AddInt64(&t.active, -1)
+}
+
+// Active returns the number of in-flight requests to the target
+func (t *Target) Active() int64 {
+	return atomic.LoadInt64(&t.active)
+}
+
+// Balancer picks the target that should serve a request
+type Balancer interface {
+	Pick(r *http.Request, targets []*Target) (*Target, error)
+}
+
+// Options configures a balancer
+type Options struct {
+	// HashOn selects the request attribute consistent hashing keys on:
+	// "header", "cookie" or "ip"
+	HashOn string
+	// HashKey names the header or cookie to hash
+	HashKey string
+}
+
+// Factory creates a balancer from its options
+type Factory func(opts Options) (Balancer, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a strategy available under the given name. Registering a
+// name twice replaces the earlier factory.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// New creates a balancer for the named strategy
+func New(strategy string, opts Options) (Balancer, error) {
+	if strategy == "" {
+		strategy = RoundRobin
+	}
+
+	registryMu.RLock()
+	factory, exists := registry[strategy]
+	registryMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStrategy, strategy)
+	}
+	return factory(opts)
+}
+
+// Strategies returns the names of all registered strategies
+func Strategies() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
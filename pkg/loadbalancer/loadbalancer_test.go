@@ -0,0 +1,193 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTargets(t *testing.T, weights ...int) []*Target {
+	t.Helper()
+	targets := make([]*Target, 0, len(weights))
+	for i, weight := range weights {
+		target, err := NewTarget("http://10.0.0."+string(rune('1'+i))+":8080", weight)
+		require.NoError(t, err)
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+func pickCounts(t *testing.T, b Balancer, targets []*Target, n int, req func() *http.Request) map[*Target]int {
+	t.Helper()
+	counts := make(map[*Target]int)
+	for i := 0; i < n; i++ {
+		target, err := b.Pick(req(), targets)
+		require.NoError(t, err)
+		counts[target]++
+	}
+	return counts
+}
+
+func plainRequest() *http.Request {
+	return httptest.NewRequest("GET", "/", nil)
+}
+
+func TestRoundRobin(t *testing.T) {
+	targets := newTargets(t, 1, 1, 1)
+	b, err := New(RoundRobin, Options{})
+	require.NoError(t, err)
+
+	counts := pickCounts(t, b, targets, 9, plainRequest)
+	for _, target := range targets {
+		assert.Equal(t, 3, counts[target])
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	targets := newTargets(t, 5, 1, 1)
+	b, err := New(WeightedRoundRobin, Options{})
+	require.NoError(t, err)
+
+	// Smooth WRR interleaves the lighter targets instead of sending the
+	// heavy one a burst of five
+	var sequence []*Target
+	for i := 0; i < 7; i++ {
+		target, err := b.Pick(plainRequest(), targets)
+		require.NoError(t, err)
+		sequence = append(sequence, target)
+	}
+	a, b2, c := targets[0], targets[1], targets[2]
+	assert.Equal(t, []*Target{a, a, b2, a, c, a, a}, sequence)
+}
+
+func TestWeightedRoundRobin_TargetSetChanges(t *testing.T) {
+	targets := newTargets(t, 5, 1, 1)
+	b, err := New(WeightedRoundRobin, Options{})
+	require.NoError(t, err)
+	wrr := b.(*weightedRoundRobin)
+
+	for i := 0; i < 3; i++ {
+		_, err := b.Pick(plainRequest(), targets)
+		require.NoError(t, err)
+	}
+
+	// The state of a replaced target is dropped
+	replacement := newTargets(t, 1)[0]
+	_, err = b.Pick(plainRequest(), []*Target{targets[0], targets[1], replacement})
+	require.NoError(t, err)
+	assert.Len(t, wrr.current, 3)
+	assert.NotContains(t, wrr.current, targets[2])
+
+	// A target added back starts over
+	_, err = b.Pick(plainRequest(), targets[:2])
+	require.NoError(t, err)
+	_, err = b.Pick(plainRequest(), targets)
+	require.NoError(t, err)
+	assert.Equal(t, 1, wrr.current[targets[2]])
+}
+
+func TestLeastConnections(t *testing.T) {
+	targets := newTargets(t, 1, 1, 1)
+	targets[0].Acquire()
+	targets[1].Acquire()
+	b, err := New(LeastConnections, Options{})
+	require.NoError(t, err)
+
+	target, err := b.Pick(plainRequest(), targets)
+	require.NoError(t, err)
+	assert.Equal(t, targets[2], target)
+}
+
+func TestPowerOfTwoChoicesPrefersIdleTarget(t *testing.T) {
+	targets := newTargets(t, 1, 1)
+	for i := 0; i < 10; i++ {
+		targets[0].Acquire()
+	}
+	b, err := New(PowerOfTwoChoices, Options{})
+	require.NoError(t, err)
+
+	counts := pickCounts(t, b, targets, 50, plainRequest)
+	assert.Equal(t, 50, counts[targets[1]])
+}
+
+func TestRandomRespectsWeights(t *testing.T) {
+	targets := newTargets(t, 3, 1)
+	b, err := New(Random, Options{})
+	require.NoError(t, err)
+
+	counts := pickCounts(t, b, targets, 4000, plainRequest)
+	assert.InDelta(t, 3000, counts[targets[0]], 200)
+}
+
+func TestConsistentHash(t *testing.T) {
+	targets := newTargets(t, 1, 1, 1, 1)
+	b, err := New(ConsistentHash, Options{HashOn: "header", HashKey: "X-User"})
+	require.NoError(t, err)
+
+	withUser := func(user string) func() *http.Request {
+		return func() *http.Request {
+			req := plainRequest()
+			req.Header.Set("X-User", user)
+			return req
+		}
+	}
+
+	// The same key always lands on the same target
+	counts := pickCounts(t, b, targets, 10, withUser("alice"))
+	assert.Len(t, counts, 1)
+
+	// Removing a target only moves the keys that were on it
+	moved := 0
+	for i := 0; i < 200; i++ {
+		req := withUser(string(rune('a'+i%26)) + string(rune('0'+i/26)))()
+		before, _ := b.Pick(req, targets)
+		after, _ := b.Pick(req, targets[1:])
+		if before != targets[0] && before != after {
+			moved++
+		}
+	}
+	assert.Zero(t, moved)
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	_, err := New("fastest", Options{})
+	assert.ErrorIs(t, err, ErrUnknownStrategy)
+
+	_, err = New(ConsistentHash, Options{HashOn: "cookie"})
+	assert.Error(t, err)
+}
+
+func TestRegisterCustomStrategy(t *testing.T) {
+	Register("first", func(Options) (Balancer, error) {
+		return firstTarget{}, nil
+	})
+	b, err := New("first", Options{})
+	require.NoError(t, err)
+
+	targets := newTargets(t, 1, 1)
+	target, err := b.Pick(plainRequest(), targets)
+	require.NoError(t, err)
+	assert.Equal(t, targets[0], target)
+	assert.Contains(t, Strategies(), "first")
+}
+
+type firstTarget struct{}
+
+func (firstTarget) Pick(r *http.Request, targets []*Target) (*Target, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+	return targets[0], nil
+}
+
+func TestEmptyTargets(t *testing.T) {
+	for _, strategy := range []string{RoundRobin, WeightedRoundRobin, LeastConnections, Random, PowerOfTwoChoices, ConsistentHash} {
+		b, err := New(strategy, Options{})
+		require.NoError(t, err)
+		_, err = b.Pick(plainRequest(), nil)
+		assert.ErrorIs(t, err, ErrNoTargets, strategy)
+	}
+}
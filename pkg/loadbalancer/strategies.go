@@ -0,0 +1,237 @@
+package loadbalancer
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Built-in strategy names
+const (
+	RoundRobin         = "round-robin"
+	WeightedRoundRobin = "weighted-round-robin"
+	LeastConnections   = "least-connections"
+	Random             = "random"
+	PowerOfTwoChoices  = "power-of-two-choices"
+	ConsistentHash     = "consistent-hash"
+)
+
+func init() {
+	Register(RoundRobin, func(Options) (Balancer, error) {
+		return &roundRobin{}, nil
+	})
+	Register(WeightedRoundRobin, func(Options) (Balancer, error) {
+		return &weightedRoundRobin{current: make(map[*Target]int)}, nil
+	})
+	Register(LeastConnections, func(Options) (Balancer, error) {
+		return leastConnections{}, nil
+	})
+	Register(Random, func(Options) (Balancer, error) {
+		return weightedRandom{}, nil
+	})
+	Register(PowerOfTwoChoices, func(Options) (Balancer, error) {
+		return powerOfTwoChoices{}, nil
+	})
+	Register(ConsistentHash, newConsistentHash)
+}
+
+// roundRobin cycles through the targets in order
+type roundRobin struct {
+	next uint64
+}
+
+func (b *roundRobin) Pick(r *http.Request, targets []*Target) (*Target, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return targets[n%uint64(len(targets))], nil
+}
+
+// weightedRoundRobin implements nginx's smooth weighted round robin, which
+// interleaves heavier targets instead of sending them bursts of requests
+type weightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[*Target]int
+}
+
+func (b *weightedRoundRobin) Pick(r *http.Request, targets []*Target) (*Target, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Targets that left the set are forgotten, so that targets replaced or
+	// added back later start over
+	known := 0
+	for _, t := range targets {
+		if _, exists := b.current[t]; exists {
+			known++
+		}
+	}
+	if known != len(b.current) {
+		current := make(map[*Target]int, len(targets))
+		for _, t := range targets {
+			current[t] = b.current[t]
+		}
+		b.current = current
+	}
+
+	total := 0
+	var best *Target
+	for _, t := range targets {
+		b.current[t] += t.Weight
+		total += t.Weight
+		if best == nil || b.current[t] > b.current[best] {
+			best = t
+		}
+	}
+	b.current[best] -= total
+	return best, nil
+}
+
+// leastConnections picks the target with the fewest in-flight requests
+// relative to its weight, breaking ties at random
+type leastConnections struct{}
+
+func (leastConnections) Pick(r *http.Request, targets []*Target) (*Target, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	var best *Target
+	var bestLoad float64
+	ties := 0
+	for _, t := range targets {
+		load := float64(t.Active()) / float64(t.Weight)
+		switch {
+		case best == nil || load < bestLoad:
+			best, bestLoad, ties = t, load, 1
+		case load == bestLoad:
+			// Reservoir sampling keeps every tied target equally likely
+			ties++
+			if rand.IntN(ties) == 0 {
+				best = t
+			}
+		}
+	}
+	return best, nil
+}
+
+// weightedRandom picks a target at random in proportion to its weight
+type weightedRandom struct{}
+
+func (weightedRandom) Pick(r *http.Request, targets []*Target) (*Target, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	total := 0
+	for _, t := range targets {
+		total += t.Weight
+	}
+	n := rand.IntN(total)
+	for _, t := range targets {
+		n -= t.Weight
+		if n < 0 {
+			return t, nil
+		}
+	}
+	return targets[len(targets)-1], nil
+}
+
+// powerOfTwoChoices samples two targets and keeps the less loaded one
+type powerOfTwoChoices struct{}
+
+func (powerOfTwoChoices) Pick(r *http.Request, targets []*Target) (*Target, error) {
+	switch len(targets) {
+	case 0:
+		return nil, ErrNoTargets
+	case 1:
+		return targets[0], nil
+	}
+
+	i := rand.IntN(len(targets))
+	j := rand.IntN(len(targets) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := targets[i], targets[j]
+	if float64(b.Active())/float64(b.Weight) < float64(a.Active())/float64(a.Weight) {
+		return b, nil
+	}
+	return a, nil
+}
+
+// consistentHash maps requests to targets with weighted rendezvous hashing,
+// so only the keys of a target that leaves or joins the set move
+type consistentHash struct {
+	hashOn  string
+	hashKey string
+}
+
+func newConsistentHash(opts Options) (Balancer, error) {
+	switch opts.HashOn {
+	case "", "ip":
+		return &consistentHash{hashOn: "ip"}, nil
+	case "header", "cookie":
+		if opts.HashKey == "" {
+			return nil, errors.New("consistent hashing on a " + opts.HashOn + " requires a hash key")
+		}
+		return &consistentHash{hashOn: opts.HashOn, hashKey: opts.HashKey}, nil
+	default:
+		return nil, errors.New("consistent hashing cannot hash on " + opts.HashOn)
+	}
+}
+
+func (b *consistentHash) Pick(r *http.Request, targets []*Target) (*Target, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	key := b.key(r)
+	var best *Target
+	bestScore := math.Inf(-1)
+	for _, t := range targets {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(t.URL.Host))
+		// Map the hash into (0, 1) and weight it so heavier targets win
+		// proportionally more keys
+		u := (float64(h.Sum64()>>11) + 0.5) / (1 << 53)
+		score := float64(t.Weight) / -math.Log(u)
+		if score > bestScore {
+			best, bestScore = t, score
+		}
+	}
+	return best, nil
+}
+
+// key extracts the hash key from the request. Requests without the header or
+// cookie fall back to the client address.
+func (b *consistentHash) key(r *http.Request) string {
+	switch b.hashOn {
+	case "header":
+		if v := r.Header.Get(b.hashKey); v != "" {
+			return v
+		}
+	case "cookie":
+		if cookie, err := r.Cookie(b.hashKey); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/zahidhasann88/api-gateway/pkg/circuitbreaker"
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+// FallbackLimiter uses a local limiter while the primary one is failing
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	breaker  *circuitbreaker.CircuitBreaker
+	logger   logger.Logger
+}
+
+// NewFallbackLimiter creates a limiter falling back from primary to fallback
+func NewFallbackLimiter(primary, fallback Limiter, cooldown time.Duration, log logger.Logger) *FallbackLimiter {
+	l := &FallbackLimiter{
+		primary:  primary,
+		fallback: fallback,
+		breaker:  circuitbreaker.NewCircuitBreaker(1, cooldown, 1),
+		logger:   log,
+	}
+	l.breaker.OnStateChange(func(from, to int) {
+		switch to {
+		case circuitbreaker.StateOpen:
+			log.Warn("Shared rate limiter unavailable, using local limits")
+		case circuitbreaker.StateClosed:
+			log.Info("Shared rate limiter recovered")
+		}
+	})
+	return l
+}
+
+// Allow takes a token from the primary limiter, or from the fallback while
+// the primary is unavailable
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if l.breaker.AllowRequest() {
+		result, err := l.primary.Allow(ctx, key, limit)
+		if err == nil {
+			l.breaker.RecordSuccess()
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		l.breaker.RecordFailure()
+		l.logger.Debug("Shared rate limiter failed", "error", err)
+	}
+	return l.fallback.Allow(ctx, key, limit)
+}
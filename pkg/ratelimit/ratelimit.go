@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second holding at
+// most Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result describes the outcome of a rate limit check
+type Result struct {
+	Allowed bool
+	// Limit is the bucket size
+	Limit int
+	// Remaining is the number of requests that can still be made right now
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed when the
+	// current one was rejected
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from per-key buckets. Implementations must be safe
+// for concurrent use.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// MemoryLimiter keeps one token bucket per key in process memory. Buckets
+// are created on first use and evicted once idle for longer than the TTL.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	ttl       time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewMemoryLimiter creates an in-memory limiter evicting buckets idle for ttl
+func NewMemoryLimiter(ttl time.Duration) *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the key's bucket if one is available
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)}
+		l.buckets[key] = b
+	} else if b.limiter.Limit() != rate.Limit(limit.Rate) || b.limiter.Burst() != limit.Burst {
+		b.limiter.SetLimitAt(now, rate.Limit(limit.Rate))
+		b.limiter.SetBurstAt(now, limit.Burst)
+	}
+	b.lastSeen = now
+
+	allowed := b.limiter.AllowN(now, 1)
+	tokens := b.limiter.TokensAt(now)
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     refillTime(float64(limit.Burst)-tokens, limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = refillTime(1-tokens, limit.Rate)
+	}
+	return result, nil
+}
+
+// Len returns the number of live buckets
+func (l *MemoryLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep evicts idle buckets, at most once per TTL
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if l.ttl <= 0 || now.Sub(l.lastSweep) < l.ttl {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > l.ttl {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// refillTime returns how long it takes to refill the given number of tokens
+func refillTime(tokens, ratePerSecond float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	if ratePerSecond <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(tokens / ratePerSecond * float64(time.Second))
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLimiter_Allow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewMemoryLimiter(time.Minute)
+	l.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	first := allow(t, l, "a", limit)
+	assert.True(t, first.Allowed)
+	assert.Equal(t, 2, first.Limit)
+	assert.Equal(t, 1, first.Remaining)
+	assert.Equal(t, time.Second, first.Reset)
+
+	assert.True(t, allow(t, l, "a", limit).Allowed)
+
+	denied := allow(t, l, "a", limit)
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, 0, denied.Remaining)
+	assert.Equal(t, time.Second, denied.RetryAfter)
+
+	// Keys don't share buckets
+	assert.True(t, allow(t, l, "b", limit).Allowed)
+
+	now = now.Add(time.Second)
+	assert.True(t, allow(t, l, "a", limit).Allowed)
+}
+
+func TestMemoryLimiter_EvictsIdleBuckets(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewMemoryLimiter(time.Minute)
+	l.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 1}
+
+	allow(t, l, "a", limit)
+	allow(t, l, "b", limit)
+	assert.Equal(t, 2, l.Len())
+
+	now = now.Add(30 * time.Second)
+	allow(t, l, "b", limit)
+
+	now = now.Add(45 * time.Second)
+	allow(t, l, "c", limit)
+	assert.Equal(t, 2, l.Len(), "only the idle bucket is evicted")
+}
+
+func TestMemoryLimiter_LimitChanges(t *testing.T) {
+	l := NewMemoryLimiter(time.Minute)
+
+	assert.True(t, allow(t, l, "a", Limit{Rate: 1, Burst: 1}).Allowed)
+	assert.False(t, allow(t, l, "a", Limit{Rate: 1, Burst: 1}).Allowed)
+
+	result := allow(t, l, "a", Limit{Rate: 1, Burst: 5})
+	assert.Equal(t, 5, result.Limit)
+}
+
+func allow(t *testing.T, l Limiter, key string, limit Limit) Result {
+	t.Helper()
+	result, err := l.Allow(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript implements the generic cell rate algorithm on Redis's clock
+//
+// KEYS[1]: bucket key
+// ARGV[1]: emission interval in microseconds (1/rate)
+// ARGV[2]: burst
+//
+// Returns {allowed, remaining, retry after µs, reset µs}
+var gcraScript = redis.NewScript(`
+local emission = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local tolerance = emission * burst
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+
+local new_tat = tat + emission
+local diff = now - (new_tat - tolerance)
+if diff < 0 then
+	return {0, 0, -diff, tat - now}
+end
+
+redis.call("SET", KEYS[1], new_tat, "PX", math.ceil((new_tat - now) / 1000))
+return {1, math.floor(diff / emission), 0, new_tat - now}
+`)
+
+// RedisLimiter keeps buckets in Redis so that limits hold across gateway
+// replicas
+type RedisLimiter struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisLimiter creates a limiter storing its buckets under prefix
+func NewRedisLimiter(client redis.Scripter, prefix string) *RedisLimiter {
+	return &RedisLimiter{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Allow takes a token from the key's bucket if one is available
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.Rate <= 0 || limit.Burst < 1 {
+		return Result{Allowed: false, Limit: limit.Burst, RetryAfter: time.Duration(math.MaxInt64)}, nil
+	}
+
+	emission := int64(math.Ceil(float64(time.Second/time.Microsecond) / limit.Rate))
+
+	values, err := gcraScript.Run(ctx, l.client, []string{l.prefix + key}, emission, limit.Burst).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit.Burst,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		Reset:      time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
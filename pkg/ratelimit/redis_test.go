@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zahidhasann88/api-gateway/pkg/logger"
+)
+
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+func TestRedisLimiter_SharedAcrossReplicas(t *testing.T) {
+	server, client := newRedis(t)
+	now := time.Unix(1700000000, 0)
+	server.SetTime(now)
+
+	replicaA := NewRedisLimiter(client, "rl:")
+	replicaB := NewRedisLimiter(client, "rl:")
+	limit := Limit{Rate: 1, Burst: 2}
+
+	first := allow(t, replicaA, "users|ip:1", limit)
+	assert.True(t, first.Allowed)
+	assert.Equal(t, 1, first.Remaining)
+	assert.Equal(t, time.Second, first.Reset)
+
+	assert.True(t, allow(t, replicaB, "users|ip:1", limit).Allowed)
+
+	denied := allow(t, replicaA, "users|ip:1", limit)
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, 0, denied.Remaining)
+	assert.Equal(t, time.Second, denied.RetryAfter)
+
+	// Other keys are independent
+	assert.True(t, allow(t, replicaB, "users|ip:2", limit).Allowed)
+
+	server.SetTime(now.Add(time.Second))
+	assert.True(t, allow(t, replicaB, "users|ip:1", limit).Allowed)
+}
+
+func TestFallbackLimiter_UsesLocalLimitsWhileRedisIsDown(t *testing.T) {
+	server, client := newRedis(t)
+	local := NewMemoryLimiter(time.Minute)
+	limiter := NewFallbackLimiter(NewRedisLimiter(client, "rl:"), local, 50*time.Millisecond, logger.New("error"))
+	limit := Limit{Rate: 1, Burst: 1}
+
+	assert.True(t, allow(t, limiter, "a", limit).Allowed)
+	assert.Equal(t, 0, local.Len())
+
+	server.Close()
+	assert.True(t, allow(t, limiter, "a", limit).Allowed, "local bucket starts full")
+	assert.False(t, allow(t, limiter, "a", limit).Allowed)
+	assert.Equal(t, 1, local.Len())
+
+	// Redis is retried once the cooldown has passed
+	require.NoError(t, server.Restart())
+	time.Sleep(60 * time.Millisecond)
+	result, err := limiter.Allow(context.Background(), "b", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, local.Len())
+}
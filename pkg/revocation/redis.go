@@ -0,0 +1,66 @@
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// addScript lists an ID unless it is listed, and otherwise extends its ttl
+// when the new one is longer
+//
+// KEYS[1]: id key
+// ARGV[1]: ttl in milliseconds
+var addScript = redis.NewScript(`
+local ttl = tonumber(ARGV[1])
+if redis.call("SET", KEYS[1], "1", "PX", ttl, "NX") then
+	return 1
+end
+if redis.call("PTTL", KEYS[1]) < ttl then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 0
+`)
+
+// RedisDenylist keeps revoked IDs in Redis so that gateway replicas share
+// them
+type RedisDenylist struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisDenylist creates a denylist keeping its IDs under prefix
+func NewRedisDenylist(client redis.Cmdable, prefix string) *RedisDenylist {
+	return &RedisDenylist{client: client, prefix: prefix}
+}
+
+// Add lists id until ttl passes, rounded up to milliseconds
+func (d *RedisDenylist) Add(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	milliseconds := (ttl + time.Millisecond - 1).Milliseconds()
+	if milliseconds <= 0 {
+		listed, err := d.Contains(ctx, id)
+		return !listed, err
+	}
+	added, err := addScript.Run(ctx, d.client, []string{d.prefix + id}, milliseconds).Int()
+	if err != nil {
+		return false, err
+	}
+	return added == 1, nil
+}
+
+// Contains reports whether any of ids is listed
+func (d *RedisDenylist) Contains(ctx context.Context, ids ...string) (bool, error) {
+	if len(ids) == 0 {
+		return false, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = d.prefix + id
+	}
+	n, err := d.client.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,86 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Denylist remembers revoked IDs, such as those of tokens, until they
+// expire. Implementations must be safe for concurrent use.
+type Denylist interface {
+	// Add lists id for ttl and reports whether it wasn't listed yet, so
+	// that IDs can also be marked as used exactly once
+	Add(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	// Contains reports whether any of ids is listed
+	Contains(ctx context.Context, ids ...string) (bool, error)
+}
+
+// sweepInterval is how often the memory denylist drops expired IDs
+const sweepInterval = time.Minute
+
+// MemoryDenylist keeps revoked IDs in process memory
+type MemoryDenylist struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryDenylist creates an empty in-memory denylist
+func NewMemoryDenylist() *MemoryDenylist {
+	return &MemoryDenylist{
+		expires: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Add lists id until ttl passes. IDs listed already keep the later of
+// their expiries.
+func (d *MemoryDenylist) Add(_ context.Context, id string, ttl time.Duration) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.sweep(now)
+	expires, listed := d.expires[id]
+	listed = listed && now.Before(expires)
+	if ttl > 0 && (!listed || now.Add(ttl).After(expires)) {
+		d.expires[id] = now.Add(ttl)
+	}
+	return !listed, nil
+}
+
+// Contains reports whether any of ids is listed and unexpired
+func (d *MemoryDenylist) Contains(_ context.Context, ids ...string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for _, id := range ids {
+		if expires, listed := d.expires[id]; listed && now.Before(expires) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Len returns the number of IDs held, including expired ones not swept yet
+func (d *MemoryDenylist) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.expires)
+}
+
+// sweep drops expired IDs, at most once per sweepInterval
+func (d *MemoryDenylist) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < sweepInterval {
+		return
+	}
+	d.lastSweep = now
+	for id, expires := range d.expires {
+		if !now.Before(expires) {
+			delete(d.expires, id)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDenylist checks a denylist whose clock advance moves forward
+func testDenylist(t *testing.T, d Denylist, advance func(time.Duration)) {
+	t.Helper()
+	ctx := context.Background()
+
+	listed, err := d.Contains(ctx, "a", "b")
+	require.NoError(t, err)
+	assert.False(t, listed)
+
+	added, err := d.Add(ctx, "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, added)
+	added, err = d.Add(ctx, "a", time.Second)
+	require.NoError(t, err)
+	assert.False(t, added, "listed twice")
+
+	listed, err = d.Contains(ctx, "b", "a")
+	require.NoError(t, err)
+	assert.True(t, listed)
+
+	// A longer ttl extends the listing, a shorter one doesn't cut it
+	_, err = d.Add(ctx, "a", 2*time.Minute)
+	require.NoError(t, err)
+	advance(time.Minute + time.Second)
+	listed, err = d.Contains(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, listed)
+
+	advance(time.Minute)
+	listed, err = d.Contains(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, listed)
+	added, err = d.Add(ctx, "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, added, "listed again once expired")
+}
+
+func TestMemoryDenylist(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := NewMemoryDenylist()
+	d.now = func() time.Time { return now }
+	testDenylist(t, d, func(duration time.Duration) { now = now.Add(duration) })
+}
+
+func TestMemoryDenylist_SweepsExpiredIDs(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := NewMemoryDenylist()
+	d.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		_, err := d.Add(ctx, id, time.Second)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, d.Len())
+
+	now = now.Add(sweepInterval)
+	_, err := d.Add(ctx, "d", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, d.Len())
+}
+
+func newRedisDenylist(t *testing.T) (*miniredis.Miniredis, *RedisDenylist) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return server, NewRedisDenylist(client, "revoked:")
+}
+
+func TestRedisDenylist(t *testing.T) {
+	server, d := newRedisDenylist(t)
+	testDenylist(t, d, server.FastForward)
+}
+
+func TestRedisDenylist_SharedAcrossReplicas(t *testing.T) {
+	server, replicaA := newRedisDenylist(t)
+	replicaB := NewRedisDenylist(replicaA.client, "revoked:")
+	ctx := context.Background()
+
+	added, err := replicaA.Add(ctx, "jti", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.Equal(t, time.Minute, server.TTL("revoked:jti"))
+
+	added, err = replicaB.Add(ctx, "jti", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, added)
+	listed, err := replicaB.Contains(ctx, "jti")
+	require.NoError(t, err)
+	assert.True(t, listed)
+}
+
+func TestRedisDenylist_Unavailable(t *testing.T) {
+	server, d := newRedisDenylist(t)
+	server.Close()
+
+	_, err := d.Add(context.Background(), "jti", time.Minute)
+	assert.Error(t, err)
+	_, err = d.Contains(context.Background(), "jti")
+	assert.Error(t, err)
+}
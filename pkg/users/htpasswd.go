@@ -0,0 +1,79 @@
+package users
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// htpasswdEntry is a user of an htpasswd file
+type htpasswdEntry struct {
+	hash  string
+	roles []string
+}
+
+// HtpasswdStore checks credentials against an htpasswd style file
+type HtpasswdStore struct {
+	users map[string]htpasswdEntry
+}
+
+// NewHtpasswdStore reads an htpasswd file of user:hash[:roles] lines
+func NewHtpasswdStore(path string) (*HtpasswdStore, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseHtpasswd(file)
+}
+
+// ParseHtpasswd reads the users of an htpasswd file
+func ParseHtpasswd(r io.Reader) (*HtpasswdStore, error) {
+	s := &HtpasswdStore{users: make(map[string]htpasswdEntry)}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ":")
+		if len(fields) < 2 || len(fields) > 3 || fields[0] == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash[:roles]", line)
+		}
+		if err := validateHash(fields[1]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if _, exists := s.users[fields[0]]; exists {
+			return nil, fmt.Errorf("line %d: user %s is listed twice", line, fields[0])
+		}
+		entry := htpasswdEntry{hash: fields[1]}
+		if len(fields) == 3 {
+			entry.roles = splitRoles(fields[2])
+		}
+		s.users[fields[0]] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Authenticate checks the password of a user of the file
+func (s *HtpasswdStore) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	entry, exists := s.users[username]
+	if !exists {
+		checkDecoy(password)
+		return nil, ErrInvalidCredentials
+	}
+	matched, err := CheckPassword(entry.hash, password)
+	if err != nil {
+		return nil, err
+	}
+	if !matched {
+		return nil, ErrInvalidCredentials
+	}
+	return &User{Username: username, Roles: entry.roles}, nil
+}
@@ -0,0 +1,137 @@
+package users
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig locates users in a directory
+type LDAPConfig struct {
+	// URL is the directory server, such as ldaps://ldap.example.com
+	URL string
+	// StartTLS upgrades ldap:// connections to TLS
+	StartTLS bool
+	// BindDN and BindPassword are the account searching for users, which
+	// is anonymous when empty
+	BindDN       string
+	BindPassword string
+	// BaseDN is where users are searched
+	BaseDN string
+	// UserFilter finds a user, with %s replaced by the username
+	UserFilter string
+	// RoleAttribute holds the user's roles. Values that are DNs, such as
+	// those of memberOf, give the value of their first attribute.
+	RoleAttribute string
+	Timeout       time.Duration
+}
+
+// LDAPStore checks credentials by binding as the user to a directory
+type LDAPStore struct {
+	cfg LDAPConfig
+}
+
+// NewLDAPStore checks credentials against a directory. Connections are
+// opened for every authentication.
+func NewLDAPStore(cfg LDAPConfig) (*LDAPStore, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, errors.New("ldap url and base dn are required")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, errors.New("ldap user filter must contain %s")
+	}
+	if cfg.RoleAttribute == "" {
+		cfg.RoleAttribute = "memberOf"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return &LDAPStore{cfg: cfg}, nil
+}
+
+// Authenticate finds the user in the directory and binds as the user
+func (s *LDAPStore) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	// Directories treat binds without a password as anonymous binds that
+	// succeed
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if s.cfg.BindDN != "" {
+		if err := conn.Bind(s.cfg.BindDN, s.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		s.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(s.cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(s.cfg.UserFilter, "%s", ldap.EscapeFilter(username)),
+		[]string{s.cfg.RoleAttribute}, nil,
+	))
+	// A username matching several entries is as ambiguous as one matching
+	// none
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		checkDecoy(password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		checkDecoy(password)
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap bind: %w", err)
+	}
+
+	user := &User{Username: username}
+	for _, value := range entry.GetAttributeValues(s.cfg.RoleAttribute) {
+		if dn, err := ldap.ParseDN(value); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			value = dn.RDNs[0].Attributes[0].Value
+		}
+		user.Roles = append(user.Roles, value)
+	}
+	return user, nil
+}
+
+// dial connects to the directory, over TLS when configured
+func (s *LDAPStore) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(s.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: s.cfg.Timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(s.cfg.Timeout)
+	if s.cfg.StartTLS {
+		u, err := url.Parse(s.cfg.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap start tls: %w", err)
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,186 @@
+package users
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDirectory is a directory server answering simple binds and searches
+// on equality filters, enough for LDAPStore
+type testDirectory struct {
+	listener  net.Listener
+	passwords map[string]string
+	// entries holds the attributes of users by DN
+	entries map[string]map[string][]string
+}
+
+func newTestDirectory(t *testing.T) *testDirectory {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	d := &testDirectory{
+		listener: listener,
+		passwords: map[string]string{
+			"cn=gateway,dc=example,dc=com":          "service",
+			"uid=alice,ou=people,dc=example,dc=com": "wonderland",
+			"uid=bob,ou=people,dc=example,dc=com":   "builder",
+		},
+		entries: map[string]map[string][]string{
+			"uid=alice,ou=people,dc=example,dc=com": {
+				"uid":      {"alice"},
+				"memberOf": {"cn=admin,ou=groups,dc=example,dc=com", "cn=user,ou=groups,dc=example,dc=com"},
+			},
+			"uid=bob,ou=people,dc=example,dc=com": {"uid": {"bob"}},
+		},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d
+}
+
+func (d *testDirectory) url() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	bound := false
+	for {
+		request, err := ber.ReadPacket(conn)
+		if err != nil || len(request.Children) < 2 {
+			return
+		}
+		id := request.Children[0].Value.(int64)
+		op := request.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			code := ldap.LDAPResultInvalidCredentials
+			if expected, exists := d.passwords[dn]; exists && password == expected {
+				code, bound = ldap.LDAPResultSuccess, true
+			}
+			conn.Write(ldapMessage(id, ldapResult(ldap.ApplicationBindResponse, code)).Bytes())
+		case ldap.ApplicationSearchRequest:
+			// Only the gateway's service account may search
+			if !bound {
+				conn.Write(ldapMessage(id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)).Bytes())
+				continue
+			}
+			sizeLimit := op.Children[3].Value.(int64)
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			code, sent := ldap.LDAPResultSuccess, int64(0)
+			for dn, attributes := range d.entries {
+				if filter != "(uid="+attributes["uid"][0]+")" {
+					continue
+				}
+				if sizeLimit > 0 && sent == sizeLimit {
+					code = ldap.LDAPResultSizeLimitExceeded
+					break
+				}
+				sent++
+				entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+				entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+				list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				for name, values := range attributes {
+					attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+					attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+					set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+					for _, value := range values {
+						set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+					}
+					attribute.AppendChild(set)
+					list.AppendChild(attribute)
+				}
+				entry.AppendChild(list)
+				conn.Write(ldapMessage(id, entry).Bytes())
+			}
+			conn.Write(ldapMessage(id, ldapResult(ldap.ApplicationSearchResultDone, code)).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	message.AppendChild(op)
+	return message
+}
+
+func ldapResult(tag ber.Tag, code int) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return result
+}
+
+func TestLDAPStore(t *testing.T) {
+	directory := newTestDirectory(t)
+	s, err := NewLDAPStore(LDAPConfig{
+		URL:          directory.url(),
+		BindDN:       "cn=gateway,dc=example,dc=com",
+		BindPassword: "service",
+		BaseDN:       "dc=example,dc=com",
+	})
+	require.NoError(t, err)
+	testStore(t, s)
+}
+
+func TestLDAPStore_ServiceBindFails(t *testing.T) {
+	directory := newTestDirectory(t)
+	s, err := NewLDAPStore(LDAPConfig{
+		URL:          directory.url(),
+		BindDN:       "cn=gateway,dc=example,dc=com",
+		BindPassword: "wrong",
+		BaseDN:       "dc=example,dc=com",
+	})
+	require.NoError(t, err)
+
+	_, err = s.Authenticate(context.Background(), "alice", "wonderland")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestLDAPStore_AmbiguousUsername(t *testing.T) {
+	directory := newTestDirectory(t)
+	for _, ou := range []string{"contractors", "partners"} {
+		dn := "uid=alice,ou=" + ou + ",dc=example,dc=com"
+		directory.passwords[dn] = "wonderland"
+		directory.entries[dn] = map[string][]string{"uid": {"alice"}}
+	}
+	s, err := NewLDAPStore(LDAPConfig{
+		URL:          directory.url(),
+		BindDN:       "cn=gateway,dc=example,dc=com",
+		BindPassword: "service",
+		BaseDN:       "dc=example,dc=com",
+	})
+	require.NoError(t, err)
+
+	_, err = s.Authenticate(context.Background(), "alice", "wonderland")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestNewLDAPStore_Invalid(t *testing.T) {
+	_, err := NewLDAPStore(LDAPConfig{URL: "ldap://localhost"})
+	assert.Error(t, err)
+	_, err = NewLDAPStore(LDAPConfig{URL: "ldap://localhost", BaseDN: "dc=example,dc=com", UserFilter: "(uid=alice)"})
+	assert.Error(t, err)
+}
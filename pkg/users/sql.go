@@ -0,0 +1,54 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// DefaultQuery reads the password hash and comma separated roles of the
+// username given as $1 from a users table
+const DefaultQuery = "SELECT password_hash, roles FROM users WHERE username = $1"
+
+// SQLStore checks credentials against password hashes kept in a database
+type SQLStore struct {
+	db    *sql.DB
+	query string
+}
+
+// NewSQLStore checks credentials with a query selecting the password hash
+// and roles of a username
+func NewSQLStore(db *sql.DB, query string) *SQLStore {
+	if query == "" {
+		query = DefaultQuery
+	}
+	return &SQLStore{db: db, query: query}
+}
+
+// Authenticate checks the password of a user of the database
+func (s *SQLStore) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	var hash string
+	var roles sql.NullString
+	err := s.db.QueryRowContext(ctx, s.query, username).Scan(&hash, &roles)
+	if errors.Is(err, sql.ErrNoRows) {
+		checkDecoy(password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := CheckPassword(hash, password)
+	if err != nil {
+		return nil, err
+	}
+	if !matched {
+		return nil, ErrInvalidCredentials
+	}
+	return &User{Username: username, Roles: splitRoles(roles.String)}, nil
+}
+
+// Close closes the database
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
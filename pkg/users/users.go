@@ -0,0 +1,136 @@
+package users
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned for unknown users and wrong passwords
+// alike, so that callers can't tell which it was
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// User is an authenticated user
+type User struct {
+	Username string
+	Roles    []string
+}
+
+// Store checks the credentials of users. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Authenticate returns the user with the given credentials, or
+	// ErrInvalidCredentials. Other errors mean the store couldn't tell.
+	Authenticate(ctx context.Context, username, password string) (*User, error)
+}
+
+// CheckPassword reports whether password matches a bcrypt hash or an
+// Argon2 hash in the PHC string format
+func CheckPassword(hash, password string) (bool, error) {
+	if isBcrypt(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	argon, err := parseArgon2(hash)
+	if err != nil {
+		return false, err
+	}
+	return argon.check(password), nil
+}
+
+// validateHash checks that a password hash is in a supported format
+// without checking a password, which takes a while on purpose
+func validateHash(hash string) error {
+	if isBcrypt(hash) {
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	}
+	_, err := parseArgon2(hash)
+	return err
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// argon2Hash is a decoded Argon2 hash
+type argon2Hash struct {
+	variant string
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2 decodes a hash such as $argon2id$v=19$m=65536,t=3,p=4$salt$key
+func parseArgon2(hash string) (*argon2Hash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || (parts[1] != "argon2id" && parts[1] != "argon2i") {
+		return nil, errors.New("unsupported password hash")
+	}
+	h := &argon2Hash{variant: parts[1]}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	if h.time == 0 || h.threads == 0 {
+		return nil, errors.New("invalid argon2 parameters")
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, errors.New("invalid argon2 key")
+	}
+	return h, nil
+}
+
+func (h *argon2Hash) check(password string) bool {
+	var key []byte
+	if h.variant == "argon2id" {
+		key = argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	} else {
+		key = argon2.Key([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	}
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+var (
+	decoyOnce sync.Once
+	decoy     []byte
+)
+
+// checkDecoy spends the time checking a password takes, so that unknown
+// users can't be told from wrong passwords by the response time
+func checkDecoy(password string) {
+	decoyOnce.Do(func() {
+		decoy, _ = bcrypt.GenerateFromPassword([]byte("decoy"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(decoy, []byte(password))
+}
+
+// splitRoles parses a comma separated list of roles
+func splitRoles(list string) []string {
+	var roles []string
+	for _, role := range strings.Split(list, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,126 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	_ "modernc.org/sqlite"
+)
+
+func bcryptHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return string(hash)
+}
+
+func argonHash(t *testing.T, password string) string {
+	t.Helper()
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	require.NoError(t, err)
+	key := argon2.IDKey([]byte(password), salt, 1, 1024, 1, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// testStore checks the users every store test sets up: alice with the
+// admin and user roles, and bob without roles
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := s.Authenticate(ctx, "alice", "wonderland")
+	require.NoError(t, err)
+	assert.Equal(t, &User{Username: "alice", Roles: []string{"admin", "user"}}, user)
+
+	user, err = s.Authenticate(ctx, "bob", "builder")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", user.Username)
+	assert.Empty(t, user.Roles)
+
+	for _, credentials := range [][2]string{{"alice", "builder"}, {"alice", ""}, {"carol", "wonderland"}, {"", ""}} {
+		_, err = s.Authenticate(ctx, credentials[0], credentials[1])
+		assert.ErrorIs(t, err, ErrInvalidCredentials, credentials[0])
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	for name, hash := range map[string]string{
+		"bcrypt": bcryptHash(t, "secret"),
+		"argon2": argonHash(t, "secret"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			matched, err := CheckPassword(hash, "secret")
+			require.NoError(t, err)
+			assert.True(t, matched)
+			matched, err = CheckPassword(hash, "Secret")
+			require.NoError(t, err)
+			assert.False(t, matched)
+		})
+	}
+
+	for _, hash := range []string{"secret", "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", "$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		_, err := CheckPassword(hash, "secret")
+		assert.Error(t, err, hash)
+	}
+}
+
+func TestHtpasswdStore(t *testing.T) {
+	file := strings.Join([]string{
+		"# gateway users",
+		"alice:" + argonHash(t, "wonderland") + ":admin, user",
+		"",
+		"bob:" + bcryptHash(t, "builder"),
+	}, "\n")
+	s, err := ParseHtpasswd(strings.NewReader(file))
+	require.NoError(t, err)
+	testStore(t, s)
+}
+
+func TestParseHtpasswd_Invalid(t *testing.T) {
+	hash := bcryptHash(t, "secret")
+	for name, file := range map[string]string{
+		"no hash":    "alice",
+		"plain text": "alice:secret",
+		"no user":    ":" + hash,
+		"twice":      "alice:" + hash + "\nalice:" + hash,
+		"fields":     "alice:" + hash + ":admin:extra",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseHtpasswd(strings.NewReader(file))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSQLStore(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	// Every connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE users (username TEXT PRIMARY KEY, password_hash TEXT NOT NULL, roles TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO users VALUES ($1, $2, $3), ($4, $5, NULL)`,
+		"alice", bcryptHash(t, "wonderland"), "admin,user", "bob", argonHash(t, "builder"))
+	require.NoError(t, err)
+
+	s := NewSQLStore(db, "")
+	testStore(t, s)
+
+	// Errors of the database aren't invalid credentials
+	require.NoError(t, s.Close())
+	_, err = s.Authenticate(context.Background(), "alice", "wonderland")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+}